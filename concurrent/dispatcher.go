@@ -76,17 +76,14 @@ func NewDispatcher(pConsumerFunc ConsumerFunc, pBatchSize int) *Dispatcher {
 
 func (vSelf *Dispatcher) dequeue() []interface{} {
 
+	vSelf.itemsLock.Lock()
+	defer vSelf.itemsLock.Unlock()
 	vRis := vSelf.pendingItems
 	vLen := len(vRis)
 	if vLen == 0 {
 		return []interface{}{}
 	}
 
-	vSelf.itemsLock.Lock()
-	defer vSelf.itemsLock.Unlock()
-	vRis = vSelf.pendingItems
-	vLen = len(vRis)
-
 	if vLen < vSelf.batchSize {
 		vSelf.pendingItems = make([]interface{}, 0, vSelf.batchSize)
 		return vRis[0:vLen]
@@ -143,7 +140,7 @@ func (vSelf *Dispatcher) worker(pCntWorker int) {
 			vSelf.runningWorkersCounter.IncreaseBy(-1)
 		} else {
 
-			if vSelf.IsWorking() == false && vSelf.status >= DispatcherStatus_Ending {
+			if vSelf.IsWorking() == false && vSelf.GetStatus() >= DispatcherStatus_Ending {
 
 				var vEndWorkerError error
 				if vSelf.WorkerLifeCycleHandlerFunc != nil {
@@ -190,11 +187,11 @@ func (vSelf *Dispatcher) SetErrorHandler(pErrorHandlerFunc ErrorHandlerFunc) {
 // nil in case of success
 func (vSelf *Dispatcher) Start(pNumWorkers int) error {
 
-	if vSelf.status != DispatcherStatus_Ready {
-		return diagnostic.NewError("Dispatcher in status %d", nil, vSelf.status)
+	if vStatus := vSelf.GetStatus(); vStatus != DispatcherStatus_Ready {
+		return diagnostic.NewError("Dispatcher in status %d", nil, vStatus)
 	}
 
-	vSelf.status = DispatcherStatus_Started
+	vSelf.setStatus(DispatcherStatus_Started)
 	vSelf.failed = false
 
 	vSelf.workersLocals = make([]WorkerLocals, pNumWorkers)
@@ -208,24 +205,32 @@ func (vSelf *Dispatcher) Start(pNumWorkers int) error {
 
 //GetStatus Return the status of the dispatcher
 func (vSelf *Dispatcher) GetStatus() DispatcherStatus {
+	vSelf.itemsLock.Lock()
+	defer vSelf.itemsLock.Unlock()
 	return vSelf.status
 }
 
+func (vSelf *Dispatcher) setStatus(pStatus DispatcherStatus) {
+	vSelf.itemsLock.Lock()
+	defer vSelf.itemsLock.Unlock()
+	vSelf.status = pStatus
+}
+
 //WaitForCompletition wait for activity completition and notifies workers to stop
 func (vSelf *Dispatcher) WaitForCompletition() {
-	if vSelf.status < DispatcherStatus_Started {
+	if vSelf.GetStatus() < DispatcherStatus_Started {
 		return
 	}
 
 	for {
 		if vSelf.IsWorking() == false {
-			vSelf.status = DispatcherStatus_Ending
+			vSelf.setStatus(DispatcherStatus_Ending)
 			break
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
 	vSelf.runningWorkers.Wait()
-	vSelf.status = DispatcherStatus_Ready
+	vSelf.setStatus(DispatcherStatus_Ready)
 }
 
 //IsSucceded returns true if the operation is succeded. It must be requested only after WaitForCompletition method invocation
@@ -11,7 +11,7 @@ func TestDispatcher(pTest *testing.T) {
 	vIterations := 100
 	vPrintStats := 100
 	vTimeout := time.Second * 10
-	vDispatcher := NewDispatcher(func(vSelf *Dispatcher, pWorkerCnt int, pValue interface{}) error {
+	vDispatcher := NewDispatcher(func(vSelf *Dispatcher, pWorkerCnt int, pValue interface{}, pWorkerLocals WorkerLocals) error {
 
 		vValue, _ := pValue.(int)
 
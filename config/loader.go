@@ -0,0 +1,426 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+const (
+	//Source_Default source of the values of the default bean
+	Source_Default = "default"
+	//Source_FilePrefix prefix of the sources of values read from files, followed by the file name
+	Source_FilePrefix = "file:"
+	//Source_EnvPrefix prefix of the sources of values read from environment variables, followed by the variable name
+	Source_EnvPrefix = "env:"
+	//Source_FlagPrefix prefix of the sources of values read from command line flags, followed by the flag name
+	Source_FlagPrefix = "flag:"
+	//Tag_Config struct tag of the configuration fields, config:"required" marks the fields that must be set to a non zero value
+	Tag_Config = "config"
+)
+
+//Loader merges into a configuration struct, in order: a default bean, json files, environment variables and command line flags.
+//Objects are merged field by field, other values are replaced by the following layers.
+//Fields are identified by paths of their json names separated by dots (ex. db.host)
+type Loader struct {
+	defaults  interface{}
+	files     []configFile
+	envPrefix string
+	flagSet   *flag.FlagSet
+}
+
+type configFile struct {
+	name     string
+	optional bool
+}
+
+//LoadResult sources of the values of a loaded configuration
+type LoadResult struct {
+	sources map[string]string
+}
+
+//NewLoader create a loader without layers
+func NewLoader() *Loader {
+	return &Loader{}
+}
+
+//WithDefaults sets the bean of the default values, usually of the same type of the configuration
+func (vSelf *Loader) WithDefaults(pDefaults interface{}) *Loader {
+	vSelf.defaults = pDefaults
+	return vSelf
+}
+
+//AddFile adds a file saved by persistency, with any codec producing json. Missing files are errors
+func (vSelf *Loader) AddFile(pFile string) *Loader {
+	vSelf.files = append(vSelf.files, configFile{name: pFile})
+	return vSelf
+}
+
+//AddOptionalFile adds a file like AddFile, missing files are skipped
+func (vSelf *Loader) AddOptionalFile(pFile string) *Loader {
+	vSelf.files = append(vSelf.files, configFile{name: pFile, optional: true})
+	return vSelf
+}
+
+//WithEnvPrefix enables environment variables named prefix_FIELD_SUB, the uppercase path of the field with underscores.
+//String fields take the value as is, the other fields take json values (ex. 10, true, ["a","b"])
+func (vSelf *Loader) WithEnvPrefix(pPrefix string) *Loader {
+	vSelf.envPrefix = pPrefix
+	return vSelf
+}
+
+//WithFlags enables the flags set on the command line whose name is the path of a field, case insensitive (see DefineFlags).
+//Values are parsed like environment variables
+func (vSelf *Loader) WithFlags(pFlagSet *flag.FlagSet) *Loader {
+	vSelf.flagSet = pFlagSet
+	return vSelf
+}
+
+//DefineFlags defines a string flag for each field of a configuration, named by the path of the field
+func DefineFlags(pFlagSet *flag.FlagSet, pConfig interface{}) {
+	for _, vCurField := range collectConfigFields(reflect.TypeOf(pConfig), nil, nil) {
+		vName := strings.Join(vCurField.path, ".")
+		if pFlagSet.Lookup(vName) == nil {
+			pFlagSet.String(vName, "", "configuration "+vName)
+		}
+	}
+}
+
+//Load merges the layers into a configuration
+//Parameters:
+// pConfig = pointer to the configuration struct, fields not set by any layer keep their value
+//Returns:
+// sources of the values
+// error if a layer can't be read, a required field is not set or the configuration is invalid (see persistency.ValidateBean)
+func (vSelf *Loader) Load(pConfig interface{}) (*LoadResult, error) {
+
+	vConfigType := reflect.TypeOf(pConfig)
+	if vConfigType == nil || vConfigType.Kind() != reflect.Ptr || vConfigType.Elem().Kind() != reflect.Struct {
+		return nil, diagnostic.NewError("configuration %T must be a pointer to a struct", nil, pConfig)
+	}
+	vFields := collectConfigFields(vConfigType, nil, nil)
+	vKeys := newConfigKeys(vFields)
+
+	vRis := &LoadResult{sources: make(map[string]string)}
+	vMerged := make(map[string]interface{})
+
+	if vSelf.defaults != nil {
+		vJson, vJsonError := json.Marshal(vSelf.defaults)
+		if vJsonError != nil {
+			return nil, diagnostic.NewError("error while reading default configuration", vJsonError)
+		}
+		if vMergeError := vRis.mergeJson(vMerged, vJson, vKeys, Source_Default); vMergeError != nil {
+			return nil, diagnostic.NewError("error while reading default configuration", vMergeError)
+		}
+	}
+
+	for _, vCurFile := range vSelf.files {
+		vContent, vReadError := ioutil.ReadFile(vCurFile.name)
+		if os.IsNotExist(vReadError) && vCurFile.optional {
+			continue
+		}
+		if vReadError != nil {
+			return nil, diagnostic.NewError("error while reading configuration file %s", vReadError, vCurFile.name)
+		}
+		vJson, vJsonError := persistency.BeanDataToJson(vContent)
+		if vJsonError != nil {
+			return nil, diagnostic.NewError("error while reading configuration file %s", vJsonError, vCurFile.name)
+		}
+		if vMergeError := vRis.mergeJson(vMerged, vJson, vKeys, Source_FilePrefix+vCurFile.name); vMergeError != nil {
+			return nil, diagnostic.NewError("error while reading configuration file %s", vMergeError, vCurFile.name)
+		}
+	}
+
+	if vSelf.envPrefix != "" {
+		for _, vCurField := range vFields {
+			vName := vSelf.envPrefix + "_" + strings.ToUpper(strings.Join(vCurField.path, "_"))
+			vText, vFound := os.LookupEnv(vName)
+			if vFound == false {
+				continue
+			}
+			if vSetError := vRis.setText(vMerged, vCurField, vText, Source_EnvPrefix+vName); vSetError != nil {
+				return nil, diagnostic.NewError("invalid value of environment variable %s", vSetError, vName)
+			}
+		}
+	}
+
+	if vSelf.flagSet != nil {
+		vFieldsByName := make(map[string]configField)
+		for _, vCurField := range vFields {
+			vFieldsByName[strings.ToLower(strings.Join(vCurField.path, "."))] = vCurField
+		}
+		var vFlagError error
+		vSelf.flagSet.Visit(func(pFlag *flag.Flag) {
+			vField, vIsField := vFieldsByName[strings.ToLower(pFlag.Name)]
+			if vIsField == false || vFlagError != nil {
+				return
+			}
+			if vSetError := vRis.setText(vMerged, vField, pFlag.Value.String(), Source_FlagPrefix+pFlag.Name); vSetError != nil {
+				vFlagError = diagnostic.NewError("invalid value of flag %s", vSetError, pFlag.Name)
+			}
+		})
+		if vFlagError != nil {
+			return nil, vFlagError
+		}
+	}
+
+	vJson, vJsonError := json.Marshal(vMerged)
+	if vJsonError != nil {
+		return nil, diagnostic.NewError("error while merging configuration", vJsonError)
+	}
+	if vUnmarshalError := json.Unmarshal(vJson, pConfig); vUnmarshalError != nil {
+		return nil, diagnostic.NewError("error while loading configuration %T", vUnmarshalError, pConfig)
+	}
+
+	vMissing := make([]string, 0)
+	for _, vCurField := range vFields {
+		if vCurField.required && isZeroField(reflect.ValueOf(pConfig), vCurField.indexes) {
+			vMissing = append(vMissing, strings.Join(vCurField.path, "."))
+		}
+	}
+	if len(vMissing) > 0 {
+		return vRis, diagnostic.NewError("required configuration not set: %s", nil, strings.Join(vMissing, ", "))
+	}
+	if vValidateError := persistency.ValidateBean(pConfig); vValidateError != nil {
+		return vRis, diagnostic.NewError("invalid configuration", vValidateError)
+	}
+	return vRis, nil
+}
+
+//GetSource returns the source of the value of a field (ex. Source_Default, file:conf.json, env:APP_DB_HOST), empty if not set by any layer
+func (vSelf *LoadResult) GetSource(pPath string) string {
+	return vSelf.sources[pPath]
+}
+
+//GetPaths returns the sorted paths of the values set by the layers
+func (vSelf *LoadResult) GetPaths() []string {
+	vRis := make([]string, 0, len(vSelf.sources))
+	for vCurPath := range vSelf.sources {
+		vRis = append(vRis, vCurPath)
+	}
+	sort.Strings(vRis)
+	return vRis
+}
+
+//mergeJson merges a json object into the merged values, keys are matched to the fields case insensitively like json.Unmarshal
+func (vSelf *LoadResult) mergeJson(pMerged map[string]interface{}, pJson []byte, pKeys configKeys, pSource string) error {
+	vDecoder := json.NewDecoder(bytes.NewReader(pJson))
+	vDecoder.UseNumber()
+	var vLayer map[string]interface{}
+	if vDecodeError := vDecoder.Decode(&vLayer); vDecodeError != nil {
+		return vDecodeError
+	}
+	vSelf.mergeObject(pMerged, pKeys.normalize(vLayer), "", pSource)
+	return nil
+}
+
+func (vSelf *LoadResult) mergeObject(pMerged map[string]interface{}, pLayer map[string]interface{}, pPath string, pSource string) {
+	for vCurKey, vCurValue := range pLayer {
+		vPath := joinConfigPath(pPath, vCurKey)
+		vLayerObject, vIsLayerObject := vCurValue.(map[string]interface{})
+		vMergedObject, vIsMergedObject := pMerged[vCurKey].(map[string]interface{})
+		if vIsLayerObject && vIsMergedObject {
+			vSelf.mergeObject(vMergedObject, vLayerObject, vPath, pSource)
+			continue
+		}
+		pMerged[vCurKey] = vCurValue
+		vSelf.setSource(vPath, vCurValue, pSource)
+	}
+}
+
+//setSource records the source of a value replacing the previous one, objects are recorded by leaf
+func (vSelf *LoadResult) setSource(pPath string, pValue interface{}, pSource string) {
+	for vCurPath := range vSelf.sources {
+		if vCurPath == pPath || strings.HasPrefix(vCurPath, pPath+".") {
+			delete(vSelf.sources, vCurPath)
+		}
+	}
+	if vObject, vIsObject := pValue.(map[string]interface{}); vIsObject && len(vObject) > 0 {
+		for vCurKey, vCurValue := range vObject {
+			vSelf.setSource(joinConfigPath(pPath, vCurKey), vCurValue, pSource)
+		}
+		return
+	}
+	vSelf.sources[pPath] = pSource
+}
+
+//setText sets a field from the text of an environment variable or a flag
+func (vSelf *LoadResult) setText(pMerged map[string]interface{}, pField configField, pText string, pSource string) error {
+
+	var vValue interface{} = pText
+	if pField.kind != reflect.String {
+		vDecoder := json.NewDecoder(strings.NewReader(pText))
+		vDecoder.UseNumber()
+		if vDecodeError := vDecoder.Decode(&vValue); vDecodeError != nil {
+			return diagnostic.NewError("%s is not a json value", vDecodeError, pText)
+		}
+	}
+
+	vObject := pMerged
+	for _, vCurKey := range pField.path[:len(pField.path)-1] {
+		vChild, vIsObject := vObject[vCurKey].(map[string]interface{})
+		if vIsObject == false {
+			vChild = make(map[string]interface{})
+			vObject[vCurKey] = vChild
+		}
+		vObject = vChild
+	}
+	vObject[pField.path[len(pField.path)-1]] = vValue
+	vSelf.setSource(strings.Join(pField.path, "."), vValue, pSource)
+	return nil
+}
+
+func joinConfigPath(pPath string, pKey string) string {
+	if pPath == "" {
+		return pKey
+	}
+	return pPath + "." + pKey
+}
+
+//configKeys json names of the fields of a struct, with the names of the fields of the nested structs
+type configKeys map[string]configKeys
+
+//newConfigKeys returns the json names of the fields of a configuration
+func newConfigKeys(pFields []configField) configKeys {
+	vRis := make(configKeys)
+	for _, vCurField := range pFields {
+		vKeys := vRis
+		for _, vCurName := range vCurField.path[:len(vCurField.path)-1] {
+			if vKeys[vCurName] == nil {
+				vKeys[vCurName] = make(configKeys)
+			}
+			vKeys = vKeys[vCurName]
+		}
+		vName := vCurField.path[len(vCurField.path)-1]
+		if _, vFound := vKeys[vName]; vFound == false {
+			vKeys[vName] = nil
+		}
+	}
+	return vRis
+}
+
+//normalize returns the keys of an object of a layer replaced by the json names of the matching fields.
+//An exact match prevails on a case insensitive one, keys of unknown fields and of maps are unchanged
+func (vSelf configKeys) normalize(pLayer map[string]interface{}) map[string]interface{} {
+	vRis := make(map[string]interface{}, len(pLayer))
+	for vCurKey, vCurValue := range pLayer {
+		vName := vCurKey
+		if _, vExact := vSelf[vCurKey]; vExact == false {
+			for vCurName := range vSelf {
+				if strings.EqualFold(vCurName, vCurKey) {
+					vName = vCurName
+					break
+				}
+			}
+			if _, vExactInLayer := pLayer[vName]; vExactInLayer && vName != vCurKey {
+				continue
+			}
+		}
+		if vObject, vIsObject := vCurValue.(map[string]interface{}); vIsObject && vSelf[vName] != nil {
+			vCurValue = vSelf[vName].normalize(vObject)
+		}
+		vRis[vName] = vCurValue
+	}
+	return vRis
+}
+
+//configField leaf field of a configuration
+type configField struct {
+	path     []string
+	indexes  []int
+	kind     reflect.Kind
+	required bool
+}
+
+//collectConfigFields returns the leaf fields of a struct type, nested structs are expanded
+//Parameters:
+// pType = struct type
+// pParent = field containing the struct, nil for the configuration
+// pTypesOnPath = struct types being expanded, a recursive struct is a leaf set by a json value
+func collectConfigFields(pType reflect.Type, pParent *configField, pTypesOnPath map[reflect.Type]bool) []configField {
+
+	for pType.Kind() == reflect.Ptr {
+		pType = pType.Elem()
+	}
+	vRis := make([]configField, 0)
+	if pType.Kind() != reflect.Struct {
+		return vRis
+	}
+	if pTypesOnPath == nil {
+		pTypesOnPath = make(map[reflect.Type]bool)
+	}
+	pTypesOnPath[pType] = true
+	defer delete(pTypesOnPath, pType)
+
+	for vCnt := 0; vCnt < pType.NumField(); vCnt++ {
+		vField := pType.Field(vCnt)
+		if vField.PkgPath != "" && vField.Anonymous == false {
+			continue
+		}
+		vName := vField.Name
+		if vTag, vTagged := vField.Tag.Lookup("json"); vTagged {
+			vTagName := strings.Split(vTag, ",")[0]
+			if vTagName == "-" {
+				continue
+			}
+			if vTagName != "" {
+				vName = vTagName
+			}
+		}
+
+		vCurField := configField{indexes: []int{vCnt}, kind: vField.Type.Kind(), required: vField.Tag.Get(Tag_Config) == "required"}
+		if pParent != nil {
+			vCurField.path = append(vCurField.path, pParent.path...)
+			vCurField.indexes = append(append([]int{}, pParent.indexes...), vCnt)
+		}
+
+		vFieldType := vField.Type
+		for vFieldType.Kind() == reflect.Ptr {
+			vFieldType = vFieldType.Elem()
+		}
+		if vFieldType.Kind() == reflect.Struct && isSelfDecoding(vFieldType) == false && pTypesOnPath[vFieldType] == false {
+			if vField.Anonymous == false || vField.Tag.Get("json") != "" {
+				vCurField.path = append(vCurField.path, vName)
+			}
+			vRis = append(vRis, collectConfigFields(vFieldType, &vCurField, pTypesOnPath)...)
+			continue
+		}
+		vCurField.kind = vFieldType.Kind()
+		if reflect.PointerTo(vFieldType).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+			//values like time.Time are read from json strings
+			vCurField.kind = reflect.String
+		}
+		vCurField.path = append(vCurField.path, vName)
+		vRis = append(vRis, vCurField)
+	}
+	return vRis
+}
+
+//isSelfDecoding returns true if a type decodes its json by itself, so it's a leaf also if it's a struct
+func isSelfDecoding(pType reflect.Type) bool {
+	vPointer := reflect.PointerTo(pType)
+	return vPointer.Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) || vPointer.Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+//isZeroField returns true if a field has the zero value or is inside a nil struct pointer
+func isZeroField(pValue reflect.Value, pIndexes []int) bool {
+	for _, vCurIndex := range pIndexes {
+		for pValue.Kind() == reflect.Ptr {
+			if pValue.IsNil() {
+				return true
+			}
+			pValue = pValue.Elem()
+		}
+		pValue = pValue.Field(vCurIndex)
+	}
+	return pValue.IsZero()
+}
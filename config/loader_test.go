@@ -0,0 +1,148 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+type testDbConfig struct {
+	Host     string `json:"host" config:"required"`
+	Port     int    `json:"port" validate:"min=1,max=65535"`
+	Password string `json:"password" config:"required"`
+}
+
+type testConfig struct {
+	Name    string        `json:"name"`
+	Debug   bool          `json:"debug"`
+	Tags    []string      `json:"tags"`
+	Timeout time.Duration `json:"timeout"`
+	Started time.Time     `json:"started"`
+	Db      testDbConfig  `json:"db"`
+}
+
+func TestLoader(pTest *testing.T) {
+
+	vDir := pTest.TempDir()
+	vBaseFile := filepath.Join(vDir, "base.json")
+	ioutil.WriteFile(vBaseFile, []byte(`{"name":"base","tags":["a","b"],"db":{"host":"dbhost","port":3306}}`), 0644)
+	vLocalFile := filepath.Join(vDir, "local.json")
+	vCodec, _ := persistency.GetCodec("cbor")
+	persistency.SaveBeanIntoFileWithCodec(map[string]interface{}{"db": map[string]interface{}{"port": 3307}}, vLocalFile, vCodec)
+
+	pTest.Setenv("TESTAPP_DB_PASSWORD", "secret")
+	pTest.Setenv("TESTAPP_DEBUG", "true")
+	pTest.Setenv("TESTAPP_STARTED", "2024-01-02T03:04:05Z")
+
+	vFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	DefineFlags(vFlags, &testConfig{})
+	if vParseError := vFlags.Parse([]string{"-db.host", "flaghost", "-tags", `["c"]`}); vParseError != nil {
+		pTest.Fatal("failed to parse flags", vParseError)
+	}
+
+	vConfig := &testConfig{}
+	vResult, vLoadError := NewLoader().
+		WithDefaults(&testConfig{Name: "default", Timeout: time.Second, Db: testDbConfig{Port: 1}}).
+		AddFile(vBaseFile).
+		AddOptionalFile(filepath.Join(vDir, "missing.json")).
+		AddFile(vLocalFile).
+		WithEnvPrefix("TESTAPP").
+		WithFlags(vFlags).
+		Load(vConfig)
+	if vLoadError != nil {
+		pTest.Fatal("failed to load configuration", vLoadError)
+	}
+
+	if vConfig.Name != "base" || vConfig.Debug == false || len(vConfig.Tags) != 1 || vConfig.Timeout != time.Second || vConfig.Started.Year() != 2024 ||
+		vConfig.Db.Host != "flaghost" || vConfig.Db.Port != 3307 || vConfig.Db.Password != "secret" {
+		pTest.Errorf("unexpected configuration %+v", vConfig)
+	}
+
+	for vPath, vExpectedSource := range map[string]string{
+		"name":        Source_FilePrefix + vBaseFile,
+		"timeout":     Source_Default,
+		"debug":       Source_EnvPrefix + "TESTAPP_DEBUG",
+		"tags":        Source_FlagPrefix + "tags",
+		"db.host":     Source_FlagPrefix + "db.host",
+		"db.port":     Source_FilePrefix + vLocalFile,
+		"db.password": Source_EnvPrefix + "TESTAPP_DB_PASSWORD",
+	} {
+		if vResult.GetSource(vPath) != vExpectedSource {
+			pTest.Errorf("unexpected source of %s: %s", vPath, vResult.GetSource(vPath))
+		}
+	}
+
+	if _, vMissingError := NewLoader().AddFile(filepath.Join(vDir, "missing.json")).Load(&testConfig{}); vMissingError == nil {
+		pTest.Error("missing file accepted")
+	}
+	if _, vRequiredError := NewLoader().AddFile(vBaseFile).Load(&testConfig{}); vRequiredError == nil {
+		pTest.Error("configuration without required db.password accepted")
+	}
+
+	if _, vInvalidError := NewLoader().WithDefaults(&testConfig{Db: testDbConfig{Host: "h", Password: "p", Port: 70000}}).Load(&testConfig{}); persistency.IsValidationError(vInvalidError) == false {
+		pTest.Errorf("expected validation error, got %v", vInvalidError)
+	}
+
+	pTest.Setenv("TESTAPP_DB_PORT", "not a number")
+	if _, vEnvError := NewLoader().WithEnvPrefix("TESTAPP").Load(&testConfig{}); vEnvError == nil {
+		pTest.Error("invalid environment variable accepted")
+	}
+}
+
+func TestLoaderKeysCase(pTest *testing.T) {
+
+	type testCaseConfig struct {
+		Host string
+		Db   testDbConfig
+	}
+
+	vFile := filepath.Join(pTest.TempDir(), "case.json")
+	ioutil.WriteFile(vFile, []byte(`{"host":"filehost","DB":{"HOST":"dbhost","Port":3306}}`), 0644)
+	pTest.Setenv("ZZ_HOST", "envhost")
+	pTest.Setenv("ZZ_DB_PASSWORD", "secret")
+
+	vConfig := &testCaseConfig{}
+	vResult, vLoadError := NewLoader().AddFile(vFile).WithEnvPrefix("ZZ").Load(vConfig)
+	if vLoadError != nil {
+		pTest.Fatal("failed to load configuration", vLoadError)
+	}
+	if vConfig.Host != "envhost" || vConfig.Db.Host != "dbhost" || vConfig.Db.Port != 3306 {
+		pTest.Errorf("unexpected configuration %+v", vConfig)
+	}
+	for vPath, vExpectedSource := range map[string]string{
+		"Host":    Source_EnvPrefix + "ZZ_HOST",
+		"Db.host": Source_FilePrefix + vFile,
+		"Db.port": Source_FilePrefix + vFile,
+	} {
+		if vResult.GetSource(vPath) != vExpectedSource {
+			pTest.Errorf("unexpected source of %s: %s", vPath, vResult.GetSource(vPath))
+		}
+	}
+}
+
+type testNode struct {
+	Name string
+	Next *testNode
+}
+
+func TestLoaderRecursiveStruct(pTest *testing.T) {
+
+	type testRecursiveConfig struct {
+		Root testNode
+	}
+
+	pTest.Setenv("ZZ_ROOT_NAME", "first")
+	pTest.Setenv("ZZ_ROOT_NEXT", `{"Name":"second"}`)
+
+	vConfig := &testRecursiveConfig{}
+	if _, vLoadError := NewLoader().WithEnvPrefix("ZZ").Load(vConfig); vLoadError != nil {
+		pTest.Fatal("failed to load configuration", vLoadError)
+	}
+	if vConfig.Root.Name != "first" || vConfig.Root.Next == nil || vConfig.Root.Next.Name != "second" || vConfig.Root.Next.Next != nil {
+		pTest.Errorf("unexpected configuration %+v", vConfig)
+	}
+}
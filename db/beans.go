@@ -1,8 +1,13 @@
 package db
 
 import (
-	"encoding/json"
-	"fmt"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"path"
+	"reflect"
+	"strings"
+	"time"
 	"github.com/mysinmyc/gocommons/diagnostic"
 	"github.com/mysinmyc/gocommons/persistency"
 )
@@ -19,30 +24,156 @@ type IndentifiableInDb interface {
 	GetIdInDb() string
 }
 
+//NamespacedBean optional interface of beans choosing their namespace, by default the namespace is derived from the bean type (see GetBeanNamespace)
+type NamespacedBean interface {
+	GetBeanNamespace() string
+}
+
+//BeanMetadata metadata stored together with a bean
+type BeanMetadata struct {
+	Namespace   string
+	Id          string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	//ContentHash sha256 of the serialized bean, empty for beans not saved since the namespaces migration
+	ContentHash string
+	//Version increased by each save of a persistency.VersionedBean, 0 for other beans
+	Version     int64
+	//ExpiresAt expiry of a bean saved by SaveBeanWithTTL, zero for beans that never expire
+	ExpiresAt   time.Time
+}
+
+//GetBeanNamespace returns the namespace of a bean: the value returned by GetBeanNamespace for NamespacedBean,
+//otherwise package name and type name (ex. mypackage.MyBean).
+//Beans saved before the introduction of namespaces belong to the empty namespace, each one is moved into the namespace
+//of the first type that loads or saves it, or all together by AdoptLegacyBeans
+func GetBeanNamespace(pBean interface{}) string {
+
+	if vNamespaced, vIsNamespaced := pBean.(NamespacedBean); vIsNamespaced {
+		return vNamespaced.GetBeanNamespace()
+	}
+
+	vType := reflect.TypeOf(pBean)
+	for vType != nil && vType.Kind() == reflect.Ptr {
+		vType = vType.Elem()
+	}
+	if vType == nil || vType.Name() == "" {
+		return ""
+	}
+	return path.Base(vType.PkgPath()) + "." + vType.Name()
+}
+
+
+//SetBeanCodec sets the codec of the beans saved by SaveBean, beans saved with other codecs remain readable.
+//Codecs other than json can't be used together with json secondary indexes
+//Parameters:
+// pCodec = codec, nil for json
+func (vSelf *DbHelper) SetBeanCodec(pCodec persistency.Codec) error {
+
+	vSelf.beanIndexesLock.Lock()
+	defer vSelf.beanIndexesLock.Unlock()
 
-func (vSelf *DbHelper) initBeans() error {
+	if persistency.IsJsonCodec(pCodec) == false {
+		for _, vCurIndex := range vSelf.beanIndexes {
+			if vCurIndex.Mode == BeanIndexMode_Json {
+				return diagnostic.NewError("codec %s not supported by json bean index %s", nil, pCodec.GetName(), vCurIndex.Name)
+			}
+		}
+	}
+	vSelf.beanCodec = pCodec
+	return nil
+}
+
+//GetBeanCodec returns the codec of the beans saved by SaveBean
+func (vSelf *DbHelper) GetBeanCodec() persistency.Codec {
+	vSelf.beanIndexesLock.RLock()
+	defer vSelf.beanIndexesLock.RUnlock()
+	if vSelf.beanCodec == nil {
+		return persistency.JsonCodec{}
+	}
+	return vSelf.beanCodec
+}
+
+//InitBeans creates or upgrades the beans tables, done automatically by the bean functions of DbHelper.
+//It must be called before the bean functions of the transactions started by InTransaction:
+//tables created inside a transaction disappear if it is rolled back and mysql commits the transaction before ddl statements
+func (vSelf *DbHelper) InitBeans() error {
+	return vSelf.initBeans(vSelf.db, nil)
+}
+
+//initBeans applies the beans migrations once, transactions require them already applied
+func (vSelf *DbHelper) initBeans(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+	vSelf.beansInitLock.Lock()
+	defer vSelf.beansInitLock.Unlock()
 	if vSelf.beansInitialized {
 		return nil
 	}
 
-	switch vSelf.GetDbType() {
-		case DbType_sqlite3:
-			_,vCreateError:=vSelf.Exec(DDL_BEANS_SQLITE)
-			return vCreateError
-		case DbType_mysql:
-			_,vCreateError:=vSelf.Exec(DDL_BEANS_MYSQL)
-			return vCreateError
+	if pTransaction != nil {
+		return diagnostic.NewError("beans tables not initialized, call DbHelper.InitBeans before using beans in a transaction", nil)
 	}
 
-	return diagnostic.NewError("Beans not supported for dbtype %s", nil,vSelf.GetDbType())
+	_, vMigrateError := vSelf.Migrate(_BeansMigrations, MigrateOptions{})
+	if vMigrateError != nil {
+		return diagnostic.NewError("Error while creating beans table", vMigrateError)
+	}
+
+	//beans saved before the introduction of namespaces are adopted by the bean functions
+	vRows, vLegacyError := vSelf.selectOn(pExecutor, FIELD_BEANS_ID).From(TABLE_BEANS).Where(Eq(FIELD_BEANS_NAMESPACE, "")).Limit(1).Query()
+	if vLegacyError != nil {
+		return diagnostic.NewError("Error while searching legacy beans", vLegacyError)
+	}
+	vSelf.beansLegacyPresent = vRows.Next()
+	vRows.Close()
+
+	vSelf.beansInitialized = true
+	return nil
+}
+
+//adoptLegacyBean moves into a namespace the bean with the same id saved before the introduction of namespaces,
+//if the namespace doesn't contain it
+//Returns:
+// true if the bean has been moved
+// error
+func (vSelf *DbHelper) adoptLegacyBean(pExecutor SqlExecutor, pNamespace string, pId string) (bool, error) {
+
+	if vSelf.beansLegacyPresent == false || pNamespace == "" {
+		return false, nil
+	}
+
+	//mysql doesn't allow subqueries on the updated table, unless materialized by a derived table
+	vResult, vUpdateError := pExecutor.Exec("update "+TABLE_BEANS+" set "+FIELD_BEANS_NAMESPACE+"=? where "+FIELD_BEANS_NAMESPACE+"='' and "+FIELD_BEANS_ID+"=? and "+FIELD_BEANS_ID+" not in (select "+FIELD_BEANS_ID+" from (select "+FIELD_BEANS_ID+" from "+TABLE_BEANS+" where "+FIELD_BEANS_NAMESPACE+"=? and "+FIELD_BEANS_ID+"=?) adopted)", pNamespace, pId, pNamespace, pId)
+	if vUpdateError != nil {
+		return false, diagnostic.NewError("Error while moving legacy bean %s into namespace %s", vUpdateError, pId, pNamespace)
+	}
+	vAffected, vAffectedError := vResult.RowsAffected()
+	if vAffectedError != nil {
+		return false, diagnostic.NewError("Error while moving legacy bean %s into namespace %s", vAffectedError, pId, pNamespace)
+	}
+	return vAffected > 0, nil
+}
+
+//beansKeyCondition selects the bean with the given id in the namespace
+func beansKeyCondition(pNamespace string, pId string) Condition {
+	return And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId))
 }
 
 func (vSelf *DbHelper) LoadBean(pBean IndentifiableInDb) error {
+	return vSelf.loadBean(vSelf.db, nil, pBean)
+}
 
-	vSelf.initBeans()
+func (vSelf *DbHelper) loadBean(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb) error {
+	return vSelf.loadBeanByKey(pExecutor, pTransaction, GetBeanNamespace(pBean), pBean.GetIdInDb(), pBean)
+}
+
+func (vSelf *DbHelper) loadBeanByKey(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pId string, pBean interface{}) error {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return vInitError
+	}
 
-	vRows, vError := vSelf.GetDb().Query(
-		fmt.Sprintf("select %s from %s where %s=?", FIELD_BEANS_SERIALIZED, TABLE_BEANS, FIELD_BEANS_ID), pBean.GetIdInDb())
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_SERIALIZED, FIELD_BEANS_VERSION).From(TABLE_BEANS).Where(beansKeyCondition(pNamespace, pId)).Where(beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)).Query()
 
 	if vError != nil {
 		return vError
@@ -51,45 +182,536 @@ func (vSelf *DbHelper) LoadBean(pBean IndentifiableInDb) error {
 	defer vRows.Close()
 
 	if vRows.Next() == false {
-		return &persistency.BeanNotFoundError{BeanID: pBean.GetIdInDb()}
+		vRows.Close()
+		if vAdopted, vAdoptError := vSelf.adoptLegacyBean(pExecutor, pNamespace, pId); vAdoptError != nil || vAdopted {
+			if vAdoptError != nil {
+				return vAdoptError
+			}
+			return vSelf.loadBeanByKey(pExecutor, pTransaction, pNamespace, pId, pBean)
+		}
+		return &persistency.BeanNotFoundError{BeanID: pId}
 	}
 
 	var vData []byte
-	vColumnError := vRows.Scan(&vData)
+	var vVersion int64
+	vColumnError := vRows.Scan(&vData, &vVersion)
 
 	if vColumnError != nil {
 		return vColumnError
 	}
+	//mysql doesn't allow statements while a result set is open
+	vRows.Close()
 
-	vUnmarshalError := json.Unmarshal(vData, pBean)
+	vUpgraded, vUnmarshalError := persistency.UnmarshalAndUpgradeBean(vData, pBean)
 
 	if vUnmarshalError != nil {
 		return vUnmarshalError
 	}
 
+	if vUpgraded && persistency.IsBeanUpgradeWriteBack(pBean) {
+		if vWriteBackError := vSelf.writeBackUpgradedBean(pExecutor, pNamespace, pId, pBean, vData); vWriteBackError != nil {
+			diagnostic.LogWarning("DbHelper.LoadBean", "upgraded bean %s not saved", vWriteBackError, pId)
+		}
+	}
+
+	//the version column prevails on the marshalled one
+	if vVersioned, vIsVersioned := pBean.(persistency.VersionedBean); vIsVersioned {
+		vVersioned.SetBeanVersion(vVersion)
+	}
+
 	return nil
 }
 
+//writeBackUpgradedBean saves the serialized bean upgraded while loaded, only if the row still has the loaded data.
+//Version, timestamps and history are unchanged, indexes are updated
+func (vSelf *DbHelper) writeBackUpgradedBean(pExecutor SqlExecutor, pNamespace string, pId string, pBean interface{}, pLoadedData []byte) error {
+
+	vMarshalledBean, vMarshallingError := persistency.MarshalBean(vSelf.GetBeanCodec(), pBean)
+	if vMarshallingError != nil {
+		return vMarshallingError
+	}
+	vHash := sha256.Sum256(vMarshalledBean)
+
+	vResult, vUpdateError := execBuilt(pExecutor, NewUpdate(vSelf.GetDbType(), TABLE_BEANS).
+		Set(FIELD_BEANS_SERIALIZED, vMarshalledBean).
+		Set(FIELD_BEANS_CONTENT_HASH, hex.EncodeToString(vHash[:])).
+		Where(And(beansKeyCondition(pNamespace, pId), Eq(FIELD_BEANS_SERIALIZED, pLoadedData))).Build)
+	if vUpdateError != nil {
+		return diagnostic.NewError("Error while updating bean %s", vUpdateError, pId)
+	}
+	if vAffected, vAffectedError := vResult.RowsAffected(); vAffectedError != nil || vAffected == 0 {
+		//changed meanwhile
+		return vAffectedError
+	}
+	return vSelf.updateBeanIndexes(pExecutor, pNamespace, pId, pBean, vMarshalledBean)
+}
+
 func (vSelf *DbHelper) SaveBean(pBean IndentifiableInDb) error {
-	
-	vSelf.initBeans()
-	vMarshalledBean, vMarshallingError := json.Marshal(pBean)
+	return vSelf.runBeanChange(GetBeanNamespace(pBean), func(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+		return vSelf.saveBean(pExecutor, pTransaction, pBean, 0)
+	})
+}
+
+//inBeansTransaction executes a function using beans inside a transaction, the beans tables are initialized before beginning it
+func (vSelf *DbHelper) inBeansTransaction(pFunc TransactionFunc) error {
+	if vInitError := vSelf.InitBeans(); vInitError != nil {
+		return vInitError
+	}
+	return vSelf.InTransaction(pFunc)
+}
+
+//runBeanChange executes a change of the beans of a namespace, inside a transaction if the history of the namespace is enabled
+//or side table indexes are declared, so the bean, its history and its indexes are written together
+func (vSelf *DbHelper) runBeanChange(pNamespace string, pChange func(SqlExecutor, *DbHelperTx) error) error {
+	if vSelf.IsBeanHistoryEnabled(pNamespace) || vSelf.hasSideTableBeanIndexes(pNamespace) {
+		return vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+			return pChange(pTx.tx, pTx)
+		})
+	}
+	return pChange(vSelf.db, nil)
+}
+
+func (vSelf *DbHelper) saveBean(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb, pTTL time.Duration) error {
+	return vSelf.saveBeanByKey(pExecutor, pTransaction, GetBeanNamespace(pBean), pBean.GetIdInDb(), pBean, pTTL)
+}
+
+//saveBeanByKey insert or update a bean
+//Parameters:
+// pTTL = time to live of the bean, 0 for beans that never expire
+func (vSelf *DbHelper) saveBeanByKey(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pId string, pBean interface{}, pTTL time.Duration) (vRisError error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return vInitError
+	}
+
+	if len(pNamespace) > beans_NamespaceMaxLength {
+		return diagnostic.NewError("namespace %s exceeds %d characters", nil, pNamespace, beans_NamespaceMaxLength)
+	}
+
+	if _, vAdoptError := vSelf.adoptLegacyBean(pExecutor, pNamespace, pId); vAdoptError != nil {
+		return vAdoptError
+	}
+
+	vHistoryEntry, vHistoryError := vSelf.readBeanHistoryEntry(pExecutor, pNamespace, pId)
+	if vHistoryError != nil {
+		return vHistoryError
+	}
+
+	//the new version is marshalled with the bean
+	vVersioned, vIsVersioned := pBean.(persistency.VersionedBean)
+	var vExpectedVersion int64
+	if vIsVersioned {
+		vExpectedVersion = vVersioned.GetBeanVersion()
+		vVersioned.SetBeanVersion(vExpectedVersion + 1)
+		defer func() {
+			if vRisError != nil {
+				vVersioned.SetBeanVersion(vExpectedVersion)
+			}
+		}()
+	}
+
+	vMarshalledBean, vMarshallingError := persistency.MarshalBean(vSelf.GetBeanCodec(), pBean)
 
 	if vMarshallingError != nil {
-		return diagnostic.NewError("Error while marshalling bean to json",vMarshallingError)
+		return vMarshallingError
+	}
+
+	vHash := sha256.Sum256(vMarshalledBean)
+	vNow := time.Now()
+	vExpiresAt := beansExpiresAt(vNow, pTTL)
+
+	vContentHash := hex.EncodeToString(vHash[:])
+	var vWriteError error
+	if vIsVersioned {
+		//version 0 is also the version of the rows saved by types not versioned, they are updated if they exist
+		vWriteError = vSelf.updateVersionedBean(pExecutor, pNamespace, pId, vExpectedVersion, vMarshalledBean, vNow.Unix(), vContentHash, vExpiresAt)
+		if vExpectedVersion == 0 && persistency.IsConcurrentModification(vWriteError) {
+			vWriteError = vSelf.insertBean(pExecutor, pTransaction, pNamespace, pId, true, vMarshalledBean, vNow, vContentHash, vExpiresAt)
+		}
+	} else {
+		vWriteError = vSelf.insertBean(pExecutor, pTransaction, pNamespace, pId, false, vMarshalledBean, vNow, vContentHash, vExpiresAt)
+	}
+	if vWriteError != nil {
+		return vWriteError
+	}
+
+	if vIndexError := vSelf.updateBeanIndexes(pExecutor, pNamespace, pId, pBean, vMarshalledBean); vIndexError != nil {
+		return vIndexError
+	}
+	return vSelf.writeBeanHistory(pExecutor, pTransaction, vHistoryEntry, false)
+}
+
+//insertBean insert a bean, or update it if it exists and it isn't versioned
+//Parameters:
+// pVersioned = true to create a versioned bean with version 1, it must not exist
+func (vSelf *DbHelper) insertBean(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pId string, pVersioned bool, pMarshalledBean []byte, pNow time.Time, pContentHash string, pExpiresAt sql.NullInt64) error {
+
+	vStatement, vStatementError := BuildInsertStatementString(vSelf.GetDbType(), TABLE_BEANS, []string{FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID, FIELD_BEANS_SERIALIZED, FIELD_BEANS_CREATED_AT, FIELD_BEANS_UPDATED_AT, FIELD_BEANS_CONTENT_HASH, FIELD_BEANS_VERSION, FIELD_BEANS_EXPIRES_AT}, InsertOptions{})
+	if vStatementError != nil {
+		return diagnostic.NewError("Error while creating insert", vStatementError)
 	}
 
-	vInsert,vInsertError:=vSelf.CreateInsert(TABLE_BEANS,[]string{FIELD_BEANS_ID, FIELD_BEANS_SERIALIZED}, InsertOptions{ Replace:true})	
-	defer vInsert.Close()	
-	if vInsertError != nil {
-		return diagnostic.NewError("Error while creating insert",vInsertError)
+	//created_at is preserved when the bean already exists, new versioned beans must not exist
+	vVersion := int64(0)
+	if pVersioned == false {
+		vUpsertClause, vUpsertError := beansUpsertClause(vSelf.GetDbType())
+		if vUpsertError != nil {
+			return vUpsertError
+		}
+		vStatement += vUpsertClause
+	} else {
+		vVersion = 1
+		//an expired copy doesn't prevent the creation
+		_, vPurgeError := execBuilt(pExecutor, NewDelete(vSelf.GetDbType(), TABLE_BEANS).Where(And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId), Le(FIELD_BEANS_EXPIRES_AT, pNow.UnixMilli()))).Build)
+		if vPurgeError != nil {
+			return diagnostic.NewError("Error while deleting expired bean %s", vPurgeError, pId)
+		}
 	}
 
-	_, vInsertExec := vInsert.Exec(pBean.GetIdInDb(), vMarshalledBean)
+	_, vInsertExec := pExecutor.Exec(vStatement, pNamespace, pId, pMarshalledBean, pNow.Unix(), pNow.Unix(), pContentHash, vVersion, pExpiresAt)
 
 	if vInsertExec != nil {
+		if pVersioned {
+			//duplicated key errors are driver specific, the bean is searched instead
+			vRows, vExistsError := vSelf.selectOn(pExecutor, FIELD_BEANS_ID).From(TABLE_BEANS).Where(And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId))).Query()
+			if vExistsError == nil {
+				vExists := vRows.Next()
+				vRows.Close()
+				if vExists {
+					return &persistency.ConcurrentModificationError{BeanID: pId, ExpectedVersion: 0}
+				}
+			}
+		}
 		return diagnostic.NewError("Error while executing insert",vInsertExec)
 	}
+	return nil
+}
+
+//beansUpsertClause returns the clause appended to the insert of a bean to update the existing one
+func beansUpsertClause(pDbType DbType) (string, error) {
+
+	vFields := []string{FIELD_BEANS_SERIALIZED, FIELD_BEANS_UPDATED_AT, FIELD_BEANS_CONTENT_HASH, FIELD_BEANS_EXPIRES_AT}
+	vAssignments := make([]string, len(vFields))
+	switch pDbType {
+	case DbType_sqlite3:
+		for vCnt, vCurField := range vFields {
+			vAssignments[vCnt] = vCurField + "=excluded." + vCurField
+		}
+		return " on conflict(" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + ") do update set " + strings.Join(vAssignments, ","), nil
+	case DbType_mysql:
+		for vCnt, vCurField := range vFields {
+			vAssignments[vCnt] = vCurField + "=values(" + vCurField + ")"
+		}
+		return " on duplicate key update " + strings.Join(vAssignments, ","), nil
+	default:
+		return "", diagnostic.NewError("Beans not supported for dbtype %s", nil, pDbType)
+	}
+}
+
+//updateVersionedBean update a bean only if the stored version is the expected one
+func (vSelf *DbHelper) updateVersionedBean(pExecutor SqlExecutor, pNamespace string, pId string, pExpectedVersion int64, pMarshalledBean []byte, pNow int64, pContentHash string, pExpiresAt sql.NullInt64) error {
+
+	vUpdate := NewUpdate(vSelf.GetDbType(), TABLE_BEANS).
+		Set(FIELD_BEANS_SERIALIZED, pMarshalledBean).
+		Set(FIELD_BEANS_UPDATED_AT, pNow).
+		Set(FIELD_BEANS_CONTENT_HASH, pContentHash).
+		Set(FIELD_BEANS_VERSION, pExpectedVersion+1).
+		Set(FIELD_BEANS_EXPIRES_AT, pExpiresAt).
+		Where(And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId), Eq(FIELD_BEANS_VERSION, pExpectedVersion), beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)))
+
+	vResult, vUpdateError := execBuilt(pExecutor, vUpdate.Build)
+	if vUpdateError != nil {
+		return diagnostic.NewError("Error while updating bean %s", vUpdateError, pId)
+	}
 
+	vAffected, vAffectedError := vResult.RowsAffected()
+	if vAffectedError != nil {
+		return diagnostic.NewError("Error while updating bean %s", vAffectedError, pId)
+	}
+	if vAffected == 0 {
+		return &persistency.ConcurrentModificationError{BeanID: pId, ExpectedVersion: pExpectedVersion}
+	}
 	return nil
 }
+
+//DeleteBean delete a bean
+//Returns:
+// nil if succeeded, an error satisfying persistency.IsBeanNotFound if the bean doesn't exist
+func (vSelf *DbHelper) DeleteBean(pBean IndentifiableInDb) error {
+	return vSelf.runBeanChange(GetBeanNamespace(pBean), func(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+		return vSelf.deleteBean(pExecutor, pTransaction, pBean)
+	})
+}
+
+func (vSelf *DbHelper) deleteBean(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb) error {
+	return vSelf.deleteBeanByKey(pExecutor, pTransaction, GetBeanNamespace(pBean), pBean.GetIdInDb())
+}
+
+func (vSelf *DbHelper) deleteBeanByKey(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pId string) error {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return vInitError
+	}
+
+	if _, vAdoptError := vSelf.adoptLegacyBean(pExecutor, pNamespace, pId); vAdoptError != nil {
+		return vAdoptError
+	}
+
+	vHistoryEntry, vHistoryError := vSelf.readBeanHistoryEntry(pExecutor, pNamespace, pId)
+	if vHistoryError != nil {
+		return vHistoryError
+	}
+
+	vDelete := NewDelete(vSelf.GetDbType(), TABLE_BEANS).Where(beansKeyCondition(pNamespace, pId))
+	vResult, vDeleteError := execBuilt(pExecutor, vDelete.Build)
+	if vDeleteError != nil {
+		return diagnostic.NewError("Error while deleting bean %s", vDeleteError, pId)
+	}
+
+	vAffected, vAffectedError := vResult.RowsAffected()
+	if vAffectedError == nil && vAffected == 0 {
+		return &persistency.BeanNotFoundError{BeanID: pId}
+	}
+	if vIndexError := vSelf.deleteBeanIndexes(pExecutor, pNamespace, pId); vIndexError != nil {
+		return vIndexError
+	}
+	return vSelf.writeBeanHistory(pExecutor, pTransaction, vHistoryEntry, true)
+}
+
+//ExistsBean returns true if a bean with the same namespace and id exists
+func (vSelf *DbHelper) ExistsBean(pBean IndentifiableInDb) (bool, error) {
+	return vSelf.existsBean(vSelf.db, nil, pBean)
+}
+
+func (vSelf *DbHelper) existsBean(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb) (bool, error) {
+	return vSelf.existsBeanByKey(pExecutor, pTransaction, GetBeanNamespace(pBean), pBean.GetIdInDb())
+}
+
+func (vSelf *DbHelper) existsBeanByKey(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pId string) (bool, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return false, vInitError
+	}
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_ID).From(TABLE_BEANS).Where(beansKeyCondition(pNamespace, pId)).Where(beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)).Query()
+	if vError != nil {
+		return false, vError
+	}
+	defer vRows.Close()
+
+	vExists := vRows.Next()
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return false, diagnostic.NewError("Error while checking bean %s", vRowsError, pId)
+	}
+	if vExists == false {
+		vRows.Close()
+		return vSelf.adoptLegacyBean(pExecutor, pNamespace, pId)
+	}
+	return vExists, nil
+}
+
+//GetBeanMetadata returns the metadata of a bean
+//Returns:
+// metadata or an error satisfying persistency.IsBeanNotFound if the bean doesn't exist
+func (vSelf *DbHelper) GetBeanMetadata(pBean IndentifiableInDb) (*BeanMetadata, error) {
+	return vSelf.getBeanMetadata(vSelf.db, nil, pBean)
+}
+
+func (vSelf *DbHelper) getBeanMetadata(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb) (*BeanMetadata, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID, FIELD_BEANS_CREATED_AT, FIELD_BEANS_UPDATED_AT, FIELD_BEANS_CONTENT_HASH, FIELD_BEANS_VERSION, FIELD_BEANS_EXPIRES_AT).From(TABLE_BEANS).Where(beansKeyCondition(GetBeanNamespace(pBean), pBean.GetIdInDb())).Where(beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)).Query()
+	if vError != nil {
+		return nil, vError
+	}
+	defer vRows.Close()
+
+	if vRows.Next() == false {
+		if vRowsError := vRows.Err(); vRowsError != nil {
+			return nil, diagnostic.NewError("Error while reading metadata of bean %s", vRowsError, pBean.GetIdInDb())
+		}
+		vRows.Close()
+		if vAdopted, vAdoptError := vSelf.adoptLegacyBean(pExecutor, GetBeanNamespace(pBean), pBean.GetIdInDb()); vAdoptError != nil || vAdopted {
+			if vAdoptError != nil {
+				return nil, vAdoptError
+			}
+			return vSelf.getBeanMetadata(pExecutor, pTransaction, pBean)
+		}
+		return nil, &persistency.BeanNotFoundError{BeanID: pBean.GetIdInDb()}
+	}
+
+	vRis := &BeanMetadata{}
+	var vCreatedAt, vUpdatedAt sql.NullInt64
+	var vContentHash sql.NullString
+	var vExpiresAt sql.NullInt64
+	vScanError := vRows.Scan(&vRis.Namespace, &vRis.Id, &vCreatedAt, &vUpdatedAt, &vContentHash, &vRis.Version, &vExpiresAt)
+	if vScanError != nil {
+		return nil, diagnostic.NewError("Error while reading metadata of bean %s", vScanError, pBean.GetIdInDb())
+	}
+	vRis.CreatedAt = time.Unix(vCreatedAt.Int64, 0)
+	vRis.UpdatedAt = time.Unix(vUpdatedAt.Int64, 0)
+	vRis.ContentHash = vContentHash.String
+	if vExpiresAt.Valid {
+		vRis.ExpiresAt = time.UnixMilli(vExpiresAt.Int64)
+	}
+	return vRis, nil
+}
+
+//AdoptLegacyBeans moves into a namespace the beans saved before the introduction of namespaces, that belong to the empty namespace.
+//Beans whose id already exists in the namespace are left in the empty namespace
+//Parameters:
+// pNamespace = destination namespace, usually GetBeanNamespace of the type of the legacy beans
+//Returns:
+// number of moved beans
+// error
+func (vSelf *DbHelper) AdoptLegacyBeans(pNamespace string) (int, error) {
+	return vSelf.adoptLegacyBeans(vSelf.db, nil, pNamespace)
+}
+
+func (vSelf *DbHelper) adoptLegacyBeans(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string) (int, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return 0, vInitError
+	}
+
+	if pNamespace == "" || len(pNamespace) > beans_NamespaceMaxLength {
+		return 0, diagnostic.NewError("invalid namespace %s", nil, pNamespace)
+	}
+
+	//mysql doesn't allow subqueries on the updated table, unless materialized by a derived table
+	vResult, vUpdateError := pExecutor.Exec("update "+TABLE_BEANS+" set "+FIELD_BEANS_NAMESPACE+"=? where "+FIELD_BEANS_NAMESPACE+"='' and "+FIELD_BEANS_ID+" not in (select "+FIELD_BEANS_ID+" from (select "+FIELD_BEANS_ID+" from "+TABLE_BEANS+" where "+FIELD_BEANS_NAMESPACE+"=?) adopted)", pNamespace, pNamespace)
+	if vUpdateError != nil {
+		return 0, diagnostic.NewError("Error while moving legacy beans into namespace %s", vUpdateError, pNamespace)
+	}
+	vAffected, vAffectedError := vResult.RowsAffected()
+	if vAffectedError != nil {
+		return 0, diagnostic.NewError("Error while moving legacy beans into namespace %s", vAffectedError, pNamespace)
+	}
+	return int(vAffected), nil
+}
+
+//ListBeanIds list the ids of the beans of a namespace, sorted by id
+//Parameters:
+// pNamespace = namespace of the beans (see GetBeanNamespace)
+// pPrefix = returns only ids beginning with the prefix, empty for all
+// pLimit = max number of ids returned, 0 for unlimited
+// pCursor = returns only ids following the cursor, empty to start from the first
+//Returns:
+// ids
+// cursor of the next page, empty if there are no more ids
+// error
+func (vSelf *DbHelper) ListBeanIds(pNamespace string, pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+	return vSelf.listBeanIds(vSelf.db, nil, pNamespace, pPrefix, pLimit, pCursor)
+}
+
+func (vSelf *DbHelper) listBeanIds(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, "", vInitError
+	}
+
+	vSelect := vSelf.selectOn(pExecutor, FIELD_BEANS_ID).From(TABLE_BEANS).Where(Eq(FIELD_BEANS_NAMESPACE, pNamespace)).Where(beansPrefixCondition(vSelf.GetDbType(), pPrefix)).Where(beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)).OrderBy(FIELD_BEANS_ID)
+	if pCursor != "" {
+		vSelect.Where(Gt(FIELD_BEANS_ID, pCursor))
+	}
+	if pLimit > 0 {
+		//one more row tells if there is a next page
+		vSelect.Limit(pLimit + 1)
+	}
+
+	vRows, vError := vSelect.Query()
+	if vError != nil {
+		return nil, "", vError
+	}
+	defer vRows.Close()
+
+	vIds := make([]string, 0)
+	for vRows.Next() {
+		var vCurId string
+		if vScanError := vRows.Scan(&vCurId); vScanError != nil {
+			return nil, "", diagnostic.NewError("Error while reading bean ids", vScanError)
+		}
+		vIds = append(vIds, vCurId)
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, "", diagnostic.NewError("Error while reading bean ids", vRowsError)
+	}
+
+	if pLimit <= 0 || len(vIds) <= pLimit {
+		return vIds, "", nil
+	}
+	return vIds[:pLimit], vIds[pLimit-1], nil
+}
+
+//IterateBeans returns an iterator over the beans of a namespace, sorted by id.
+//The iterator holds a connection until it's closed, use persistency.IterateBeansOf to unmarshal beans of a given type
+//Parameters:
+// pNamespace = namespace of the beans (see GetBeanNamespace)
+// pPrefix = iterates only ids beginning with the prefix, empty for all
+func (vSelf *DbHelper) IterateBeans(pNamespace string, pPrefix string) (*persistency.BeanIterator, error) {
+	return vSelf.iterateBeans(vSelf.db, nil, pNamespace, pPrefix)
+}
+
+func (vSelf *DbHelper) iterateBeans(pExecutor SqlExecutor, pTransaction *DbHelperTx, pNamespace string, pPrefix string) (*persistency.BeanIterator, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_ID, FIELD_BEANS_SERIALIZED).From(TABLE_BEANS).Where(Eq(FIELD_BEANS_NAMESPACE, pNamespace)).Where(beansPrefixCondition(vSelf.GetDbType(), pPrefix)).Where(beansNotExpiredCondition(FIELD_BEANS_EXPIRES_AT)).OrderBy(FIELD_BEANS_ID).Query()
+	if vError != nil {
+		return nil, vError
+	}
+
+	return newBeanRowsIterator(vRows), nil
+}
+
+//newBeanRowsIterator returns an iterator over the rows of a query selecting id and serialized bean
+func newBeanRowsIterator(pRows *DbHelperRows) *persistency.BeanIterator {
+	return persistency.NewBeanIterator(func() (string, []byte, bool, error) {
+		if pRows.Next() == false {
+			if vRowsError := pRows.Err(); vRowsError != nil {
+				return "", nil, false, diagnostic.NewError("Error while reading beans", vRowsError)
+			}
+			return "", nil, false, nil
+		}
+		var vId string
+		var vData []byte
+		if vScanError := pRows.Scan(&vId, &vData); vScanError != nil {
+			return "", nil, false, diagnostic.NewError("Error while reading beans", vScanError)
+		}
+		return vId, vData, true, nil
+	}, pRows.Close)
+}
+
+//beansPrefixCondition selects the ids beginning with a prefix.
+//On sqlite a range is used instead of like because sqlite like ignores case
+func beansPrefixCondition(pDbType DbType, pPrefix string) Condition {
+
+	if pPrefix == "" {
+		return Expr("1=1")
+	}
+	if pDbType == DbType_mysql {
+		return StartsWith(FIELD_BEANS_ID, pPrefix)
+	}
+
+	vUpperBound := []byte(pPrefix)
+	for len(vUpperBound) > 0 && vUpperBound[len(vUpperBound)-1] == 0xff {
+		vUpperBound = vUpperBound[:len(vUpperBound)-1]
+	}
+	if len(vUpperBound) == 0 {
+		return Ge(FIELD_BEANS_ID, pPrefix)
+	}
+	vUpperBound[len(vUpperBound)-1]++
+	return And(Ge(FIELD_BEANS_ID, pPrefix), Lt(FIELD_BEANS_ID, string(vUpperBound)))
+}
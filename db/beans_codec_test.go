@@ -0,0 +1,101 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+func TestSqlite3BeanCodecs(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beancodecs")
+
+	vDbHelper.SaveBean(&testIndexedBean{Id: "json", Status: "open"})
+
+	vCodec, _ := persistency.GetCodec("gob+gzip")
+	if vCodecError := vDbHelper.SetBeanCodec(vCodec); vCodecError != nil {
+		pTest.Fatal("failed to set codec", vCodecError)
+	}
+	if vIndexError := vDbHelper.AddBeanIndex(BeanIndex{Name: "jsonstatus", Namespace: GetBeanNamespace(&testIndexedBean{}), JsonPath: "Status", Mode: BeanIndexMode_Json}); vIndexError == nil {
+		pTest.Error("json index accepted with codec gob+gzip")
+	}
+	if vIndexError := vDbHelper.AddBeanIndex(BeanIndex{Name: "status", Namespace: GetBeanNamespace(&testIndexedBean{}), JsonPath: "Status"}); vIndexError != nil {
+		pTest.Fatal("failed to add index", vIndexError)
+	}
+	if vDbHelper.GetBeanIndex("status").Mode != BeanIndexMode_SideTable {
+		pTest.Errorf("expected side table index, got %s", vDbHelper.GetBeanIndex("status").Mode)
+	}
+
+	vDbHelper.SaveBean(&testIndexedBean{Id: "gob", Status: "open"})
+
+	for _, vCurId := range []string{"json", "gob"} {
+		vLoaded := &testIndexedBean{Id: vCurId}
+		if vLoadError := vDbHelper.LoadBean(vLoaded); vLoadError != nil || vLoaded.Status != "open" {
+			pTest.Errorf("failed to load bean %s: %v", vCurId, vLoadError)
+		}
+	}
+
+	if vIds, _ := vDbHelper.FindBeanIds("status", "open"); len(vIds) != 2 {
+		pTest.Errorf("unexpected indexed beans %v", vIds)
+	}
+
+	var vData []byte
+	vDbHelper.GetDb().QueryRow("select "+FIELD_BEANS_SERIALIZED+" from "+TABLE_BEANS+" where "+FIELD_BEANS_ID+"=?", "gob").Scan(&vData)
+	if vCodecName, _ := persistency.GetBeanCodecName(vData); vCodecName != "gob+gzip" {
+		pTest.Errorf("unexpected codec %s", vCodecName)
+	}
+
+	vIterator, _ := vDbHelper.IterateBeans(GetBeanNamespace(&testIndexedBean{}), "")
+	vBeans := persistency.IterateBeansOf[testIndexedBean](vIterator)
+	vCount := 0
+	for vBeans.Next() {
+		vCount++
+	}
+	vBeans.Close()
+	if vCount != 2 || vBeans.GetError() != nil {
+		pTest.Errorf("unexpected iteration %d %v", vCount, vBeans.GetError())
+	}
+}
+
+func TestSqlite3BeansRewrap(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beansrewrap")
+	vDbHelper.EnableBeanHistory(GetBeanNamespace(&testBean{}))
+
+	vKeyRing := persistency.NewEncryptionKeyRing()
+	vKeyRing.AddKey("old", []byte("0123456789abcdef0123456789abcdef"))
+	vKeyRing.AddKey("new", []byte("fedcba9876543210fedcba9876543210"))
+	persistency.SetDefaultEncryptionKeyRing(vKeyRing)
+	defer persistency.SetDefaultEncryptionKeyRing(nil)
+
+	vDbHelper.SetBeanCodec(persistency.NewEncryptedCodec(persistency.JsonCodec{}, nil))
+	for _, vCurValue := range []string{"first", "second"} {
+		if vSaveError := vDbHelper.SaveBean(&testBean{Id: "secret", Value: vCurValue}); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+	vDbHelper.SaveBean(&testIndexedBean{Id: "secret2"})
+
+	vKeyRing.SetCurrentKey("new")
+	//the bean and its previous content in the history
+	vCount, vRewrapError := vDbHelper.RewrapBeans(nil)
+	if vRewrapError != nil || vCount != 3 {
+		pTest.Errorf("unexpected rewrap result %d %v", vCount, vRewrapError)
+	}
+	if vCount, _ = vDbHelper.RewrapBeans(nil); vCount != 0 {
+		pTest.Errorf("beans rewrapped twice")
+	}
+
+	vNewOnly := persistency.NewEncryptionKeyRing()
+	vNewOnly.AddKey("new", []byte("fedcba9876543210fedcba9876543210"))
+	persistency.SetDefaultEncryptionKeyRing(vNewOnly)
+
+	vLoaded := &testBean{Id: "secret"}
+	if vLoadError := vDbHelper.LoadBean(vLoaded); vLoadError != nil || vLoaded.Value != "second" {
+		pTest.Errorf("failed to load rewrapped bean %v", vLoadError)
+	}
+	vRevisions, _ := vDbHelper.ListBeanRevisions(vLoaded)
+	if vLoadError := vDbHelper.LoadBeanRevision(vLoaded, vRevisions[0].Revision); vLoadError != nil || vLoaded.Value != "first" {
+		pTest.Errorf("failed to load rewrapped revision %v", vLoadError)
+	}
+}
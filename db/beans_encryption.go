@@ -0,0 +1,164 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+const (
+	beans_RewrapBatchSize = 500
+)
+
+//beanRewrap a serialized bean encrypted again
+type beanRewrap struct {
+	key       []interface{}
+	previous  []byte
+	rewrapped []byte
+}
+
+//RewrapBeans encrypts again with the current key the beans and their history encrypted with other keys.
+//Rows are processed in batches, each batch is updated in a dedicated transaction. Rows saved again meanwhile are skipped
+//Parameters:
+// pKeyRing = keys, nil for the default key ring (see persistency.SetDefaultEncryptionKeyRing)
+//Returns:
+// number of rewrapped rows of beans and history
+// error
+func (vSelf *DbHelper) RewrapBeans(pKeyRing *persistency.EncryptionKeyRing) (int64, error) {
+
+	vInitError := vSelf.initBeans(vSelf.db, nil)
+	if vInitError != nil {
+		return 0, vInitError
+	}
+
+	vBeansCount, vBeansError := vSelf.rewrapBeansTable(pKeyRing, TABLE_BEANS, []string{FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID})
+	if vBeansError != nil {
+		return vBeansCount, vBeansError
+	}
+	vHistoryCount, vHistoryError := vSelf.rewrapBeansTable(pKeyRing, TABLE_BEANS_HISTORY, []string{FIELD_BEANS_HISTORY_REVISION})
+	return vBeansCount + vHistoryCount, vHistoryError
+}
+
+//rewrapBeansTable rewraps the serialized column of a table
+//Parameters:
+// pKeyFields = primary key of the table, rows are read in its order
+func (vSelf *DbHelper) rewrapBeansTable(pKeyRing *persistency.EncryptionKeyRing, pTable string, pKeyFields []string) (int64, error) {
+
+	vRis := int64(0)
+	var vLastKey []interface{}
+	for {
+		vRewraps, vNextKey, vReadError := vSelf.readBeansToRewrap(pKeyRing, pTable, pKeyFields, vLastKey)
+		if vReadError != nil {
+			return vRis, vReadError
+		}
+		if vNextKey == nil {
+			return vRis, nil
+		}
+		vLastKey = vNextKey
+
+		if len(vRewraps) == 0 {
+			continue
+		}
+
+		var vUpdated int64
+		vUpdateError := vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+			vUpdated = 0
+			for _, vCurRewrap := range vRewraps {
+				vKeyConditions := make([]Condition, 0, len(pKeyFields)+1)
+				for vCnt, vCurField := range pKeyFields {
+					vKeyConditions = append(vKeyConditions, Eq(vCurField, vCurRewrap.key[vCnt]))
+				}
+				vKeyConditions = append(vKeyConditions, Eq(FIELD_BEANS_SERIALIZED, vCurRewrap.previous))
+
+				vUpdate := NewUpdate(vSelf.GetDbType(), pTable).Set(FIELD_BEANS_SERIALIZED, vCurRewrap.rewrapped)
+				if pTable == TABLE_BEANS {
+					vHash := sha256.Sum256(vCurRewrap.rewrapped)
+					vUpdate.Set(FIELD_BEANS_CONTENT_HASH, hex.EncodeToString(vHash[:]))
+				}
+				vResult, vExecError := execBuilt(pTx.tx, vUpdate.Where(And(vKeyConditions...)).Build)
+				if vExecError != nil {
+					return diagnostic.NewError("Error while rewrapping %s %v", vExecError, pTable, vCurRewrap.key)
+				}
+				if vAffected, vAffectedError := vResult.RowsAffected(); vAffectedError == nil {
+					vUpdated += vAffected
+				}
+			}
+			return nil
+		})
+		if vUpdateError != nil {
+			return vRis, vUpdateError
+		}
+		vRis += vUpdated
+	}
+}
+
+//readBeansToRewrap reads a batch of rows following pLastKey and rewraps them in memory.
+//Rows are read before updating them, mysql doesn't allow statements while a result set is open
+//Returns:
+// rows to update
+// key of the last row read, nil if there are no more rows
+// error
+func (vSelf *DbHelper) readBeansToRewrap(pKeyRing *persistency.EncryptionKeyRing, pTable string, pKeyFields []string, pLastKey []interface{}) ([]beanRewrap, []interface{}, error) {
+
+	vSelect := vSelf.selectOn(vSelf.db, append(append([]string{}, pKeyFields...), FIELD_BEANS_SERIALIZED)...).From(pTable).Limit(beans_RewrapBatchSize)
+	for _, vCurField := range pKeyFields {
+		vSelect.OrderBy(vCurField)
+	}
+	if pLastKey != nil {
+		vSelect.Where(keyFollowingCondition(pKeyFields, pLastKey))
+	}
+
+	vRows, vError := vSelect.Query()
+	if vError != nil {
+		return nil, nil, vError
+	}
+	defer vRows.Close()
+
+	vRis := make([]beanRewrap, 0)
+	var vLastKey []interface{}
+	for vRows.Next() {
+		vKeyValues := make([]interface{}, len(pKeyFields))
+		vScanTargets := make([]interface{}, len(pKeyFields)+1)
+		for vCnt := range pKeyFields {
+			vScanTargets[vCnt] = &vKeyValues[vCnt]
+		}
+		var vData []byte
+		vScanTargets[len(pKeyFields)] = &vData
+		if vScanError := vRows.Scan(vScanTargets...); vScanError != nil {
+			return nil, nil, diagnostic.NewError("Error while reading %s", vScanError, pTable)
+		}
+		for vCnt, vCurValue := range vKeyValues {
+			//drivers may return text columns as bytes
+			if vBytes, vIsBytes := vCurValue.([]byte); vIsBytes {
+				vKeyValues[vCnt] = string(vBytes)
+			}
+		}
+		vLastKey = vKeyValues
+
+		if vData == nil {
+			continue
+		}
+		vRewrapped, vChanged, vRewrapError := persistency.RewrapBeanData(vData, pKeyRing)
+		if vRewrapError != nil {
+			return nil, nil, diagnostic.NewError("Error while rewrapping %s %v", vRewrapError, pTable, vKeyValues)
+		}
+		if vChanged {
+			vRis = append(vRis, beanRewrap{key: vKeyValues, previous: vData, rewrapped: vRewrapped})
+		}
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, nil, diagnostic.NewError("Error while reading %s", vRowsError, pTable)
+	}
+	return vRis, vLastKey, nil
+}
+
+//keyFollowingCondition selects the rows whose key follows the given one in the order of the key fields
+func keyFollowingCondition(pKeyFields []string, pKey []interface{}) Condition {
+	vRis := Gt(pKeyFields[len(pKeyFields)-1], pKey[len(pKeyFields)-1])
+	for vCnt := len(pKeyFields) - 2; vCnt >= 0; vCnt-- {
+		vRis = Or(Gt(pKeyFields[vCnt], pKey[vCnt]), And(Eq(pKeyFields[vCnt], pKey[vCnt]), vRis))
+	}
+	return vRis
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	BeansPurge_DefaultBatchSize = 500
+)
+
+//SaveBeanWithTTL save a bean that expires after a time to live.
+//Expired beans are not returned by LoadBean, ExistsBean, listing and search functions, they are deleted by PurgeExpiredBeans.
+//SaveBean removes the expiry of a bean
+//Parameters:
+// pBean = bean to save
+// pTTL = time to live, 0 for beans that never expire
+func (vSelf *DbHelper) SaveBeanWithTTL(pBean IndentifiableInDb, pTTL time.Duration) error {
+	return vSelf.runBeanChange(GetBeanNamespace(pBean), func(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+		return vSelf.saveBean(pExecutor, pTransaction, pBean, pTTL)
+	})
+}
+
+//beansExpiresAt returns the value of the expiry column, null if the bean never expires
+func beansExpiresAt(pNow time.Time, pTTL time.Duration) sql.NullInt64 {
+	if pTTL <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: pNow.Add(pTTL).UnixMilli(), Valid: true}
+}
+
+//beansNotExpiredCondition selects the beans without expiry or not yet expired
+//Parameters:
+// pColumn = expiry column, qualified when the beans table is joined
+func beansNotExpiredCondition(pColumn string) Condition {
+	return Or(IsNull(pColumn), Gt(pColumn, time.Now().UnixMilli()))
+}
+
+//PurgeExpiredBeans delete the expired beans, each batch is deleted in a dedicated transaction.
+//Side table indexes and history are maintained as by DeleteBean
+//Parameters:
+// pBatchSize = beans deleted by each transaction, BeansPurge_DefaultBatchSize if lower than 1
+//Returns:
+// number of deleted beans
+// error
+func (vSelf *DbHelper) PurgeExpiredBeans(pBatchSize int) (int64, error) {
+
+	vInitError := vSelf.initBeans(vSelf.db, nil)
+	if vInitError != nil {
+		return 0, vInitError
+	}
+
+	if pBatchSize < 1 {
+		pBatchSize = BeansPurge_DefaultBatchSize
+	}
+
+	vRis := int64(0)
+	for {
+		vNow := time.Now().UnixMilli()
+		vKeys, vKeysError := vSelf.readExpiredBeanKeys(vNow, pBatchSize)
+		if vKeysError != nil {
+			return vRis, vKeysError
+		}
+		if len(vKeys) == 0 {
+			return vRis, nil
+		}
+
+		var vDeleted int64
+		vPurgeError := vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+			vDeleted = 0
+			for _, vCurKey := range vKeys {
+				vCurDeleted, vCurError := vSelf.purgeExpiredBean(pTx, vCurKey[0], vCurKey[1], vNow)
+				if vCurError != nil {
+					return vCurError
+				}
+				if vCurDeleted {
+					vDeleted++
+				}
+			}
+			return nil
+		})
+		if vPurgeError != nil {
+			return vRis, diagnostic.NewError("Error while purging expired beans", vPurgeError)
+		}
+		vRis += vDeleted
+
+		if len(vKeys) < pBatchSize {
+			return vRis, nil
+		}
+	}
+}
+
+//readExpiredBeanKeys returns namespace and id of a batch of expired beans.
+//Rows are read before deleting them, mysql doesn't allow statements while a result set is open
+func (vSelf *DbHelper) readExpiredBeanKeys(pNow int64, pLimit int) ([][2]string, error) {
+
+	vRows, vError := vSelf.selectOn(vSelf.db, FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID).From(TABLE_BEANS).Where(Le(FIELD_BEANS_EXPIRES_AT, pNow)).OrderBy(FIELD_BEANS_EXPIRES_AT).Limit(pLimit).Query()
+	if vError != nil {
+		return nil, vError
+	}
+	defer vRows.Close()
+
+	vRis := make([][2]string, 0)
+	for vRows.Next() {
+		var vCurKey [2]string
+		if vScanError := vRows.Scan(&vCurKey[0], &vCurKey[1]); vScanError != nil {
+			return nil, diagnostic.NewError("Error while reading expired beans", vScanError)
+		}
+		vRis = append(vRis, vCurKey)
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, diagnostic.NewError("Error while reading expired beans", vRowsError)
+	}
+	return vRis, nil
+}
+
+//purgeExpiredBean delete a bean if it's still expired, it may have been saved again in the meantime
+func (vSelf *DbHelper) purgeExpiredBean(pTx *DbHelperTx, pNamespace string, pId string, pNow int64) (bool, error) {
+
+	vHistoryEntry, vHistoryError := vSelf.readBeanHistoryEntry(pTx.tx, pNamespace, pId)
+	if vHistoryError != nil {
+		return false, vHistoryError
+	}
+
+	vDelete := NewDelete(vSelf.GetDbType(), TABLE_BEANS).Where(And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId), Le(FIELD_BEANS_EXPIRES_AT, pNow)))
+	vResult, vDeleteError := execBuilt(pTx.tx, vDelete.Build)
+	if vDeleteError != nil {
+		return false, diagnostic.NewError("Error while deleting expired bean %s", vDeleteError, pId)
+	}
+	vAffected, vAffectedError := vResult.RowsAffected()
+	if vAffectedError != nil {
+		return false, diagnostic.NewError("Error while deleting expired bean %s", vAffectedError, pId)
+	}
+	if vAffected == 0 {
+		return false, nil
+	}
+
+	if vIndexError := vSelf.deleteBeanIndexes(pTx.tx, pNamespace, pId); vIndexError != nil {
+		return false, vIndexError
+	}
+	return true, vSelf.writeBeanHistory(pTx.tx, pTx, vHistoryEntry, true)
+}
+
+//BeansPurger purges periodically the expired beans, see StartBeansPurge
+type BeansPurger struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+//StartBeansPurge starts a goroutine calling PurgeExpiredBeans periodically, errors are logged.
+//Stop the purger before closing the DbHelper
+//Parameters:
+// pInterval = time between two purges
+// pBatchSize = see PurgeExpiredBeans
+func (vSelf *DbHelper) StartBeansPurge(pInterval time.Duration, pBatchSize int) *BeansPurger {
+
+	vRis := &BeansPurger{stop: make(chan struct{}), done: make(chan struct{})}
+
+	go func() {
+		defer close(vRis.done)
+		vTicker := time.NewTicker(pInterval)
+		defer vTicker.Stop()
+		for {
+			select {
+			case <-vRis.stop:
+				return
+			case <-vTicker.C:
+				vDeleted, vPurgeError := vSelf.PurgeExpiredBeans(pBatchSize)
+				if vPurgeError != nil {
+					diagnostic.LogWarning("DbHelper.StartBeansPurge", "failed to purge expired beans", vPurgeError)
+				} else if vDeleted > 0 {
+					diagnostic.LogDebug("DbHelper.StartBeansPurge", "purged %d expired beans", vDeleted)
+				}
+			}
+		}
+	}()
+
+	return vRis
+}
+
+//Stop the purger and wait for the completion of the running purge, it's safe to call it more than once
+func (vSelf *BeansPurger) Stop() {
+	select {
+	case <-vSelf.stop:
+	default:
+		close(vSelf.stop)
+	}
+	<-vSelf.done
+}
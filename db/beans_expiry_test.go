@@ -0,0 +1,77 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+func TestSqlite3BeanExpiry(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanexpiry")
+
+	if vSaveError := vDbHelper.SaveBeanWithTTL(&testBean{Id: "short", Value: "a"}, time.Millisecond); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vSaveError := vDbHelper.SaveBeanWithTTL(&testBean{Id: "long", Value: "b"}, time.Hour); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	vDbHelper.SaveBean(&testBean{Id: "forever", Value: "c"})
+	time.Sleep(10 * time.Millisecond)
+
+	if vLoadError := vDbHelper.LoadBean(&testBean{Id: "short"}); persistency.IsBeanNotFound(vLoadError) == false {
+		pTest.Errorf("expected expired bean not found, got %v", vLoadError)
+	}
+	if vExists, _ := vDbHelper.ExistsBean(&testBean{Id: "short"}); vExists {
+		pTest.Error("expired bean exists")
+	}
+	vLong := &testBean{Id: "long"}
+	if vLoadError := vDbHelper.LoadBean(vLong); vLoadError != nil || vLong.Value != "b" {
+		pTest.Errorf("failed to load bean not expired %v", vLoadError)
+	}
+	if vMetadata, _ := vDbHelper.GetBeanMetadata(vLong); vMetadata == nil || vMetadata.ExpiresAt.After(time.Now()) == false {
+		pTest.Errorf("unexpected metadata %v", vMetadata)
+	}
+	if vIds, _, _ := vDbHelper.ListBeanIds(GetBeanNamespace(vLong), "", 0, ""); len(vIds) != 2 {
+		pTest.Errorf("unexpected ids %v", vIds)
+	}
+
+	//saving again removes the expiry
+	vDbHelper.SaveBeanWithTTL(&testBean{Id: "again", Value: "d"}, time.Millisecond)
+	vDbHelper.SaveBean(&testBean{Id: "again", Value: "d"})
+	time.Sleep(10 * time.Millisecond)
+	if vExists, _ := vDbHelper.ExistsBean(&testBean{Id: "again"}); vExists == false {
+		pTest.Error("bean saved without ttl expired")
+	}
+
+	vDeleted, vPurgeError := vDbHelper.PurgeExpiredBeans(0)
+	if vPurgeError != nil || vDeleted != 1 {
+		pTest.Errorf("unexpected purge result %d %v", vDeleted, vPurgeError)
+	}
+	if vCount := countRows(pTest, vDbHelper, TABLE_BEANS); vCount != 3 {
+		pTest.Errorf("expected 3 beans after purge, got %d", vCount)
+	}
+}
+
+func TestSqlite3BeansPurge(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanspurge")
+
+	for vCnt := 0; vCnt < 25; vCnt++ {
+		vDbHelper.SaveBeanWithTTL(&testBean{Id: "bean" + strconv.Itoa(vCnt)}, time.Millisecond)
+	}
+	vDbHelper.SaveBean(&testBean{Id: "forever"})
+
+	vPurger := vDbHelper.StartBeansPurge(10*time.Millisecond, 10)
+	for vWait := 0; vWait < 100 && countRows(pTest, vDbHelper, TABLE_BEANS) > 1; vWait++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	vPurger.Stop()
+	vPurger.Stop()
+
+	if vCount := countRows(pTest, vDbHelper, TABLE_BEANS); vCount != 1 {
+		pTest.Errorf("expected 1 bean after purge, got %d", vCount)
+	}
+}
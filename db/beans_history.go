@@ -0,0 +1,312 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+const (
+	BeanOperation_Create = "create"
+	BeanOperation_Update = "update"
+	BeanOperation_Delete = "delete"
+)
+
+//BeanRevision a change of a bean recorded in the history.
+//The revision holds the content of the bean before the change, nothing for creations
+type BeanRevision struct {
+	Revision  int64
+	Namespace string
+	Id        string
+	//Operation one of BeanOperation_Create, BeanOperation_Update, BeanOperation_Delete
+	Operation string
+	//Actor who made the change, see DbHelperTx.SetActor
+	Actor     string
+	ChangedAt time.Time
+}
+
+//beanHistoryEntry content of a bean read before changing it
+type beanHistoryEntry struct {
+	namespace string
+	id        string
+	existed   bool
+	previous  []byte
+}
+
+//EnableBeanHistory records the changes of the beans of a namespace: each SaveBean and DeleteBean writes the previous content into TABLE_BEANS_HISTORY.
+//Outside a transaction the change and its history are written in a new transaction.
+//The setting is not persisted, every process saving beans of the namespace must enable it
+//Parameters:
+// pNamespace = namespace of the beans (see GetBeanNamespace)
+func (vSelf *DbHelper) EnableBeanHistory(pNamespace string) error {
+
+	vInitError := vSelf.initBeans(vSelf.db, nil)
+	if vInitError != nil {
+		return vInitError
+	}
+
+	vSelf.beanHistoryLock.Lock()
+	defer vSelf.beanHistoryLock.Unlock()
+	if vSelf.beanHistory == nil {
+		vSelf.beanHistory = make(map[string]bool)
+	}
+	vSelf.beanHistory[pNamespace] = true
+	return nil
+}
+
+//IsBeanHistoryEnabled returns true if the changes of the beans of a namespace are recorded
+func (vSelf *DbHelper) IsBeanHistoryEnabled(pNamespace string) bool {
+	vSelf.beanHistoryLock.RLock()
+	defer vSelf.beanHistoryLock.RUnlock()
+	return vSelf.beanHistory[pNamespace]
+}
+
+//SaveBeanAs save a bean recording the actor in its history
+func (vSelf *DbHelper) SaveBeanAs(pBean IndentifiableInDb, pActor string) error {
+	return vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+		pTx.SetActor(pActor)
+		return pTx.SaveBean(pBean)
+	})
+}
+
+//DeleteBeanAs delete a bean recording the actor in its history
+func (vSelf *DbHelper) DeleteBeanAs(pBean IndentifiableInDb, pActor string) error {
+	return vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+		pTx.SetActor(pActor)
+		return pTx.DeleteBean(pBean)
+	})
+}
+
+//readBeanHistoryEntry reads the current content of a bean before changing it
+//Returns:
+// nil if history of the namespace is not enabled
+func (vSelf *DbHelper) readBeanHistoryEntry(pExecutor SqlExecutor, pNamespace string, pId string) (*beanHistoryEntry, error) {
+
+	if vSelf.IsBeanHistoryEnabled(pNamespace) == false {
+		return nil, nil
+	}
+	return vSelf.readBeanContent(pExecutor, pNamespace, pId)
+}
+
+//readBeanContent reads the stored content of a bean, previous is nil if the bean doesn't exist
+func (vSelf *DbHelper) readBeanContent(pExecutor SqlExecutor, pNamespace string, pId string) (*beanHistoryEntry, error) {
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_SERIALIZED).From(TABLE_BEANS).Where(beansKeyCondition(pNamespace, pId)).Query()
+	if vError != nil {
+		return nil, diagnostic.NewError("Error while reading history of bean %s", vError, pId)
+	}
+	defer vRows.Close()
+
+	vRis := &beanHistoryEntry{namespace: pNamespace, id: pId}
+	if vRows.Next() {
+		vScanError := vRows.Scan(&vRis.previous)
+		if vScanError != nil {
+			return nil, diagnostic.NewError("Error while reading history of bean %s", vScanError, pId)
+		}
+		vRis.existed = true
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, diagnostic.NewError("Error while reading history of bean %s", vRowsError, pId)
+	}
+	return vRis, nil
+}
+
+//writeBeanHistory records a change read by readBeanHistoryEntry
+func (vSelf *DbHelper) writeBeanHistory(pExecutor SqlExecutor, pTransaction *DbHelperTx, pEntry *beanHistoryEntry, pDeleted bool) error {
+
+	if pEntry == nil {
+		return nil
+	}
+
+	vOperation := BeanOperation_Update
+	switch {
+	case pDeleted:
+		vOperation = BeanOperation_Delete
+	case pEntry.existed == false:
+		vOperation = BeanOperation_Create
+	}
+
+	var vActor string
+	if pTransaction != nil {
+		vActor = pTransaction.GetActor()
+	}
+
+	vInsert, vInsertError := vSelf.createInsert(pExecutor, pTransaction, TABLE_BEANS_HISTORY, []string{FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID, FIELD_BEANS_HISTORY_OPERATION, FIELD_BEANS_HISTORY_ACTOR, FIELD_BEANS_HISTORY_CHANGED_AT, FIELD_BEANS_SERIALIZED}, InsertOptions{})
+	if vInsertError != nil {
+		return diagnostic.NewError("Error while creating history insert", vInsertError)
+	}
+	defer vInsert.Close()
+
+	_, vExecError := vInsert.Exec(pEntry.namespace, pEntry.id, vOperation, vActor, time.Now().Unix(), pEntry.previous)
+	if vExecError != nil {
+		return diagnostic.NewError("Error while writing history of bean %s", vExecError, pEntry.id)
+	}
+	return nil
+}
+
+//ListBeanRevisions list the recorded changes of a bean, newest first
+func (vSelf *DbHelper) ListBeanRevisions(pBean IndentifiableInDb) ([]BeanRevision, error) {
+	return vSelf.listBeanRevisions(vSelf.db, nil, pBean)
+}
+
+func (vSelf *DbHelper) listBeanRevisions(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb) ([]BeanRevision, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_HISTORY_REVISION, FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID, FIELD_BEANS_HISTORY_OPERATION, FIELD_BEANS_HISTORY_ACTOR, FIELD_BEANS_HISTORY_CHANGED_AT).From(TABLE_BEANS_HISTORY).Where(And(Eq(FIELD_BEANS_NAMESPACE, GetBeanNamespace(pBean)), Eq(FIELD_BEANS_ID, pBean.GetIdInDb()))).OrderByDesc(FIELD_BEANS_HISTORY_REVISION).Query()
+	if vError != nil {
+		return nil, vError
+	}
+	defer vRows.Close()
+
+	vRis := make([]BeanRevision, 0)
+	for vRows.Next() {
+		var vCurRevision BeanRevision
+		var vActor sql.NullString
+		var vChangedAt sql.NullInt64
+		vScanError := vRows.Scan(&vCurRevision.Revision, &vCurRevision.Namespace, &vCurRevision.Id, &vCurRevision.Operation, &vActor, &vChangedAt)
+		if vScanError != nil {
+			return nil, diagnostic.NewError("Error while reading revisions of bean %s", vScanError, pBean.GetIdInDb())
+		}
+		vCurRevision.Actor = vActor.String
+		vCurRevision.ChangedAt = time.Unix(vChangedAt.Int64, 0)
+		vRis = append(vRis, vCurRevision)
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, diagnostic.NewError("Error while reading revisions of bean %s", vRowsError, pBean.GetIdInDb())
+	}
+	return vRis, nil
+}
+
+//LoadBeanRevision load the content of a bean before a change
+//Parameters:
+// pBean = bean to fill, namespace and id select the history
+// pRevision = revision returned by ListBeanRevisions
+//Returns:
+// nil if succeeded, an error satisfying persistency.IsBeanNotFound if the revision doesn't exist or is a creation
+func (vSelf *DbHelper) LoadBeanRevision(pBean IndentifiableInDb, pRevision int64) error {
+	return vSelf.loadBeanRevision(vSelf.db, nil, pBean, pRevision)
+}
+
+func (vSelf *DbHelper) loadBeanRevision(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb, pRevision int64) error {
+
+	vData, vDataError := vSelf.readBeanRevision(pExecutor, pTransaction, pBean, pRevision)
+	if vDataError != nil {
+		return vDataError
+	}
+
+	vUnmarshalError := persistency.UnmarshalBean(vData, pBean)
+	if vUnmarshalError != nil {
+		return diagnostic.NewError("Error while unmarshalling revision %d of bean %s", vUnmarshalError, pRevision, pBean.GetIdInDb())
+	}
+	return nil
+}
+
+//DiffBeanRevisions compares two revisions of a bean at json level
+//Parameters:
+// pBean = namespace and id select the history
+// pFromRevision = previous revision, 0 for the stored bean
+// pToRevision = following revision, 0 for the stored bean
+func (vSelf *DbHelper) DiffBeanRevisions(pBean IndentifiableInDb, pFromRevision int64, pToRevision int64) ([]persistency.JsonDifference, error) {
+	return vSelf.diffBeanRevisions(vSelf.db, nil, pBean, pFromRevision, pToRevision)
+}
+
+func (vSelf *DbHelper) diffBeanRevisions(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb, pFromRevision int64, pToRevision int64) ([]persistency.JsonDifference, error) {
+
+	vRevisions := []int64{pFromRevision, pToRevision}
+	vData := make([][]byte, len(vRevisions))
+	for vCnt, vCurRevision := range vRevisions {
+		var vCurError error
+		if vCurRevision == 0 {
+			vCurError = vSelf.initBeans(pExecutor, pTransaction)
+			if vCurError == nil {
+				var vEntry *beanHistoryEntry
+				vEntry, vCurError = vSelf.readBeanContent(pExecutor, GetBeanNamespace(pBean), pBean.GetIdInDb())
+				if vCurError == nil {
+					vData[vCnt] = vEntry.previous
+				}
+			}
+		} else {
+			vData[vCnt], vCurError = vSelf.readBeanRevision(pExecutor, pTransaction, pBean, vCurRevision)
+			if persistency.IsBeanNotFound(vCurError) {
+				//the bean didn't exist before its creation
+				vCurError = nil
+			}
+		}
+		if vCurError == nil {
+			vData[vCnt], vCurError = beanRevisionJson(pBean, vData[vCnt])
+		}
+		if vCurError != nil {
+			return nil, vCurError
+		}
+	}
+
+	vRis, vDiffError := persistency.DiffJson(vData[0], vData[1])
+	if vDiffError != nil {
+		return nil, diagnostic.NewError("Error while comparing revisions of bean %s", vDiffError, pBean.GetIdInDb())
+	}
+	return vRis, nil
+}
+
+//beanRevisionJson converts a serialized bean to json, beans of other codecs are decoded as the type of pBean
+func beanRevisionJson(pBean interface{}, pData []byte) ([]byte, error) {
+
+	if vCodecName, vCodecError := persistency.GetBeanCodecName(pData); pData == nil || (vCodecError == nil && vCodecName == persistency.CodecName_Json) {
+		return pData, nil
+	}
+
+	vBeanType := reflect.TypeOf(pBean)
+	for vBeanType.Kind() == reflect.Ptr {
+		vBeanType = vBeanType.Elem()
+	}
+	vDecoded := reflect.New(vBeanType).Interface()
+	vUnmarshalError := persistency.UnmarshalBean(pData, vDecoded)
+	if vUnmarshalError != nil {
+		return nil, vUnmarshalError
+	}
+
+	vRis, vMarshalError := json.Marshal(vDecoded)
+	if vMarshalError != nil {
+		return nil, diagnostic.NewError("Error while marshalling bean to json", vMarshalError)
+	}
+	return vRis, nil
+}
+
+//readBeanRevision returns the content stored by a revision
+func (vSelf *DbHelper) readBeanRevision(pExecutor SqlExecutor, pTransaction *DbHelperTx, pBean IndentifiableInDb, pRevision int64) ([]byte, error) {
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vRows, vError := vSelf.selectOn(pExecutor, FIELD_BEANS_SERIALIZED).From(TABLE_BEANS_HISTORY).Where(And(Eq(FIELD_BEANS_HISTORY_REVISION, pRevision), Eq(FIELD_BEANS_NAMESPACE, GetBeanNamespace(pBean)), Eq(FIELD_BEANS_ID, pBean.GetIdInDb()))).Query()
+	if vError != nil {
+		return nil, vError
+	}
+	defer vRows.Close()
+
+	if vRows.Next() == false {
+		if vRowsError := vRows.Err(); vRowsError != nil {
+			return nil, diagnostic.NewError("Error while reading revision %d of bean %s", vRowsError, pRevision, pBean.GetIdInDb())
+		}
+		return nil, &persistency.BeanNotFoundError{BeanID: pBean.GetIdInDb()}
+	}
+
+	var vData []byte
+	vScanError := vRows.Scan(&vData)
+	if vScanError != nil {
+		return nil, diagnostic.NewError("Error while reading revision %d of bean %s", vScanError, pRevision, pBean.GetIdInDb())
+	}
+	if vData == nil {
+		return nil, &persistency.BeanNotFoundError{BeanID: pBean.GetIdInDb()}
+	}
+	return vData, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+func TestSqlite3BeanHistory(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanhistory")
+
+	if vEnableError := vDbHelper.EnableBeanHistory(GetBeanNamespace(&testBean{})); vEnableError != nil {
+		pTest.Fatal("failed to enable history", vEnableError)
+	}
+
+	vBean := &testBean{Id: "bean1", Value: "first"}
+	if vSaveError := vDbHelper.SaveBeanAs(vBean, "alice"); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	vBean.Value = "second"
+	if vSaveError := vDbHelper.SaveBean(vBean); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vDeleteError := vDbHelper.DeleteBeanAs(vBean, "bob"); vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	//beans of other namespaces are not recorded
+	vDbHelper.SaveBean(&testIndexedBean{Id: "bean1"})
+
+	vRevisions, vRevisionsError := vDbHelper.ListBeanRevisions(vBean)
+	if vRevisionsError != nil {
+		pTest.Fatal("failed to list revisions", vRevisionsError)
+	}
+	if len(vRevisions) != 3 {
+		pTest.Fatalf("expected 3 revisions, got %v", vRevisions)
+	}
+	if vRevisions[0].Operation != BeanOperation_Delete || vRevisions[0].Actor != "bob" || vRevisions[1].Operation != BeanOperation_Update || vRevisions[2].Operation != BeanOperation_Create || vRevisions[2].Actor != "alice" {
+		pTest.Errorf("unexpected revisions %v", vRevisions)
+	}
+	if vRevisions[0].Revision <= vRevisions[1].Revision {
+		pTest.Errorf("revisions not sorted newest first %v", vRevisions)
+	}
+	if vOtherRevisions, _ := vDbHelper.ListBeanRevisions(&testIndexedBean{Id: "bean1"}); len(vOtherRevisions) != 0 {
+		pTest.Errorf("unexpected revisions of another namespace %v", vOtherRevisions)
+	}
+
+	vLoaded := &testBean{Id: "bean1"}
+	if vLoadError := vDbHelper.LoadBeanRevision(vLoaded, vRevisions[0].Revision); vLoadError != nil || vLoaded.Value != "second" {
+		pTest.Errorf("unexpected content before delete %v %v", vLoaded, vLoadError)
+	}
+	if vLoadError := vDbHelper.LoadBeanRevision(vLoaded, vRevisions[2].Revision); persistency.IsBeanNotFound(vLoadError) == false {
+		pTest.Errorf("expected bean not found before creation, got %v", vLoadError)
+	}
+
+	vDifferences, vDiffError := vDbHelper.DiffBeanRevisions(vBean, vRevisions[1].Revision, vRevisions[0].Revision)
+	if vDiffError != nil {
+		pTest.Fatal("failed to diff revisions", vDiffError)
+	}
+	if len(vDifferences) != 1 || vDifferences[0].Path != "Value" || vDifferences[0].From != "first" || vDifferences[0].To != "second" {
+		pTest.Errorf("unexpected differences %v", vDifferences)
+	}
+
+	//the bean has been deleted, so the current content is empty
+	vDifferences, vDiffError = vDbHelper.DiffBeanRevisions(vBean, vRevisions[0].Revision, 0)
+	if vDiffError != nil || len(vDifferences) != 1 || vDifferences[0].Path != "" || vDifferences[0].To != nil {
+		pTest.Errorf("unexpected differences with deleted bean %v %v", vDifferences, vDiffError)
+	}
+}
+
+func TestSqlite3BeanHistoryRollback(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanhistoryrollback")
+	vDbHelper.EnableBeanHistory(GetBeanNamespace(&testBean{}))
+	if vInitError := vDbHelper.InitBeans(); vInitError != nil {
+		pTest.Fatal("failed to initialize beans", vInitError)
+	}
+
+	vBean := &testBean{Id: "bean1", Value: "first"}
+	vTransactionError := vDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		if vSaveError := pTx.SaveBean(vBean); vSaveError != nil {
+			return vSaveError
+		}
+		return diagnostic.NewError("discard changes", nil)
+	})
+	if vTransactionError == nil {
+		pTest.Fatal("transaction not rolled back")
+	}
+
+	if vRevisions, _ := vDbHelper.ListBeanRevisions(vBean); len(vRevisions) != 0 {
+		pTest.Errorf("history of a rolled back change %v", vRevisions)
+	}
+}
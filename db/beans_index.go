@@ -0,0 +1,458 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+const (
+	beans_IndexValueMaxLength = 255
+	beans_IndexColumnPrefix   = "bidx_"
+)
+
+var (
+	_BeanIndexNameRegexp     = regexp.MustCompile(`^[A-Za-z0-9_]{1,50}$`)
+	_BeanIndexPathPartRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+//BeanIndexMode implementation of a secondary index
+type BeanIndexMode string
+
+const (
+	//BeanIndexMode_Auto json functions if supported by the database, otherwise side table
+	BeanIndexMode_Auto BeanIndexMode = ""
+	//BeanIndexMode_Json an index on the json field: expression index on sqlite, generated column on mysql
+	BeanIndexMode_Json BeanIndexMode = "json"
+	//BeanIndexMode_SideTable values are copied into TABLE_BEANS_INDEX on each save
+	BeanIndexMode_SideTable BeanIndexMode = "sidetable"
+)
+
+//BeanIndex secondary index on a field of the beans of a namespace.
+//Only scalar values are indexed, as text of at most 255 characters: numbers and booleans are matched by their json text (ex. 3 and "3")
+type BeanIndex struct {
+	//Name of the index, letters, digits and underscores
+	Name string
+	//Namespace of the indexed beans (see GetBeanNamespace)
+	Namespace string
+	//JsonPath field of the marshalled bean, nested fields are separated by dots (ex. Address.City)
+	JsonPath string
+	Mode     BeanIndexMode
+}
+
+//AddBeanIndex declares a secondary index, maintained by SaveBean and DeleteBean and queried by FindBeans.
+//Indexes are not persisted, every process saving beans of the namespace must declare them.
+//A side table index is built when empty, see RebuildBeanIndex
+//Parameters:
+// pIndex = index definition
+func (vSelf *DbHelper) AddBeanIndex(pIndex BeanIndex) error {
+
+	if _BeanIndexNameRegexp.MatchString(pIndex.Name) == false {
+		return diagnostic.NewError("invalid bean index name %s", nil, pIndex.Name)
+	}
+	if pIndex.Namespace == "" {
+		return diagnostic.NewError("bean index %s without namespace", nil, pIndex.Name)
+	}
+	for _, vCurPart := range strings.Split(pIndex.JsonPath, ".") {
+		if _BeanIndexPathPartRegexp.MatchString(vCurPart) == false {
+			return diagnostic.NewError("invalid json path %s of bean index %s", nil, pIndex.JsonPath, pIndex.Name)
+		}
+	}
+
+	vInitError := vSelf.initBeans(vSelf.db, nil)
+	if vInitError != nil {
+		return vInitError
+	}
+
+	vJsonCodec := persistency.IsJsonCodec(vSelf.GetBeanCodec())
+	if pIndex.Mode == BeanIndexMode_Auto {
+		pIndex.Mode = BeanIndexMode_SideTable
+		if vJsonCodec && vSelf.supportsJson() {
+			pIndex.Mode = BeanIndexMode_Json
+		}
+	}
+	if pIndex.Mode == BeanIndexMode_Json && vJsonCodec == false {
+		return diagnostic.NewError("json bean index %s not supported by codec %s", nil, pIndex.Name, vSelf.GetBeanCodec().GetName())
+	}
+
+	switch pIndex.Mode {
+	case BeanIndexMode_Json:
+		vCreateError := vSelf.createJsonBeanIndex(&pIndex)
+		if vCreateError != nil {
+			return vCreateError
+		}
+	case BeanIndexMode_SideTable:
+	default:
+		return diagnostic.NewError("unknown bean index mode %s", nil, pIndex.Mode)
+	}
+
+	vSelf.beanIndexesLock.Lock()
+	if vSelf.beanIndexes == nil {
+		vSelf.beanIndexes = make(map[string]*BeanIndex)
+	}
+	vSelf.beanIndexes[pIndex.Name] = &pIndex
+	vSelf.beanIndexesLock.Unlock()
+
+	if pIndex.Mode == BeanIndexMode_SideTable {
+		var vCount int
+		vCountError := vSelf.db.QueryRow("select count(*) from "+TABLE_BEANS_INDEX+" where "+FIELD_BEANS_INDEX_NAME+"=?", pIndex.Name).Scan(&vCount)
+		if vCountError != nil {
+			return diagnostic.NewError("failed to check bean index %s", vCountError, pIndex.Name)
+		}
+		if vCount == 0 {
+			return vSelf.RebuildBeanIndex(pIndex.Name)
+		}
+	}
+	return nil
+}
+
+//GetBeanIndex returns a declared index, nil if not found
+func (vSelf *DbHelper) GetBeanIndex(pName string) *BeanIndex {
+	vSelf.beanIndexesLock.RLock()
+	defer vSelf.beanIndexesLock.RUnlock()
+	return vSelf.beanIndexes[pName]
+}
+
+//RebuildBeanIndex recompute the values of a side table index from the stored beans, json indexes are maintained by the database
+func (vSelf *DbHelper) RebuildBeanIndex(pName string) error {
+
+	vIndex := vSelf.GetBeanIndex(pName)
+	if vIndex == nil {
+		return diagnostic.NewError("unknown bean index %s", nil, pName)
+	}
+	if vIndex.Mode != BeanIndexMode_SideTable {
+		return nil
+	}
+
+	diagnostic.LogInfo("DbHelper.RebuildBeanIndex", "building bean index %s", pName)
+	return vSelf.inBeansTransaction(func(pTx *DbHelperTx) error {
+
+		_, vDeleteError := pTx.Exec("delete from "+TABLE_BEANS_INDEX+" where "+FIELD_BEANS_INDEX_NAME+"=?", pName)
+		if vDeleteError != nil {
+			return diagnostic.NewError("failed to clean bean index %s", vDeleteError, pName)
+		}
+
+		vIterator, vIteratorError := pTx.IterateBeans(vIndex.Namespace, "")
+		if vIteratorError != nil {
+			return vIteratorError
+		}
+
+		//values are collected before inserting them, mysql can't execute statements while reading rows on the same connection
+		vIds := make([]string, 0)
+		vValues := make([]string, 0)
+		for vIterator.Next() {
+			vJsonBean, vJsonError := persistency.BeanDataToJson(vIterator.GetData())
+			if vJsonError != nil {
+				diagnostic.LogWarning("DbHelper.RebuildBeanIndex", "bean %s not indexed", vJsonError, vIterator.GetId())
+				continue
+			}
+			vValue, vFound, vExtractError := extractBeanIndexValue(vJsonBean, vIndex.JsonPath)
+			if vExtractError != nil {
+				diagnostic.LogWarning("DbHelper.RebuildBeanIndex", "bean %s not indexed", vExtractError, vIterator.GetId())
+				continue
+			}
+			if vFound {
+				vIds = append(vIds, vIterator.GetId())
+				vValues = append(vValues, vValue)
+			}
+		}
+		vIterator.Close()
+		if vIterator.GetError() != nil {
+			return vIterator.GetError()
+		}
+
+		vInsert, vInsertError := pTx.CreateInsert(TABLE_BEANS_INDEX, []string{FIELD_BEANS_INDEX_NAME, FIELD_BEANS_NAMESPACE, FIELD_BEANS_ID, FIELD_BEANS_INDEX_VALUE}, InsertOptions{})
+		if vInsertError != nil {
+			return vInsertError
+		}
+		defer vInsert.Close()
+
+		for vCnt, vCurId := range vIds {
+			if _, vExecError := vInsert.Exec(pName, vIndex.Namespace, vCurId, vValues[vCnt]); vExecError != nil {
+				return diagnostic.NewError("failed to index bean %s", vExecError, vCurId)
+			}
+		}
+		return nil
+	})
+}
+
+//FindBeanIds returns the ids of the beans whose indexed field has the given value, sorted by id
+//Parameters:
+// pIndexName = name of a declared index
+// pValue = value of the indexed field
+func (vSelf *DbHelper) FindBeanIds(pIndexName string, pValue interface{}) ([]string, error) {
+	return vSelf.findBeanIds(vSelf.db, nil, pIndexName, pValue)
+}
+
+//FindBeans returns an iterator over the beans whose indexed field has the given value, sorted by id.
+//Use persistency.IterateBeansOf to unmarshal beans of a given type
+//Parameters:
+// pIndexName = name of a declared index
+// pValue = value of the indexed field
+func (vSelf *DbHelper) FindBeans(pIndexName string, pValue interface{}) (*persistency.BeanIterator, error) {
+	return vSelf.findBeans(vSelf.db, nil, pIndexName, pValue)
+}
+
+func (vSelf *DbHelper) findBeanIds(pExecutor SqlExecutor, pTransaction *DbHelperTx, pIndexName string, pValue interface{}) ([]string, error) {
+
+	vSelect, vSelectError := vSelf.selectBeansByIndex(pExecutor, pTransaction, pIndexName, pValue, qualifiedBeansColumn(FIELD_BEANS_ID))
+	if vSelectError != nil {
+		return nil, vSelectError
+	}
+
+	vRows, vError := vSelect.Query()
+	if vError != nil {
+		return nil, vError
+	}
+	defer vRows.Close()
+
+	vIds := make([]string, 0)
+	for vRows.Next() {
+		var vCurId string
+		if vScanError := vRows.Scan(&vCurId); vScanError != nil {
+			return nil, diagnostic.NewError("Error while reading bean ids", vScanError)
+		}
+		vIds = append(vIds, vCurId)
+	}
+	if vRowsError := vRows.Err(); vRowsError != nil {
+		return nil, diagnostic.NewError("Error while reading bean ids", vRowsError)
+	}
+	return vIds, nil
+}
+
+func (vSelf *DbHelper) findBeans(pExecutor SqlExecutor, pTransaction *DbHelperTx, pIndexName string, pValue interface{}) (*persistency.BeanIterator, error) {
+
+	vSelect, vSelectError := vSelf.selectBeansByIndex(pExecutor, pTransaction, pIndexName, pValue, qualifiedBeansColumn(FIELD_BEANS_ID), qualifiedBeansColumn(FIELD_BEANS_SERIALIZED))
+	if vSelectError != nil {
+		return nil, vSelectError
+	}
+
+	vRows, vError := vSelect.Query()
+	if vError != nil {
+		return nil, vError
+	}
+	return newBeanRowsIterator(vRows), nil
+}
+
+func qualifiedBeansColumn(pColumn string) string {
+	return TABLE_BEANS + "." + pColumn
+}
+
+//selectBeansByIndex builds the select of the beans whose indexed field has the given value
+func (vSelf *DbHelper) selectBeansByIndex(pExecutor SqlExecutor, pTransaction *DbHelperTx, pIndexName string, pValue interface{}, pColumns ...string) (*SelectBuilder, error) {
+
+	vIndex := vSelf.GetBeanIndex(pIndexName)
+	if vIndex == nil {
+		return nil, diagnostic.NewError("unknown bean index %s", nil, pIndexName)
+	}
+
+	vInitError := vSelf.initBeans(pExecutor, pTransaction)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	//every implementation compares the text of the values
+	vValue, vIsScalar := beanIndexValue(pValue)
+	if vIsScalar == false {
+		return nil, diagnostic.NewError("value of bean index %s must be a string, a number or a boolean", nil, pIndexName)
+	}
+
+	vSelect := vSelf.selectOn(pExecutor, pColumns...).From(TABLE_BEANS).Where(beansNotExpiredCondition(qualifiedBeansColumn(FIELD_BEANS_EXPIRES_AT))).OrderBy(qualifiedBeansColumn(FIELD_BEANS_ID))
+
+	if vIndex.Mode == BeanIndexMode_SideTable {
+		return vSelect.Join(TABLE_BEANS_INDEX, And(EqColumns(TABLE_BEANS_INDEX+"."+FIELD_BEANS_NAMESPACE, qualifiedBeansColumn(FIELD_BEANS_NAMESPACE)), EqColumns(TABLE_BEANS_INDEX+"."+FIELD_BEANS_ID, qualifiedBeansColumn(FIELD_BEANS_ID)))).
+			Where(Eq(TABLE_BEANS_INDEX+"."+FIELD_BEANS_INDEX_NAME, vIndex.Name)).
+			Where(Eq(TABLE_BEANS_INDEX+"."+FIELD_BEANS_NAMESPACE, vIndex.Namespace)).
+			Where(Eq(TABLE_BEANS_INDEX+"."+FIELD_BEANS_INDEX_VALUE, vValue)), nil
+	}
+
+	switch vSelf.GetDbType() {
+	case DbType_sqlite3:
+		//the namespace is a literal, otherwise sqlite can't use the partial index
+		return vSelect.Where(Expr(beansNamespaceLiteralCondition(vIndex.Namespace))).Where(Expr(jsonBeanIndexExpression(DbType_sqlite3, vIndex.JsonPath)+"=?", vValue)), nil
+	default:
+		return vSelect.Where(Eq(FIELD_BEANS_NAMESPACE, vIndex.Namespace)).Where(Eq(beans_IndexColumnPrefix+vIndex.Name, vValue)), nil
+	}
+}
+
+//hasSideTableBeanIndexes returns true if a side table index is declared on the namespace
+func (vSelf *DbHelper) hasSideTableBeanIndexes(pNamespace string) bool {
+	vSelf.beanIndexesLock.RLock()
+	defer vSelf.beanIndexesLock.RUnlock()
+	for _, vCurIndex := range vSelf.beanIndexes {
+		if vCurIndex.Mode == BeanIndexMode_SideTable && vCurIndex.Namespace == pNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+//updateBeanIndexes replaces the side table values of a saved bean
+//Parameters:
+// pBean = saved bean, marshalled again as json when the codec is not json
+// pMarshalledBean = serialized bean
+func (vSelf *DbHelper) updateBeanIndexes(pExecutor SqlExecutor, pNamespace string, pId string, pBean interface{}, pMarshalledBean []byte) error {
+
+	vSelf.beanIndexesLock.RLock()
+	vIndexes := make([]*BeanIndex, 0)
+	for _, vCurIndex := range vSelf.beanIndexes {
+		if vCurIndex.Mode == BeanIndexMode_SideTable && vCurIndex.Namespace == pNamespace {
+			vIndexes = append(vIndexes, vCurIndex)
+		}
+	}
+	vSelf.beanIndexesLock.RUnlock()
+
+	if len(vIndexes) == 0 {
+		return nil
+	}
+
+	vDeleteError := vSelf.deleteBeanIndexes(pExecutor, pNamespace, pId)
+	if vDeleteError != nil {
+		return vDeleteError
+	}
+
+	vJsonBean := pMarshalledBean
+	if vCodecName, _ := persistency.GetBeanCodecName(pMarshalledBean); vCodecName != persistency.CodecName_Json {
+		var vJsonError error
+		vJsonBean, vJsonError = json.Marshal(pBean)
+		if vJsonError != nil {
+			return diagnostic.NewError("failed to marshal bean %s to json", vJsonError, pId)
+		}
+	}
+
+	for _, vCurIndex := range vIndexes {
+		vValue, vFound, vExtractError := extractBeanIndexValue(vJsonBean, vCurIndex.JsonPath)
+		if vExtractError != nil {
+			return diagnostic.NewError("failed to extract value of bean index %s", vExtractError, vCurIndex.Name)
+		}
+		if vFound == false {
+			continue
+		}
+		_, vInsertError := pExecutor.Exec("insert into "+TABLE_BEANS_INDEX+" ("+FIELD_BEANS_INDEX_NAME+","+FIELD_BEANS_NAMESPACE+","+FIELD_BEANS_ID+","+FIELD_BEANS_INDEX_VALUE+") values (?,?,?,?)", vCurIndex.Name, pNamespace, pId, vValue)
+		if vInsertError != nil {
+			return diagnostic.NewError("failed to update bean index %s", vInsertError, vCurIndex.Name)
+		}
+	}
+	return nil
+}
+
+//deleteBeanIndexes removes the side table values of a bean
+func (vSelf *DbHelper) deleteBeanIndexes(pExecutor SqlExecutor, pNamespace string, pId string) error {
+	_, vDeleteError := execBuilt(pExecutor, NewDelete(vSelf.GetDbType(), TABLE_BEANS_INDEX).Where(And(Eq(FIELD_BEANS_NAMESPACE, pNamespace), Eq(FIELD_BEANS_ID, pId))).Build)
+	if vDeleteError != nil {
+		return diagnostic.NewError("failed to delete indexes of bean %s", vDeleteError, pId)
+	}
+	return nil
+}
+
+//supportsJson returns true if the database implements json functions
+func (vSelf *DbHelper) supportsJson() bool {
+	var vValue interface{}
+	return vSelf.db.QueryRow(`select json_extract('{"a":1}', '$.a')`).Scan(&vValue) == nil
+}
+
+//createJsonBeanIndex creates the database index: a partial expression index on sqlite, a generated column on mysql
+func (vSelf *DbHelper) createJsonBeanIndex(pIndex *BeanIndex) error {
+
+	vDbType := vSelf.GetDbType()
+	vIndexName := QuoteIdentifier(vDbType, TABLE_BEANS+"_idx_"+pIndex.Name)
+	var vDdl []string
+
+	switch vDbType {
+	case DbType_sqlite3:
+		vDdl = []string{"create index if not exists " + vIndexName + " on " + TABLE_BEANS + " (" + jsonBeanIndexExpression(vDbType, pIndex.JsonPath) + ") where " + beansNamespaceLiteralCondition(pIndex.Namespace)}
+	case DbType_mysql:
+		vColumn := beans_IndexColumnPrefix + pIndex.Name
+		var vCount int
+		vCountError := vSelf.db.QueryRow("select count(*) from information_schema.columns where table_schema=database() and table_name=? and column_name=?", TABLE_BEANS, vColumn).Scan(&vCount)
+		if vCountError != nil {
+			return diagnostic.NewError("failed to check bean index %s", vCountError, pIndex.Name)
+		}
+		if vCount > 0 {
+			return nil
+		}
+		vDdl = []string{"alter table " + TABLE_BEANS + " add column " + QuoteIdentifier(vDbType, vColumn) + " varchar(255) generated always as (" + jsonBeanIndexExpression(vDbType, pIndex.JsonPath) + ") virtual, add index " + vIndexName + " (" + FIELD_BEANS_NAMESPACE + "," + QuoteIdentifier(vDbType, vColumn) + ")"}
+	default:
+		return diagnostic.NewError("json bean indexes not supported for dbtype %s", nil, vDbType)
+	}
+
+	for _, vCurDdl := range vDdl {
+		_, vCreateError := vSelf.db.Exec(vCurDdl)
+		if vCreateError != nil {
+			return diagnostic.NewError("failed to create bean index %s", vCreateError, pIndex.Name)
+		}
+	}
+	return nil
+}
+
+//jsonBeanIndexExpression extracts the text of the indexed field like beanIndexValue,
+//serialized values that are not json (ex. encrypted beans), null, arrays and objects give null
+func jsonBeanIndexExpression(pDbType DbType, pJsonPath string) string {
+	vPath := "'$." + pJsonPath + "'"
+	if pDbType == DbType_mysql {
+		vSerialized := "convert(" + FIELD_BEANS_SERIALIZED + " using utf8mb4)"
+		vExtract := "json_extract(" + vSerialized + ", " + vPath + ")"
+		return "if(json_valid(" + vSerialized + ") and json_type(" + vExtract + ") not in ('NULL','OBJECT','ARRAY'), left(json_unquote(" + vExtract + "), 255), null)"
+	}
+	//json_extract returns typed values, numbers are taken as json text by ->
+	vSerialized := "cast(" + FIELD_BEANS_SERIALIZED + " as text)"
+	return "case when json_valid(" + vSerialized + ") then case json_type(" + vSerialized + ", " + vPath + ") when 'text' then substr(json_extract(" + vSerialized + ", " + vPath + "), 1, 255) when 'integer' then " + vSerialized + " -> " + vPath + " when 'real' then " + vSerialized + " -> " + vPath + " when 'true' then 'true' when 'false' then 'false' end end"
+}
+
+func beansNamespaceLiteralCondition(pNamespace string) string {
+	return FIELD_BEANS_NAMESPACE + "='" + strings.Replace(pNamespace, "'", "''", -1) + "'"
+}
+
+//extractBeanIndexValue returns the value of a field of a marshalled bean, false if missing or not scalar
+func extractBeanIndexValue(pMarshalledBean []byte, pJsonPath string) (string, bool, error) {
+
+	vDecoder := json.NewDecoder(bytes.NewReader(pMarshalledBean))
+	vDecoder.UseNumber()
+	var vCurrent interface{}
+	vDecodeError := vDecoder.Decode(&vCurrent)
+	if vDecodeError != nil {
+		return "", false, diagnostic.NewError("failed to decode bean", vDecodeError)
+	}
+
+	for _, vCurPart := range strings.Split(pJsonPath, ".") {
+		vObject, vIsObject := vCurrent.(map[string]interface{})
+		if vIsObject == false {
+			return "", false, nil
+		}
+		vCurrent = vObject[vCurPart]
+	}
+
+	vValue, vIsScalar := beanIndexValue(vCurrent)
+	return vValue, vIsScalar, nil
+}
+
+//beanIndexValue converts a scalar to the text stored in indexes, false for null, arrays and objects
+func beanIndexValue(pValue interface{}) (string, bool) {
+
+	var vRis string
+	switch vValue := pValue.(type) {
+	case nil:
+		return "", false
+	case string:
+		vRis = vValue
+	case json.Number:
+		vRis = vValue.String()
+	case map[string]interface{}, []interface{}:
+		return "", false
+	default:
+		vMarshalled, vMarshalError := json.Marshal(vValue)
+		if vMarshalError != nil {
+			return "", false
+		}
+		vRis = string(vMarshalled)
+	}
+
+	if vRunes := []rune(vRis); len(vRunes) > beans_IndexValueMaxLength {
+		vRis = string(vRunes[:beans_IndexValueMaxLength])
+	}
+	return vRis, true
+}
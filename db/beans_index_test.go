@@ -0,0 +1,98 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+type testIndexedBean struct {
+	Id      string
+	Status  string
+	Active  bool
+	Details struct {
+		Priority int
+	}
+}
+
+func (vSelf *testIndexedBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func TestSqlite3BeanIndexes(pTest *testing.T) {
+
+	for _, vCurMode := range []BeanIndexMode{BeanIndexMode_Json, BeanIndexMode_SideTable} {
+		pTest.Run(string(vCurMode), func(pTest *testing.T) {
+
+			vDbHelper := newSqlite3TestDbHelper(pTest, "beanindexes"+string(vCurMode))
+			vNamespace := GetBeanNamespace(&testIndexedBean{})
+
+			for vCnt := 0; vCnt < 10; vCnt++ {
+				vBean := &testIndexedBean{Id: "bean" + strconv.Itoa(vCnt), Status: "open"}
+				if vCnt%3 == 0 {
+					vBean.Status = "closed"
+				}
+				vBean.Active = vCnt < 4
+				vBean.Details.Priority = vCnt % 2
+				if vSaveError := vDbHelper.SaveBean(vBean); vSaveError != nil {
+					pTest.Fatal("failed to save bean", vSaveError)
+				}
+			}
+			//same id in a different namespace
+			vDbHelper.SaveBean(&testBean{Id: "bean1", Value: "open"})
+
+			for _, vCurIndex := range []BeanIndex{{Name: "status", Namespace: vNamespace, JsonPath: "Status", Mode: vCurMode}, {Name: "priority", Namespace: vNamespace, JsonPath: "Details.Priority", Mode: vCurMode}, {Name: "active", Namespace: vNamespace, JsonPath: "Active", Mode: vCurMode}} {
+				if vAddError := vDbHelper.AddBeanIndex(vCurIndex); vAddError != nil {
+					pTest.Fatal("failed to add index", vAddError)
+				}
+			}
+
+			vIds, vFindError := vDbHelper.FindBeanIds("status", "closed")
+			if vFindError != nil {
+				pTest.Fatal("failed to find beans", vFindError)
+			}
+			if len(vIds) != 4 || vIds[0] != "bean0" {
+				pTest.Errorf("unexpected closed beans %v", vIds)
+			}
+
+			vChanged := &testIndexedBean{Id: "bean1"}
+			vDbHelper.LoadBean(vChanged)
+			vChanged.Status = "closed"
+			vDbHelper.SaveBean(vChanged)
+			vDbHelper.DeleteBean(&testIndexedBean{Id: "bean0"})
+
+			vIterator, vIteratorError := vDbHelper.FindBeans("status", "closed")
+			if vIteratorError != nil {
+				pTest.Fatal("failed to find beans", vIteratorError)
+			}
+			vBeans := persistency.IterateBeansOf[testIndexedBean](vIterator)
+			vFound := []string{}
+			for vBeans.Next() {
+				vFound = append(vFound, vBeans.GetBean().Id)
+			}
+			vBeans.Close()
+			if len(vFound) != 4 || vFound[0] != "bean1" {
+				pTest.Errorf("unexpected closed beans after changes %v %v", vFound, vBeans.GetError())
+			}
+
+			//values are compared by text in every mode
+			for _, vCurValue := range []interface{}{1, "1", 1.0} {
+				vIds, _ = vDbHelper.FindBeanIds("priority", vCurValue)
+				if len(vIds) != 5 {
+					pTest.Errorf("unexpected beans with priority %#v %v", vCurValue, vIds)
+				}
+			}
+			vIds, _ = vDbHelper.FindBeanIds("active", true)
+			if len(vIds) != 3 || vIds[0] != "bean1" {
+				pTest.Errorf("unexpected active beans %v", vIds)
+			}
+			if vIds, _ = vDbHelper.FindBeanIds("active", "false"); len(vIds) != 6 {
+				pTest.Errorf("unexpected inactive beans %v", vIds)
+			}
+			if _, vFindError := vDbHelper.FindBeanIds("status", nil); vFindError == nil {
+				pTest.Error("null value accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	TABLE_BEANS_MIGRATIONS         = "beans_schema_migrations"
+	FIELD_BEANS_NAMESPACE          = "namespace"
+	FIELD_BEANS_CREATED_AT         = "created_at"
+	FIELD_BEANS_UPDATED_AT         = "updated_at"
+	FIELD_BEANS_CONTENT_HASH       = "content_hash"
+	FIELD_BEANS_VERSION            = "version"
+	TABLE_BEANS_INDEX              = "beans_index"
+	FIELD_BEANS_INDEX_NAME         = "index_name"
+	FIELD_BEANS_INDEX_VALUE        = "value"
+	TABLE_BEANS_HISTORY            = "beans_history"
+	FIELD_BEANS_HISTORY_REVISION   = "revision"
+	FIELD_BEANS_HISTORY_OPERATION  = "operation"
+	FIELD_BEANS_HISTORY_ACTOR      = "actor"
+	FIELD_BEANS_HISTORY_CHANGED_AT = "changed_at"
+	FIELD_BEANS_EXPIRES_AT         = "expires_at"
+	BeansSchema_Base               = 1
+	BeansSchema_Namespaces         = 2
+	BeansSchema_Versions           = 3
+	BeansSchema_Indexes            = 4
+	BeansSchema_History            = 5
+	BeansSchema_Expiry             = 6
+	beans_NamespaceMaxLength       = 64
+)
+
+var (
+	_BeansMigrations = newBeansMigrations()
+)
+
+//GetBeansMigrations returns the migrations of the beans table, they are applied automatically by the first bean operation
+func GetBeansMigrations() *Migrations {
+	return _BeansMigrations
+}
+
+func newBeansMigrations() *Migrations {
+	vRis := NewMigrations(TABLE_BEANS_MIGRATIONS)
+	vRis.AddFunc(BeansSchema_Base, "beans table", migrateBeansBase, nil)
+	vRis.AddFunc(BeansSchema_Namespaces, "beans namespaces and metadata", migrateBeansNamespaces, nil)
+	vRis.AddFunc(BeansSchema_Versions, "beans versions", migrateBeansVersions, nil)
+	vRis.AddFunc(BeansSchema_Indexes, "beans secondary indexes side table", migrateBeansIndexes, nil)
+	vRis.AddFunc(BeansSchema_History, "beans history", migrateBeansHistory, nil)
+	vRis.AddFunc(BeansSchema_Expiry, "beans expiry", migrateBeansExpiry, nil)
+	return vRis
+}
+
+//migrateBeansBase creates the original beans table, tables created by previous releases are kept
+func migrateBeansBase(pTx *DbHelperTx) error {
+
+	var vDdl string
+	switch pTx.GetDbType() {
+	case DbType_sqlite3:
+		vDdl = DDL_BEANS_SQLITE
+	case DbType_mysql:
+		vDdl = DDL_BEANS_MYSQL
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	_, vCreateError := pTx.Exec(vDdl)
+	if vCreateError != nil {
+		return diagnostic.NewError("Error while creating beans table", vCreateError)
+	}
+	return nil
+}
+
+//migrateBeansNamespaces adds namespace and metadata columns, the primary key becomes namespace + id.
+//Existing beans are moved to the empty namespace, see GetBeanNamespace and AdoptLegacyBeans
+func migrateBeansNamespaces(pTx *DbHelperTx) error {
+
+	vNow := time.Now().Unix()
+
+	var vStatements []string
+	switch pTx.GetDbType() {
+	case DbType_sqlite3:
+		//sqlite can't alter the primary key, the table is rebuilt
+		vStatements = []string{
+			"create table " + TABLE_BEANS + "_new (" + FIELD_BEANS_NAMESPACE + " text not null default '', " + FIELD_BEANS_ID + " text not null, " + FIELD_BEANS_SERIALIZED + " BLOB, " + FIELD_BEANS_CREATED_AT + " integer, " + FIELD_BEANS_UPDATED_AT + " integer, " + FIELD_BEANS_CONTENT_HASH + " text, PRIMARY KEY (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + "))",
+			"insert into " + TABLE_BEANS + "_new (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + "," + FIELD_BEANS_SERIALIZED + "," + FIELD_BEANS_CREATED_AT + "," + FIELD_BEANS_UPDATED_AT + ") select '', " + FIELD_BEANS_ID + "," + FIELD_BEANS_SERIALIZED + ",?,? from " + TABLE_BEANS,
+			"drop table " + TABLE_BEANS,
+			"alter table " + TABLE_BEANS + "_new rename to " + TABLE_BEANS}
+	case DbType_mysql:
+		vStatements = []string{
+			"alter table " + TABLE_BEANS + " add column " + FIELD_BEANS_NAMESPACE + " varchar(64) not null default '' first, add column " + FIELD_BEANS_CREATED_AT + " bigint, add column " + FIELD_BEANS_UPDATED_AT + " bigint, add column " + FIELD_BEANS_CONTENT_HASH + " char(64), drop primary key, add primary key (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + ")",
+			"update " + TABLE_BEANS + " set " + FIELD_BEANS_CREATED_AT + "=?, " + FIELD_BEANS_UPDATED_AT + "=?"}
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	for _, vCurStatement := range vStatements {
+		//created_at and updated_at of existing beans
+		var vParameters []interface{}
+		if strings.Contains(vCurStatement, "?") {
+			vParameters = []interface{}{vNow, vNow}
+		}
+		_, vExecError := pTx.Exec(vCurStatement, vParameters...)
+		if vExecError != nil {
+			return diagnostic.NewError("failed to execute statement %s", vExecError, vCurStatement)
+		}
+	}
+	return nil
+}
+
+//migrateBeansVersions adds the version column used by optimistic concurrency, existing beans have version 0
+func migrateBeansVersions(pTx *DbHelperTx) error {
+
+	var vDdl string
+	switch pTx.GetDbType() {
+	case DbType_sqlite3:
+		vDdl = "alter table " + TABLE_BEANS + " add column " + FIELD_BEANS_VERSION + " integer not null default 0"
+	case DbType_mysql:
+		vDdl = "alter table " + TABLE_BEANS + " add column " + FIELD_BEANS_VERSION + " bigint not null default 0"
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	_, vAlterError := pTx.Exec(vDdl)
+	if vAlterError != nil {
+		return diagnostic.NewError("failed to execute statement %s", vAlterError, vDdl)
+	}
+	return nil
+}
+
+//migrateBeansIndexes creates the side table of secondary indexes not implemented by json functions.
+//Rows are replaced on each save, so no primary key is defined (on mysql it would exceed the key length limit)
+func migrateBeansIndexes(pTx *DbHelperTx) error {
+
+	var vDdl []string
+	switch pTx.GetDbType() {
+	case DbType_sqlite3:
+		vDdl = []string{
+			"create table " + TABLE_BEANS_INDEX + " (" + FIELD_BEANS_INDEX_NAME + " text not null, " + FIELD_BEANS_NAMESPACE + " text not null, " + FIELD_BEANS_ID + " text not null, " + FIELD_BEANS_INDEX_VALUE + " text not null)",
+			"create index " + TABLE_BEANS_INDEX + "_value on " + TABLE_BEANS_INDEX + " (" + FIELD_BEANS_INDEX_NAME + "," + FIELD_BEANS_INDEX_VALUE + ")",
+			"create index " + TABLE_BEANS_INDEX + "_bean on " + TABLE_BEANS_INDEX + " (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + ")"}
+	case DbType_mysql:
+		vDdl = []string{
+			"create table " + TABLE_BEANS_INDEX + " (" + FIELD_BEANS_INDEX_NAME + " varchar(64) not null, " + FIELD_BEANS_NAMESPACE + " varchar(64) not null, " + FIELD_BEANS_ID + " varchar(700) not null, " + FIELD_BEANS_INDEX_VALUE + " varchar(255) not null, " +
+				"KEY " + TABLE_BEANS_INDEX + "_value (" + FIELD_BEANS_INDEX_NAME + "," + FIELD_BEANS_INDEX_VALUE + "), " +
+				"KEY " + TABLE_BEANS_INDEX + "_bean (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + "))"}
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	for _, vCurDdl := range vDdl {
+		_, vCreateError := pTx.Exec(vCurDdl)
+		if vCreateError != nil {
+			return diagnostic.NewError("failed to execute statement %s", vCreateError, vCurDdl)
+		}
+	}
+	return nil
+}
+
+//migrateBeansHistory creates the table of the previous versions of the beans
+func migrateBeansHistory(pTx *DbHelperTx) error {
+
+	var vDdl []string
+	switch pTx.GetDbType() {
+	case DbType_sqlite3:
+		vDdl = []string{
+			"create table " + TABLE_BEANS_HISTORY + " (" + FIELD_BEANS_HISTORY_REVISION + " integer PRIMARY KEY AUTOINCREMENT, " + FIELD_BEANS_NAMESPACE + " text not null, " + FIELD_BEANS_ID + " text not null, " + FIELD_BEANS_HISTORY_OPERATION + " text not null, " + FIELD_BEANS_HISTORY_ACTOR + " text, " + FIELD_BEANS_HISTORY_CHANGED_AT + " integer, " + FIELD_BEANS_SERIALIZED + " BLOB)",
+			"create index " + TABLE_BEANS_HISTORY + "_bean on " + TABLE_BEANS_HISTORY + " (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + "," + FIELD_BEANS_HISTORY_REVISION + ")"}
+	case DbType_mysql:
+		vDdl = []string{
+			"create table " + TABLE_BEANS_HISTORY + " (" + FIELD_BEANS_HISTORY_REVISION + " bigint auto_increment PRIMARY KEY, " + FIELD_BEANS_NAMESPACE + " varchar(64) not null, " + FIELD_BEANS_ID + " varchar(700) not null, " + FIELD_BEANS_HISTORY_OPERATION + " varchar(16) not null, " + FIELD_BEANS_HISTORY_ACTOR + " varchar(255), " + FIELD_BEANS_HISTORY_CHANGED_AT + " bigint, " + FIELD_BEANS_SERIALIZED + " LONGBLOB, " +
+				"KEY " + TABLE_BEANS_HISTORY + "_bean (" + FIELD_BEANS_NAMESPACE + "," + FIELD_BEANS_ID + "))"}
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	for _, vCurDdl := range vDdl {
+		_, vCreateError := pTx.Exec(vCurDdl)
+		if vCreateError != nil {
+			return diagnostic.NewError("failed to execute statement %s", vCreateError, vCurDdl)
+		}
+	}
+	return nil
+}
+
+//migrateBeansExpiry adds the expiry column, unix time in milliseconds, null for beans that never expire
+func migrateBeansExpiry(pTx *DbHelperTx) error {
+
+	vDdl := []string{
+		"alter table " + TABLE_BEANS + " add column " + FIELD_BEANS_EXPIRES_AT + " bigint",
+		"create index " + TABLE_BEANS + "_" + FIELD_BEANS_EXPIRES_AT + " on " + TABLE_BEANS + " (" + FIELD_BEANS_EXPIRES_AT + ")"}
+
+	switch pTx.GetDbType() {
+	case DbType_sqlite3, DbType_mysql:
+	default:
+		return diagnostic.NewError("Beans not supported for dbtype %s", nil, pTx.GetDbType())
+	}
+
+	for _, vCurDdl := range vDdl {
+		_, vAlterError := pTx.Exec(vCurDdl)
+		if vAlterError != nil {
+			return diagnostic.NewError("failed to execute statement %s", vAlterError, vCurDdl)
+		}
+	}
+	return nil
+}
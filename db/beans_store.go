@@ -0,0 +1,49 @@
+package db
+
+import (
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+//DbBeanStore persistency.BeanStore saving the beans of a namespace in the beans table, beans don't need to implement IndentifiableInDb
+type DbBeanStore struct {
+	dbHelper  *DbHelper
+	namespace string
+}
+
+var _ persistency.BeanStore = &DbBeanStore{}
+
+//GetBeanStore returns a store of the beans of a namespace, indexes, history and expiry of the namespace apply to its beans
+//Parameters:
+// pNamespace = namespace of the beans, use GetBeanNamespace to share the beans with SaveBean and LoadBean
+func (vSelf *DbHelper) GetBeanStore(pNamespace string) *DbBeanStore {
+	return &DbBeanStore{dbHelper: vSelf, namespace: pNamespace}
+}
+
+//GetNamespace returns the namespace of the beans
+func (vSelf *DbBeanStore) GetNamespace() string {
+	return vSelf.namespace
+}
+
+func (vSelf *DbBeanStore) LoadBean(pId string, pBean interface{}) error {
+	return vSelf.dbHelper.loadBeanByKey(vSelf.dbHelper.db, nil, vSelf.namespace, pId, pBean)
+}
+
+func (vSelf *DbBeanStore) SaveBean(pId string, pBean interface{}) error {
+	return vSelf.dbHelper.runBeanChange(vSelf.namespace, func(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+		return vSelf.dbHelper.saveBeanByKey(pExecutor, pTransaction, vSelf.namespace, pId, pBean, 0)
+	})
+}
+
+func (vSelf *DbBeanStore) DeleteBean(pId string) error {
+	return vSelf.dbHelper.runBeanChange(vSelf.namespace, func(pExecutor SqlExecutor, pTransaction *DbHelperTx) error {
+		return vSelf.dbHelper.deleteBeanByKey(pExecutor, pTransaction, vSelf.namespace, pId)
+	})
+}
+
+func (vSelf *DbBeanStore) ExistsBean(pId string) (bool, error) {
+	return vSelf.dbHelper.existsBeanByKey(vSelf.dbHelper.db, nil, vSelf.namespace, pId)
+}
+
+func (vSelf *DbBeanStore) ListBeanIds(pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+	return vSelf.dbHelper.listBeanIds(vSelf.dbHelper.db, nil, vSelf.namespace, pPrefix, pLimit, pCursor)
+}
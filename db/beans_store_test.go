@@ -0,0 +1,74 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+func TestSqlite3BeanStore(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanstore")
+	var vStore persistency.BeanStore = vDbHelper.GetBeanStore("store")
+
+	if vLoadError := vStore.LoadBean("missing", &testVersionedBean{}); persistency.IsBeanNotFound(vLoadError) == false {
+		pTest.Errorf("expected bean not found, got %v", vLoadError)
+	}
+
+	for _, vCurId := range []string{"b/2", "a/1", "b/1", "b/3"} {
+		if vSaveError := vStore.SaveBean(vCurId, &testVersionedBean{Value: vCurId}); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+
+	vIds, vCursor, vListError := vStore.ListBeanIds("b/", 2, "")
+	if vListError != nil || len(vIds) != 2 || vIds[0] != "b/1" || vCursor != "b/2" {
+		pTest.Errorf("unexpected first page %v cursor %s %v", vIds, vCursor, vListError)
+	}
+
+	vFirst := &testVersionedBean{}
+	if vLoadError := vStore.LoadBean("a/1", vFirst); vLoadError != nil || vFirst.Value != "a/1" || vFirst.Version != 1 {
+		pTest.Fatalf("unexpected bean %v %v", vFirst, vLoadError)
+	}
+	vSecond := &testVersionedBean{}
+	vStore.LoadBean("a/1", vSecond)
+	vStore.SaveBean("a/1", vSecond)
+	if vSaveError := vStore.SaveBean("a/1", vFirst); persistency.IsConcurrentModification(vSaveError) == false {
+		pTest.Errorf("expected concurrent modification, got %v", vSaveError)
+	}
+
+	//beans of the namespace of a type are shared with SaveBean
+	vDbHelper.SaveBean(&testVersionedBean{Id: "typed", Value: "typed"})
+	if vExists, _ := vDbHelper.GetBeanStore(GetBeanNamespace(&testVersionedBean{})).ExistsBean("typed"); vExists == false {
+		pTest.Error("bean saved by SaveBean not found in store")
+	}
+
+	//beans saved without version become versioned by the first save of a versioned type
+	vPlainStore := vDbHelper.GetBeanStore("plain")
+	if vSaveError := vPlainStore.SaveBean("c/1", &testBean{Value: "plain"}); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	vPlain := &testVersionedBean{}
+	if vLoadError := vPlainStore.LoadBean("c/1", vPlain); vLoadError != nil || vPlain.Value != "plain" || vPlain.Version != 0 {
+		pTest.Fatalf("unexpected bean %v %v", vPlain, vLoadError)
+	}
+	vPlain.Value = "versioned"
+	if vSaveError := vPlainStore.SaveBean("c/1", vPlain); vSaveError != nil || vPlain.Version != 1 {
+		pTest.Fatalf("failed to save bean without version %v, version %d", vSaveError, vPlain.Version)
+	}
+	vStale := &testVersionedBean{}
+	if vSaveError := vPlainStore.SaveBean("c/1", vStale); persistency.IsConcurrentModification(vSaveError) == false {
+		pTest.Errorf("expected concurrent modification, got %v", vSaveError)
+	}
+
+	if vExists, _ := vDbHelper.GetBeanStore("other").ExistsBean("a/1"); vExists {
+		pTest.Error("bean found in another namespace")
+	}
+
+	if vDeleteError := vStore.DeleteBean("a/1"); vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	if vDeleteError := vStore.DeleteBean("a/1"); persistency.IsBeanNotFound(vDeleteError) == false {
+		pTest.Errorf("expected bean not found, got %v", vDeleteError)
+	}
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+func TestSqlite3BeansListing(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanslisting")
+
+	for vCnt := 0; vCnt < 25; vCnt++ {
+		if vSaveError := vDbHelper.SaveBean(&testBean{Id: "item" + strconv.Itoa(100+vCnt), Value: strconv.Itoa(vCnt)}); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+	vDbHelper.SaveBean(&testBean{Id: "ITEM_upper", Value: "case"})
+	vDbHelper.SaveBean(&testBean{Id: "other", Value: "other"})
+
+	vNamespace := GetBeanNamespace(&testBean{})
+	vCursor := ""
+	vPages := 0
+	vListed := 0
+	for {
+		vIds, vNextCursor, vListError := vDbHelper.ListBeanIds(vNamespace, "item", 10, vCursor)
+		if vListError != nil {
+			pTest.Fatal("failed to list beans", vListError)
+		}
+		vPages++
+		vListed += len(vIds)
+		if vNextCursor == "" {
+			break
+		}
+		vCursor = vNextCursor
+	}
+	if vPages != 3 || vListed != 25 {
+		pTest.Errorf("expected 25 ids in 3 pages, got %d in %d", vListed, vPages)
+	}
+
+	vIterator, vIteratorError := vDbHelper.IterateBeans(vNamespace, "item11")
+	if vIteratorError != nil {
+		pTest.Fatal("failed to iterate beans", vIteratorError)
+	}
+	vBeans := persistency.IterateBeansOf[testBean](vIterator)
+	vIterated := 0
+	for vBeans.Next() {
+		if vBeans.GetBean().Id != vBeans.GetId() {
+			pTest.Errorf("bean %s unmarshalled with id %s", vBeans.GetId(), vBeans.GetBean().Id)
+		}
+		vIterated++
+	}
+	vBeans.Close()
+	if vBeans.GetError() != nil || vIterated != 10 {
+		pTest.Errorf("expected 10 beans, got %d %v", vIterated, vBeans.GetError())
+	}
+
+	if vExists, _ := vDbHelper.ExistsBean(&testBean{Id: "other"}); vExists == false {
+		pTest.Error("bean other not found")
+	}
+	if vDeleteError := vDbHelper.DeleteBean(&testBean{Id: "other"}); vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	if vExists, _ := vDbHelper.ExistsBean(&testBean{Id: "other"}); vExists {
+		pTest.Error("bean other still exists")
+	}
+	if vDeleteError := vDbHelper.DeleteBean(&testBean{Id: "other"}); persistency.IsBeanNotFound(vDeleteError) == false {
+		pTest.Errorf("expected bean not found, got %v", vDeleteError)
+	}
+}
+
+type testOtherBean struct {
+	Id    string
+	Count int
+}
+
+func (vSelf *testOtherBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func TestSqlite3BeansNamespaces(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beansnamespaces")
+
+	//beans table created by a release without namespaces
+	vDbHelper.Exec(DDL_BEANS_SQLITE)
+	for _, vCurId := range []string{"legacy", "kept", "bulk"} {
+		if _, vLegacyError := vDbHelper.Exec("insert into "+TABLE_BEANS+" values (?,?)", vCurId, `{"Id":"`+vCurId+`","Value":"old"}`); vLegacyError != nil {
+			pTest.Fatal("failed to insert legacy bean", vLegacyError)
+		}
+	}
+
+	//legacy beans are moved into the namespace of the first type using them
+	vLegacy := &testBean{Id: "legacy"}
+	if vLoadError := vDbHelper.LoadBean(vLegacy); vLoadError != nil || vLegacy.Value != "old" {
+		pTest.Fatalf("failed to load legacy bean %v %v", vLegacy, vLoadError)
+	}
+	if vExists, _ := vDbHelper.GetBeanStore("").ExistsBean("legacy"); vExists {
+		pTest.Error("legacy bean not moved by the first load")
+	}
+	if vSaveError := vDbHelper.SaveBean(&testBean{Id: "kept", Value: "new"}); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vIds, _, _ := vDbHelper.ListBeanIds("", "", 0, ""); len(vIds) != 1 || vIds[0] != "bulk" {
+		pTest.Errorf("unexpected ids left in the empty namespace %v", vIds)
+	}
+	vKept := &testBean{Id: "kept"}
+	if vDbHelper.LoadBean(vKept); vKept.Value != "new" {
+		pTest.Errorf("legacy bean not replaced by the saved one %v", vKept)
+	}
+	if vAdopted, vAdoptError := vDbHelper.AdoptLegacyBeans(GetBeanNamespace(vLegacy)); vAdoptError != nil || vAdopted != 1 {
+		pTest.Fatalf("unexpected adoption of %d beans %v", vAdopted, vAdoptError)
+	}
+
+	vLegacy.Value = "new"
+	if vSaveError := vDbHelper.SaveBean(vLegacy); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vCount := countRows(pTest, vDbHelper, TABLE_BEANS); vCount != 3 {
+		pTest.Errorf("unexpected %d rows", vCount)
+	}
+
+	if vSaveError := vDbHelper.SaveBean(&testOtherBean{Id: "legacy", Count: 3}); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	vOther := &testOtherBean{Id: "legacy"}
+	vDbHelper.LoadBean(vOther)
+	vReloaded := &testBean{Id: "legacy"}
+	vDbHelper.LoadBean(vReloaded)
+	if vOther.Count != 3 || vReloaded.Value != "new" {
+		pTest.Errorf("beans of different types collide: %v %v", vOther, vReloaded)
+	}
+
+	vMetadata, vMetadataError := vDbHelper.GetBeanMetadata(vReloaded)
+	if vMetadataError != nil {
+		pTest.Fatal("failed to read metadata", vMetadataError)
+	}
+	if vMetadata.Namespace != "db.testBean" || len(vMetadata.ContentHash) != 64 || vMetadata.UpdatedAt.Before(vMetadata.CreatedAt) {
+		pTest.Errorf("unexpected metadata %+v", vMetadata)
+	}
+
+	vIds, _, _ := vDbHelper.ListBeanIds(GetBeanNamespace(vOther), "", 0, "")
+	if len(vIds) != 1 {
+		pTest.Errorf("unexpected ids in namespace %v", vIds)
+	}
+}
+
+type testVersionedBean struct {
+	Id      string
+	Value   string
+	Version int64
+}
+
+func (vSelf *testVersionedBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func (vSelf *testVersionedBean) GetBeanVersion() int64 {
+	return vSelf.Version
+}
+
+func (vSelf *testVersionedBean) SetBeanVersion(pVersion int64) {
+	vSelf.Version = pVersion
+}
+
+func TestSqlite3BeansOptimisticConcurrency(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beansversions")
+
+	if vSaveError := vDbHelper.SaveBean(&testVersionedBean{Id: "shared", Value: "first"}); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vSaveError := vDbHelper.SaveBean(&testVersionedBean{Id: "shared", Value: "duplicated"}); persistency.IsConcurrentModification(vSaveError) == false {
+		pTest.Errorf("expected concurrent modification for a duplicated new bean, got %v", vSaveError)
+	}
+
+	vFirst := &testVersionedBean{Id: "shared"}
+	vSecond := &testVersionedBean{Id: "shared"}
+	vDbHelper.LoadBean(vFirst)
+	vDbHelper.LoadBean(vSecond)
+	if vFirst.Version != 1 {
+		pTest.Fatalf("unexpected version %d", vFirst.Version)
+	}
+
+	vFirst.Value = "updated by first"
+	if vSaveError := vDbHelper.SaveBean(vFirst); vSaveError != nil || vFirst.Version != 2 {
+		pTest.Fatalf("failed to save bean %v, version %d", vSaveError, vFirst.Version)
+	}
+
+	vSecond.Value = "updated by second"
+	vSaveError := vDbHelper.SaveBean(vSecond)
+	if persistency.IsConcurrentModification(vSaveError) == false || vSecond.Version != 1 {
+		pTest.Errorf("expected concurrent modification keeping version 1, got %v version %d", vSaveError, vSecond.Version)
+	}
+
+	vReloaded := &testVersionedBean{Id: "shared"}
+	vDbHelper.LoadBean(vReloaded)
+	if vReloaded.Value != "updated by first" || vReloaded.Version != 2 {
+		pTest.Errorf("unexpected stored bean %+v", vReloaded)
+	}
+}
+
+type testValidatedDbBean struct {
+	Id     string
+	Status string `validate:"required,enum=open|closed"`
+}
+
+func (vSelf *testValidatedDbBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func TestSqlite3BeansValidation(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beansvalidation")
+
+	if vSaveError := vDbHelper.SaveBean(&testValidatedDbBean{Id: "invalid", Status: "lost"}); persistency.IsValidationError(vSaveError) == false {
+		pTest.Errorf("expected validation error, got %v", vSaveError)
+	}
+	if vExists, _ := vDbHelper.ExistsBean(&testValidatedDbBean{Id: "invalid"}); vExists {
+		pTest.Error("invalid bean saved")
+	}
+
+	vDbHelper.GetBeanStore(GetBeanNamespace(&testValidatedDbBean{})).SaveBean("stored", map[string]string{"Id": "stored"})
+	if vLoadError := vDbHelper.LoadBean(&testValidatedDbBean{Id: "stored"}); persistency.IsValidationError(vLoadError) == false {
+		pTest.Errorf("expected validation error, got %v", vLoadError)
+	}
+}
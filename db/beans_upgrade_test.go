@@ -0,0 +1,67 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+//testUpgradedBean version 1 stored the status in Open
+type testUpgradedBean struct {
+	Id     string
+	Status string
+}
+
+func (vSelf *testUpgradedBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func (vSelf *testUpgradedBean) GetBeanSchemaVersion() int {
+	return 2
+}
+
+func TestSqlite3BeanUpgrades(pTest *testing.T) {
+
+	persistency.RegisterBeanUpgrade(&testUpgradedBean{}, 1, func(pJson []byte) ([]byte, error) {
+		vFields := make(map[string]interface{})
+		if vError := json.Unmarshal(pJson, &vFields); vError != nil {
+			return nil, vError
+		}
+		vFields["Status"] = "closed"
+		if vFields["Open"] == true {
+			vFields["Status"] = "open"
+		}
+		delete(vFields, "Open")
+		return json.Marshal(vFields)
+	})
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "beanupgrades")
+	vNamespace := GetBeanNamespace(&testUpgradedBean{})
+	vDbHelper.GetBeanStore(vNamespace).SaveBean("old", map[string]interface{}{"Id": "old", "Open": true})
+	if vIndexError := vDbHelper.AddBeanIndex(BeanIndex{Name: "upgradedstatus", Namespace: vNamespace, JsonPath: "Status", Mode: BeanIndexMode_SideTable}); vIndexError != nil {
+		pTest.Fatal("failed to add index", vIndexError)
+	}
+
+	vLoaded := &testUpgradedBean{Id: "old"}
+	if vLoadError := vDbHelper.LoadBean(vLoaded); vLoadError != nil || vLoaded.Status != "open" {
+		pTest.Fatalf("unexpected upgraded bean %v %v", vLoaded, vLoadError)
+	}
+	if vIds, _ := vDbHelper.FindBeanIds("upgradedstatus", "open"); len(vIds) != 0 {
+		pTest.Errorf("bean written back without write back enabled %v", vIds)
+	}
+
+	persistency.SetBeanUpgradeWriteBack(&testUpgradedBean{}, true)
+	defer persistency.SetBeanUpgradeWriteBack(&testUpgradedBean{}, false)
+	vDbHelper.LoadBean(&testUpgradedBean{Id: "old"})
+
+	var vData []byte
+	vDbHelper.GetDb().QueryRow("select "+FIELD_BEANS_SERIALIZED+" from "+TABLE_BEANS+" where "+FIELD_BEANS_ID+"=?", "old").Scan(&vData)
+	if strings.Contains(string(vData), `"_schema":2`) == false || strings.Contains(string(vData), "Open") {
+		pTest.Errorf("upgraded bean not written back %s", vData)
+	}
+	if vIds, _ := vDbHelper.FindBeanIds("upgradedstatus", "open"); len(vIds) != 1 {
+		pTest.Errorf("index not updated by write back %v", vIds)
+	}
+}
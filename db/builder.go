@@ -0,0 +1,577 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//QuoteIdentifier quote an identifier using the syntax of the dialect. Qualified identifiers (table.column) are quoted part by part
+//Parameters:
+// pDbType = dialect
+// pIdentifier = identifier to quote, * is left as is
+func QuoteIdentifier(pDbType DbType, pIdentifier string) string {
+
+	vQuote := "\""
+	if pDbType == DbType_mysql {
+		vQuote = "`"
+	}
+
+	vParts := strings.Split(pIdentifier, ".")
+	for vCnt, vCurPart := range vParts {
+		if vCurPart == "*" {
+			continue
+		}
+		vParts[vCnt] = vQuote + strings.Replace(vCurPart, vQuote, vQuote+vQuote, -1) + vQuote
+	}
+	return strings.Join(vParts, ".")
+}
+
+//Condition a where condition with bound parameters
+type Condition interface {
+	buildCondition(pDbType DbType) (string, []interface{})
+}
+
+type comparisonCondition struct {
+	column   string
+	operator string
+	value    interface{}
+}
+
+func (vSelf *comparisonCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	return QuoteIdentifier(pDbType, vSelf.column) + " " + vSelf.operator + " ?", []interface{}{vSelf.value}
+}
+
+//Eq column = value
+func Eq(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: "=", value: pValue}
+}
+
+//Ne column <> value
+func Ne(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: "<>", value: pValue}
+}
+
+//Lt column < value
+func Lt(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: "<", value: pValue}
+}
+
+//Le column <= value
+func Le(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: "<=", value: pValue}
+}
+
+//Gt column > value
+func Gt(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: ">", value: pValue}
+}
+
+//Ge column >= value
+func Ge(pColumn string, pValue interface{}) Condition {
+	return &comparisonCondition{column: pColumn, operator: ">=", value: pValue}
+}
+
+type likeCondition struct {
+	column  string
+	pattern string
+}
+
+func (vSelf *likeCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	return QuoteIdentifier(pDbType, vSelf.column) + " like ? escape '" + Like_EscapeChar + "'", []interface{}{vSelf.pattern}
+}
+
+const (
+	//Like_EscapeChar escape character of like patterns
+	Like_EscapeChar = "!"
+)
+
+//Like column like pattern, use Like_EscapeChar to escape wildcards
+func Like(pColumn string, pPattern string) Condition {
+	return &likeCondition{column: pColumn, pattern: pPattern}
+}
+
+//StartsWith column begins with the given prefix, wildcards in the prefix are escaped
+func StartsWith(pColumn string, pPrefix string) Condition {
+	vEscaped := strings.NewReplacer(Like_EscapeChar, Like_EscapeChar+Like_EscapeChar, "%", Like_EscapeChar+"%", "_", Like_EscapeChar+"_").Replace(pPrefix)
+	return &likeCondition{column: pColumn, pattern: vEscaped + "%"}
+}
+
+type inCondition struct {
+	column string
+	values []interface{}
+}
+
+func (vSelf *inCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	if len(vSelf.values) == 0 {
+		return "1=0", nil
+	}
+	return QuoteIdentifier(pDbType, vSelf.column) + " in (" + strings.Repeat("?,", len(vSelf.values)-1) + "?)", vSelf.values
+}
+
+//In column in (values...), an empty list matches nothing
+func In(pColumn string, pValues ...interface{}) Condition {
+	return &inCondition{column: pColumn, values: pValues}
+}
+
+type nullCondition struct {
+	column string
+	isNull bool
+}
+
+func (vSelf *nullCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	if vSelf.isNull {
+		return QuoteIdentifier(pDbType, vSelf.column) + " is null", nil
+	}
+	return QuoteIdentifier(pDbType, vSelf.column) + " is not null", nil
+}
+
+//IsNull column is null
+func IsNull(pColumn string) Condition {
+	return &nullCondition{column: pColumn, isNull: true}
+}
+
+//IsNotNull column is not null
+func IsNotNull(pColumn string) Condition {
+	return &nullCondition{column: pColumn, isNull: false}
+}
+
+type columnsCondition struct {
+	left  string
+	right string
+}
+
+func (vSelf *columnsCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	return QuoteIdentifier(pDbType, vSelf.left) + " = " + QuoteIdentifier(pDbType, vSelf.right), nil
+}
+
+//EqColumns leftColumn = rightColumn, typically used in joins
+func EqColumns(pLeftColumn string, pRightColumn string) Condition {
+	return &columnsCondition{left: pLeftColumn, right: pRightColumn}
+}
+
+type logicalCondition struct {
+	operator   string
+	conditions []Condition
+}
+
+func (vSelf *logicalCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	vParts := make([]string, 0, len(vSelf.conditions))
+	vArgs := make([]interface{}, 0)
+	for _, vCurCondition := range vSelf.conditions {
+		if vCurCondition == nil {
+			continue
+		}
+		vCurSql, vCurArgs := vCurCondition.buildCondition(pDbType)
+		vParts = append(vParts, "("+vCurSql+")")
+		vArgs = append(vArgs, vCurArgs...)
+	}
+	if len(vParts) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(vParts, " "+vSelf.operator+" "), vArgs
+}
+
+//And all the conditions must be satisfied
+func And(pConditions ...Condition) Condition {
+	return &logicalCondition{operator: "and", conditions: pConditions}
+}
+
+//Or at least one condition must be satisfied
+func Or(pConditions ...Condition) Condition {
+	return &logicalCondition{operator: "or", conditions: pConditions}
+}
+
+type notCondition struct {
+	condition Condition
+}
+
+func (vSelf *notCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	vSql, vArgs := vSelf.condition.buildCondition(pDbType)
+	return "not (" + vSql + ")", vArgs
+}
+
+//Not negates a condition
+func Not(pCondition Condition) Condition {
+	return &notCondition{condition: pCondition}
+}
+
+type exprCondition struct {
+	expression string
+	args       []interface{}
+}
+
+func (vSelf *exprCondition) buildCondition(pDbType DbType) (string, []interface{}) {
+	return vSelf.expression, vSelf.args
+}
+
+//Expr a raw sql condition. The expression is not quoted, values must be passed as parameters
+func Expr(pExpression string, pArgs ...interface{}) Condition {
+	return &exprCondition{expression: pExpression, args: pArgs}
+}
+
+type whereClause struct {
+	conditions []Condition
+}
+
+func (vSelf *whereClause) add(pCondition Condition) {
+	vSelf.conditions = append(vSelf.conditions, pCondition)
+}
+
+func (vSelf *whereClause) build(pDbType DbType) (string, []interface{}) {
+	if len(vSelf.conditions) == 0 {
+		return "", nil
+	}
+	vSql, vArgs := And(vSelf.conditions...).buildCondition(pDbType)
+	return " where " + vSql, vArgs
+}
+
+type selectJoin struct {
+	kind      string
+	table     string
+	condition Condition
+}
+
+type selectOrder struct {
+	column     string
+	descending bool
+}
+
+//SelectBuilder builds select statements
+type SelectBuilder struct {
+	dbType      DbType
+	executor    SqlExecutor
+	columns     []string
+	expressions []string
+	table       string
+	joins       []selectJoin
+	where       whereClause
+	groupBy     []string
+	orderBy     []selectOrder
+	limit       int
+	offset      int
+}
+
+//NewSelect create a select builder not bound to a database, use Build to obtain the statement
+//Parameters:
+// pDbType = dialect
+// pColumns = columns to select, none for *
+func NewSelect(pDbType DbType, pColumns ...string) *SelectBuilder {
+	return &SelectBuilder{dbType: pDbType, columns: pColumns}
+}
+
+//Select create a select builder bound to the database
+func (vSelf *DbHelper) Select(pColumns ...string) *SelectBuilder {
+	return &SelectBuilder{dbType: vSelf.GetDbType(), executor: vSelf.db, columns: pColumns}
+}
+
+//Select create a select builder bound to the transaction
+func (vSelf *DbHelperTx) Select(pColumns ...string) *SelectBuilder {
+	return &SelectBuilder{dbType: vSelf.GetDbType(), executor: vSelf.tx, columns: pColumns}
+}
+
+func (vSelf *DbHelper) selectOn(pExecutor SqlExecutor, pColumns ...string) *SelectBuilder {
+	return &SelectBuilder{dbType: vSelf.GetDbType(), executor: pExecutor, columns: pColumns}
+}
+
+//Expressions add raw expressions to the selected columns, for example count(*). Expressions are not quoted
+func (vSelf *SelectBuilder) Expressions(pExpressions ...string) *SelectBuilder {
+	vSelf.expressions = append(vSelf.expressions, pExpressions...)
+	return vSelf
+}
+
+func (vSelf *SelectBuilder) From(pTable string) *SelectBuilder {
+	vSelf.table = pTable
+	return vSelf
+}
+
+//Join inner join a table
+func (vSelf *SelectBuilder) Join(pTable string, pOn Condition) *SelectBuilder {
+	vSelf.joins = append(vSelf.joins, selectJoin{kind: "join", table: pTable, condition: pOn})
+	return vSelf
+}
+
+//LeftJoin left outer join a table
+func (vSelf *SelectBuilder) LeftJoin(pTable string, pOn Condition) *SelectBuilder {
+	vSelf.joins = append(vSelf.joins, selectJoin{kind: "left join", table: pTable, condition: pOn})
+	return vSelf
+}
+
+//Where add a condition, multiple conditions are combined in and
+func (vSelf *SelectBuilder) Where(pCondition Condition) *SelectBuilder {
+	vSelf.where.add(pCondition)
+	return vSelf
+}
+
+func (vSelf *SelectBuilder) GroupBy(pColumns ...string) *SelectBuilder {
+	vSelf.groupBy = append(vSelf.groupBy, pColumns...)
+	return vSelf
+}
+
+func (vSelf *SelectBuilder) OrderBy(pColumn string) *SelectBuilder {
+	vSelf.orderBy = append(vSelf.orderBy, selectOrder{column: pColumn})
+	return vSelf
+}
+
+func (vSelf *SelectBuilder) OrderByDesc(pColumn string) *SelectBuilder {
+	vSelf.orderBy = append(vSelf.orderBy, selectOrder{column: pColumn, descending: true})
+	return vSelf
+}
+
+//Limit maximum number of rows returned, 0 for no limit
+func (vSelf *SelectBuilder) Limit(pLimit int) *SelectBuilder {
+	vSelf.limit = pLimit
+	return vSelf
+}
+
+//Offset number of rows to skip
+func (vSelf *SelectBuilder) Offset(pOffset int) *SelectBuilder {
+	vSelf.offset = pOffset
+	return vSelf
+}
+
+//Build returns the statement and its parameters
+func (vSelf *SelectBuilder) Build() (string, []interface{}, error) {
+
+	if vSelf.table == "" {
+		return "", nil, diagnostic.NewError("select without table", nil)
+	}
+
+	vSelected := make([]string, 0, len(vSelf.columns)+len(vSelf.expressions))
+	if len(vSelf.columns) > 0 {
+		vSelected = append(vSelected, quoteIdentifiers(vSelf.dbType, vSelf.columns))
+	}
+	vSelected = append(vSelected, vSelf.expressions...)
+	if len(vSelected) == 0 {
+		vSelected = append(vSelected, "*")
+	}
+	vRis := "select " + strings.Join(vSelected, ",")
+	vRis += " from " + QuoteIdentifier(vSelf.dbType, vSelf.table)
+
+	vArgs := make([]interface{}, 0)
+	for _, vCurJoin := range vSelf.joins {
+		vRis += " " + vCurJoin.kind + " " + QuoteIdentifier(vSelf.dbType, vCurJoin.table)
+		if vCurJoin.condition != nil {
+			vOnSql, vOnArgs := vCurJoin.condition.buildCondition(vSelf.dbType)
+			vRis += " on " + vOnSql
+			vArgs = append(vArgs, vOnArgs...)
+		}
+	}
+
+	vWhereSql, vWhereArgs := vSelf.where.build(vSelf.dbType)
+	vRis += vWhereSql
+	vArgs = append(vArgs, vWhereArgs...)
+
+	if len(vSelf.groupBy) > 0 {
+		vRis += " group by " + quoteIdentifiers(vSelf.dbType, vSelf.groupBy)
+	}
+
+	if len(vSelf.orderBy) > 0 {
+		vOrders := make([]string, len(vSelf.orderBy))
+		for vCnt, vCurOrder := range vSelf.orderBy {
+			vOrders[vCnt] = QuoteIdentifier(vSelf.dbType, vCurOrder.column)
+			if vCurOrder.descending {
+				vOrders[vCnt] += " desc"
+			}
+		}
+		vRis += " order by " + strings.Join(vOrders, ",")
+	}
+
+	if vSelf.limit > 0 {
+		vRis += " limit " + strconv.Itoa(vSelf.limit)
+	} else if vSelf.offset > 0 {
+		//offset requires a limit
+		switch vSelf.dbType {
+		case DbType_mysql:
+			vRis += " limit 18446744073709551615"
+		default:
+			vRis += " limit -1"
+		}
+	}
+	if vSelf.offset > 0 {
+		vRis += " offset " + strconv.Itoa(vSelf.offset)
+	}
+
+	return vRis, vArgs, nil
+}
+
+//Query execute the select
+func (vSelf *SelectBuilder) Query() (*DbHelperRows, error) {
+
+	if vSelf.executor == nil {
+		return nil, diagnostic.NewError("select builder not bound to a database", nil)
+	}
+
+	vQuery, vArgs, vBuildError := vSelf.Build()
+	if vBuildError != nil {
+		return nil, vBuildError
+	}
+	return queryOn(vSelf.executor, vQuery, vArgs...)
+}
+
+//QueryStructs execute the select appending rows to a slice of structs, see DbHelper.QueryStructs
+func (vSelf *SelectBuilder) QueryStructs(pDest interface{}) error {
+	return queryStructs(selectQuerier{builder: vSelf}, pDest, "")
+}
+
+//QueryOne execute the select copying the first row into a struct, see DbHelper.QueryOne
+func (vSelf *SelectBuilder) QueryOne(pDest interface{}) error {
+	return queryOne(selectQuerier{builder: vSelf}, pDest, "")
+}
+
+// selectQuerier adapts a SelectBuilder to Querier, query and parameters come from the builder
+type selectQuerier struct {
+	builder *SelectBuilder
+}
+
+func (vSelf selectQuerier) Query(string, ...interface{}) (*DbHelperRows, error) {
+	return vSelf.builder.Query()
+}
+
+//UpdateBuilder builds update statements
+type UpdateBuilder struct {
+	dbType   DbType
+	executor SqlExecutor
+	table    string
+	columns  []string
+	values   []interface{}
+	where    whereClause
+	allRows  bool
+}
+
+//NewUpdate create an update builder not bound to a database
+func NewUpdate(pDbType DbType, pTable string) *UpdateBuilder {
+	return &UpdateBuilder{dbType: pDbType, table: pTable}
+}
+
+//Update create an update builder bound to the database
+func (vSelf *DbHelper) Update(pTable string) *UpdateBuilder {
+	return &UpdateBuilder{dbType: vSelf.GetDbType(), executor: vSelf.db, table: pTable}
+}
+
+//Update create an update builder bound to the transaction
+func (vSelf *DbHelperTx) Update(pTable string) *UpdateBuilder {
+	return &UpdateBuilder{dbType: vSelf.GetDbType(), executor: vSelf.tx, table: pTable}
+}
+
+//Set the value of a column
+func (vSelf *UpdateBuilder) Set(pColumn string, pValue interface{}) *UpdateBuilder {
+	vSelf.columns = append(vSelf.columns, pColumn)
+	vSelf.values = append(vSelf.values, pValue)
+	return vSelf
+}
+
+//Where add a condition, multiple conditions are combined in and
+func (vSelf *UpdateBuilder) Where(pCondition Condition) *UpdateBuilder {
+	vSelf.where.add(pCondition)
+	return vSelf
+}
+
+//AllRows allows an update without conditions
+func (vSelf *UpdateBuilder) AllRows() *UpdateBuilder {
+	vSelf.allRows = true
+	return vSelf
+}
+
+//Build returns the statement and its parameters
+func (vSelf *UpdateBuilder) Build() (string, []interface{}, error) {
+
+	if len(vSelf.columns) == 0 {
+		return "", nil, diagnostic.NewError("update of %s without columns", nil, vSelf.table)
+	}
+	if len(vSelf.where.conditions) == 0 && vSelf.allRows == false {
+		return "", nil, diagnostic.NewError("update of %s without conditions, use AllRows to confirm", nil, vSelf.table)
+	}
+
+	vAssignments := make([]string, len(vSelf.columns))
+	for vCnt, vCurColumn := range vSelf.columns {
+		vAssignments[vCnt] = QuoteIdentifier(vSelf.dbType, vCurColumn) + "=?"
+	}
+
+	vWhereSql, vWhereArgs := vSelf.where.build(vSelf.dbType)
+	vArgs := append(append(make([]interface{}, 0, len(vSelf.values)+len(vWhereArgs)), vSelf.values...), vWhereArgs...)
+	return "update " + QuoteIdentifier(vSelf.dbType, vSelf.table) + " set " + strings.Join(vAssignments, ",") + vWhereSql, vArgs, nil
+}
+
+//Exec execute the update
+func (vSelf *UpdateBuilder) Exec() (sql.Result, error) {
+	return execBuilt(vSelf.executor, vSelf.Build)
+}
+
+//DeleteBuilder builds delete statements
+type DeleteBuilder struct {
+	dbType   DbType
+	executor SqlExecutor
+	table    string
+	where    whereClause
+	allRows  bool
+}
+
+//NewDelete create a delete builder not bound to a database
+func NewDelete(pDbType DbType, pTable string) *DeleteBuilder {
+	return &DeleteBuilder{dbType: pDbType, table: pTable}
+}
+
+//DeleteFrom create a delete builder bound to the database
+func (vSelf *DbHelper) DeleteFrom(pTable string) *DeleteBuilder {
+	return &DeleteBuilder{dbType: vSelf.GetDbType(), executor: vSelf.db, table: pTable}
+}
+
+//DeleteFrom create a delete builder bound to the transaction
+func (vSelf *DbHelperTx) DeleteFrom(pTable string) *DeleteBuilder {
+	return &DeleteBuilder{dbType: vSelf.GetDbType(), executor: vSelf.tx, table: pTable}
+}
+
+//Where add a condition, multiple conditions are combined in and
+func (vSelf *DeleteBuilder) Where(pCondition Condition) *DeleteBuilder {
+	vSelf.where.add(pCondition)
+	return vSelf
+}
+
+//AllRows allows a delete without conditions
+func (vSelf *DeleteBuilder) AllRows() *DeleteBuilder {
+	vSelf.allRows = true
+	return vSelf
+}
+
+//Build returns the statement and its parameters
+func (vSelf *DeleteBuilder) Build() (string, []interface{}, error) {
+	if len(vSelf.where.conditions) == 0 && vSelf.allRows == false {
+		return "", nil, diagnostic.NewError("delete from %s without conditions, use AllRows to confirm", nil, vSelf.table)
+	}
+	vWhereSql, vWhereArgs := vSelf.where.build(vSelf.dbType)
+	return "delete from " + QuoteIdentifier(vSelf.dbType, vSelf.table) + vWhereSql, vWhereArgs, nil
+}
+
+//Exec execute the delete
+func (vSelf *DeleteBuilder) Exec() (sql.Result, error) {
+	return execBuilt(vSelf.executor, vSelf.Build)
+}
+
+func execBuilt(pExecutor SqlExecutor, pBuild func() (string, []interface{}, error)) (sql.Result, error) {
+
+	if pExecutor == nil {
+		return nil, diagnostic.NewError("builder not bound to a database", nil)
+	}
+
+	vStatement, vArgs, vBuildError := pBuild()
+	if vBuildError != nil {
+		return nil, vBuildError
+	}
+
+	vRis, vExecError := pExecutor.Exec(vStatement, vArgs...)
+	if vExecError != nil {
+		return nil, diagnostic.NewError("failed to execute %s", vExecError, vStatement)
+	}
+	return vRis, nil
+}
+
+func quoteIdentifiers(pDbType DbType, pIdentifiers []string) string {
+	vQuoted := make([]string, len(pIdentifiers))
+	for vCnt, vCurIdentifier := range pIdentifiers {
+		vQuoted[vCnt] = QuoteIdentifier(pDbType, vCurIdentifier)
+	}
+	return strings.Join(vQuoted, ",")
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+type builderTest struct {
+	Builder interface {
+		Build() (string, []interface{}, error)
+	}
+	Expected     string
+	ExpectedArgs []interface{}
+}
+
+var (
+	builderTests = []builderTest{
+		builderTest{
+			Builder:      NewSelect(DbType_sqlite3, "id", "t.name").From("test").Where(Eq("id", 1)).Where(Or(Like("name", "a%"), IsNull("name"))).OrderByDesc("id").Limit(10).Offset(5),
+			Expected:     `select "id","t"."name" from "test" where ("id" = ?) and (("name" like ? escape '!') or ("name" is null)) order by "id" desc limit 10 offset 5`,
+			ExpectedArgs: []interface{}{1, "a%"}},
+		builderTest{
+			Builder:      NewSelect(DbType_mysql).Expressions("count(*)").From("a").Join("b", EqColumns("a.id", "b.id")).Where(In("a.x", 1, 2)).Offset(3),
+			Expected:     "select count(*) from `a` join `b` on `a`.`id` = `b`.`id` where (`a`.`x` in (?,?)) limit 18446744073709551615 offset 3",
+			ExpectedArgs: []interface{}{1, 2}},
+		builderTest{
+			Builder:      NewSelect(DbType_sqlite3, `we"ird`).From("test").Where(StartsWith("id", "50%_")),
+			Expected:     `select "we""ird" from "test" where ("id" like ? escape '!')`,
+			ExpectedArgs: []interface{}{"50!%!_%"}},
+		builderTest{
+			Builder:      NewUpdate(DbType_mysql, "test").Set("a", 1).Set("b", "x").Where(Ne("id", 3)),
+			Expected:     "update `test` set `a`=?,`b`=? where (`id` <> ?)",
+			ExpectedArgs: []interface{}{1, "x", 3}},
+		builderTest{
+			Builder:      NewDelete(DbType_sqlite3, "test").Where(Not(In("id"))),
+			Expected:     `delete from "test" where (not (1=0))`,
+			ExpectedArgs: []interface{}{}},
+	}
+)
+
+func TestBuilders(pTest *testing.T) {
+
+	for _, vCurTest := range builderTests {
+		vStatement, vArgs, vBuildError := vCurTest.Builder.Build()
+		if vBuildError != nil {
+			pTest.Errorf("build of %s failed: %v", vCurTest.Expected, vBuildError)
+			continue
+		}
+		if vStatement != vCurTest.Expected {
+			pTest.Errorf("unexpected statement\n current  %s\n expected %s", vStatement, vCurTest.Expected)
+		}
+		if len(vArgs) != 0 || len(vCurTest.ExpectedArgs) != 0 {
+			if reflect.DeepEqual(vArgs, vCurTest.ExpectedArgs) == false {
+				pTest.Errorf("unexpected arguments of %s: %#v", vStatement, vArgs)
+			}
+		}
+	}
+
+	if _, _, vBuildError := NewDelete(DbType_sqlite3, "test").Build(); vBuildError == nil {
+		pTest.Error("delete without conditions must be confirmed")
+	}
+}
+
+func TestSqlite3Builders(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "builder")
+	vDbHelper.Exec("create table test (id integer primary key, name text)")
+	vDbHelper.Exec("insert into test values (1, 'a'), (2, 'b'), (3, 'c')")
+
+	if _, vUpdateError := vDbHelper.Update("test").Set("name", "z").Where(Ge("id", 2)).Exec(); vUpdateError != nil {
+		pTest.Fatal("update failed", vUpdateError)
+	}
+	if _, vDeleteError := vDbHelper.DeleteFrom("test").Where(Eq("id", 3)).Exec(); vDeleteError != nil {
+		pTest.Fatal("delete failed", vDeleteError)
+	}
+
+	var vRecords []testRecord
+	if vQueryError := vDbHelper.Select("id", "name").From("test").OrderBy("id").QueryStructs(&vRecords); vQueryError != nil {
+		pTest.Fatal("select failed", vQueryError)
+	}
+	if len(vRecords) != 2 || vRecords[0].Name != "a" || vRecords[1].Name != "z" {
+		pTest.Errorf("unexpected records %#v", vRecords)
+	}
+}
@@ -1,9 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
 	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/persistency"
 )
 
 type DbType string
@@ -18,7 +22,15 @@ const (
 type DbHelper struct {
 	db *sql.DB
 	dbType  DbType
+	dataSourceName string
+	beansInitLock sync.Mutex
 	beansInitialized bool
+	beansLegacyPresent bool
+	beanIndexesLock sync.RWMutex
+	beanIndexes map[string]*BeanIndex
+	beanHistoryLock sync.RWMutex
+	beanHistory map[string]bool
+	beanCodec persistency.Codec
 }
 
 func NewDbHelper(pDriver string, pDataSourceName string) (*DbHelper, error) {
@@ -29,7 +41,9 @@ func NewDbHelper(pDriver string, pDataSourceName string) (*DbHelper, error) {
 		return nil, vDbError
 	}
 
-	return NewDbHelperFor(vDb), nil
+	vRis := NewDbHelperFor(vDb)
+	vRis.dataSourceName = pDataSourceName
+	return vRis, nil
 }
 
 func NewDbHelperFor(pDb *sql.DB) *DbHelper {
@@ -70,6 +84,35 @@ func (vSelf *DbHelper) Exec(pQuery string, pParameters ...interface{}) (sql.Resu
 	return vSelf.db.Exec(pQuery,pParameters...)
 }
 
+//SqlExecutor statements execution methods shared by *sql.DB and *sql.Tx
+type SqlExecutor interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+	Query(string, ...interface{}) (*sql.Rows, error)
+	QueryRow(string, ...interface{}) *sql.Row
+	Prepare(string) (*sql.Stmt, error)
+}
+
 func (vSelf *DbHelper) Close() error {
 	return vSelf.db.Close()
 }
+
+//connExecutor adapts a dedicated connection to SqlExecutor, used when statements must share session state like temporary tables
+type connExecutor struct {
+	conn *sql.Conn
+}
+
+func (vSelf *connExecutor) Exec(pQuery string, pParameters ...interface{}) (sql.Result, error) {
+	return vSelf.conn.ExecContext(context.Background(), pQuery, pParameters...)
+}
+
+func (vSelf *connExecutor) Query(pQuery string, pParameters ...interface{}) (*sql.Rows, error) {
+	return vSelf.conn.QueryContext(context.Background(), pQuery, pParameters...)
+}
+
+func (vSelf *connExecutor) QueryRow(pQuery string, pParameters ...interface{}) *sql.Row {
+	return vSelf.conn.QueryRowContext(context.Background(), pQuery, pParameters...)
+}
+
+func (vSelf *connExecutor) Prepare(pQuery string) (*sql.Stmt, error) {
+	return vSelf.conn.PrepareContext(context.Background(), pQuery)
+}
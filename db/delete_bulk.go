@@ -0,0 +1,121 @@
+package db
+
+import (
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//SqlBulkDelete deletes rows by key, grouping keys in batches of BatchSize.
+//It follows the BulkManager life cycle: Begin, Enqueue the keys, Commit, End
+type SqlBulkDelete struct {
+	dbHelper    *DbHelper
+	executor    SqlExecutor
+	table       string
+	keyFields   []string
+	batchSize   int
+	pendingKeys [][]interface{}
+	deletedRows int64
+}
+
+//CreateBulkDelete create a bulk delete
+//Parameters:
+// pTable = target table
+// pKeyFields = columns identifying the rows to delete
+// pOptions = bulk options, only BatchSize is considered
+func (vSelf *DbHelper) CreateBulkDelete(pTable string, pKeyFields []string, pOptions BulkOptions) (*SqlBulkDelete, error) {
+	return vSelf.createBulkDelete(vSelf.db, pTable, pKeyFields, pOptions)
+}
+
+func (vSelf *DbHelperTx) CreateBulkDelete(pTable string, pKeyFields []string, pOptions BulkOptions) (*SqlBulkDelete, error) {
+	return vSelf.dbHelper.createBulkDelete(vSelf.tx, pTable, pKeyFields, pOptions)
+}
+
+func (vSelf *DbHelper) createBulkDelete(pExecutor SqlExecutor, pTable string, pKeyFields []string, pOptions BulkOptions) (*SqlBulkDelete, error) {
+
+	if len(pKeyFields) == 0 {
+		return nil, diagnostic.NewError("bulk delete from %s without key fields", nil, pTable)
+	}
+
+	vBatchSize := pOptions.BatchSize
+	if vBatchSize < 1 {
+		vBatchSize = BulkInsert_DefaultBatchSize
+	}
+
+	return &SqlBulkDelete{dbHelper: vSelf, executor: pExecutor, table: pTable, keyFields: pKeyFields, batchSize: limitBatchSize(vSelf.GetDbType(), vBatchSize, len(pKeyFields))}, nil
+}
+
+func (vSelf *SqlBulkDelete) Begin() error {
+	vSelf.pendingKeys = make([][]interface{}, 0, vSelf.batchSize)
+	vSelf.deletedRows = 0
+	return nil
+}
+
+//Enqueue the key of a row to delete
+//Parameters:
+// pKey = values of the key fields, in the same order
+func (vSelf *SqlBulkDelete) Enqueue(pKey ...interface{}) error {
+
+	if len(pKey) != len(vSelf.keyFields) {
+		return diagnostic.NewError("bulk delete from %s expects %d key values, got %d", nil, vSelf.table, len(vSelf.keyFields), len(pKey))
+	}
+
+	vKey := make([]interface{}, len(pKey))
+	copy(vKey, pKey)
+	vSelf.pendingKeys = append(vSelf.pendingKeys, vKey)
+
+	if len(vSelf.pendingKeys) == vSelf.batchSize {
+		diagnostic.LogDebug("SqlBulkDelete.Enqueue", "BulkDelete batch size of %d reached, forcing commit", vSelf.batchSize)
+		return vSelf.Commit()
+	}
+	return nil
+}
+
+func (vSelf *SqlBulkDelete) Commit() error {
+
+	if len(vSelf.pendingKeys) == 0 {
+		return nil
+	}
+
+	var vCondition Condition
+	if len(vSelf.keyFields) == 1 {
+		vValues := make([]interface{}, len(vSelf.pendingKeys))
+		for vCnt, vCurKey := range vSelf.pendingKeys {
+			vValues[vCnt] = vCurKey[0]
+		}
+		vCondition = In(vSelf.keyFields[0], vValues...)
+	} else {
+		vKeyConditions := make([]Condition, len(vSelf.pendingKeys))
+		for vCnt, vCurKey := range vSelf.pendingKeys {
+			vFieldConditions := make([]Condition, len(vSelf.keyFields))
+			for vCntField, vCurField := range vSelf.keyFields {
+				vFieldConditions[vCntField] = Eq(vCurField, vCurKey[vCntField])
+			}
+			vKeyConditions[vCnt] = And(vFieldConditions...)
+		}
+		vCondition = Or(vKeyConditions...)
+	}
+
+	vDelete := NewDelete(vSelf.dbHelper.GetDbType(), vSelf.table).Where(vCondition)
+	vResult, vDeleteError := execBuilt(vSelf.executor, vDelete.Build)
+	if vDeleteError != nil {
+		return diagnostic.NewError("Failed to bulk delete data", vDeleteError)
+	}
+
+	if vAffected, vAffectedError := vResult.RowsAffected(); vAffectedError == nil {
+		vSelf.deletedRows += vAffected
+	}
+	vSelf.pendingKeys = make([][]interface{}, 0, vSelf.batchSize)
+	return nil
+}
+
+func (vSelf *SqlBulkDelete) End() error {
+	vCommitError := vSelf.Commit()
+	if vCommitError != nil {
+		return diagnostic.NewError("Commit failed", vCommitError)
+	}
+	return nil
+}
+
+//GetDeletedRowsCount returns the number of rows deleted since Begin
+func (vSelf *SqlBulkDelete) GetDeletedRowsCount() int64 {
+	return vSelf.deletedRows
+}
@@ -9,12 +9,16 @@ import (
 
 type SqlInsert struct {
 	dbHelper  *DbHelper
+	executor  SqlExecutor
+	transaction *DbHelperTx
 	table     string
 	fields    []string
 	statement *sql.Stmt
 	options   InsertOptions
 	bulkManager  BulkManager
 	mutex *sync.Mutex
+	mapping *structMapping
+	rejects *bulkRejects
 }
 
 type InsertOptions struct {
@@ -61,20 +65,80 @@ func BuildInsertStatementString(pDbType DbType, pTable string, pFields []string,
 }
 
 func (vSelf *DbHelper) CreateInsert(pTable string, pFields []string, pOptions InsertOptions) (*SqlInsert, error) {
+	return vSelf.createInsert(vSelf.db, nil, pTable, pFields, pOptions)
+}
+
+func (vSelf *DbHelper) createInsert(pExecutor SqlExecutor, pTransaction *DbHelperTx, pTable string, pFields []string, pOptions InsertOptions) (*SqlInsert, error) {
 
 	vStatementString, vStatementStringError := BuildInsertStatementString(vSelf.GetDbType(), pTable, pFields, pOptions)
 	if vStatementStringError != nil {
 		return nil, diagnostic.NewError("failed to build insert statement", vStatementStringError)
 	}
 
-	vStatement, vStatementError := vSelf.GetDb().Prepare(vStatementString)
+	vStatement, vStatementError := pExecutor.Prepare(vStatementString)
 	if vStatementError != nil {
 		return nil, diagnostic.NewError("failed to prepare insert statement %s", vStatementError, vStatementString)
 	}
 
-	return &SqlInsert{dbHelper: vSelf, table: pTable, options: pOptions, statement: vStatement, fields: pFields, mutex: &sync.Mutex{}},nil
+	return &SqlInsert{dbHelper: vSelf, executor: pExecutor, transaction: pTransaction, table: pTable, options: pOptions, statement: vStatement, fields: pFields, mutex: &sync.Mutex{}},nil
+}
+
+
+//CreateInsertFor create an insert whose fields are derived from a struct type (see StructTag_Db)
+//Parameters:
+// pTable = target table
+// pSample = a struct, or a pointer to struct, of the type that will be inserted through ExecStruct
+// pOptions = insert options
+func (vSelf *DbHelper) CreateInsertFor(pTable string, pSample interface{}, pOptions InsertOptions) (*SqlInsert, error) {
+	return vSelf.createInsertFor(vSelf.db, nil, pTable, pSample, pOptions)
+}
+
+func (vSelf *DbHelper) createInsertFor(pExecutor SqlExecutor, pTransaction *DbHelperTx, pTable string, pSample interface{}, pOptions InsertOptions) (*SqlInsert, error) {
+
+	vSampleValue, vSampleError := indirectStruct(pSample)
+	if vSampleError != nil {
+		return nil, diagnostic.NewError("invalid sample for insert into %s", vSampleError, pTable)
+	}
+
+	vMapping, vMappingError := getStructMapping(vSampleValue.Type())
+	if vMappingError != nil {
+		return nil, diagnostic.NewError("failed to map struct for insert into %s", vMappingError, pTable)
+	}
+
+	vRis, vInsertError := vSelf.createInsert(pExecutor, pTransaction, pTable, vMapping.getColumns(), pOptions)
+	if vInsertError != nil {
+		return nil, vInsertError
+	}
+	vRis.mapping = vMapping
+	return vRis, nil
+}
+
+//ExecStruct insert a struct of the type used to create the insert by CreateInsertFor.
+//As Exec, during a bulk the row is enqueued
+//Parameters:
+// pValue = struct or pointer to struct to insert
+func (vSelf *SqlInsert) ExecStruct(pValue interface{}) (sql.Result, error) {
+
+	if vSelf.mapping == nil {
+		return nil, diagnostic.NewError("insert into %s has not been created by CreateInsertFor", nil, vSelf.table)
+	}
+
+	vValue, vValueError := indirectStruct(pValue)
+	if vValueError != nil {
+		return nil, diagnostic.NewError("invalid value for insert into %s", vValueError, vSelf.table)
+	}
+
+	if vValue.Type() != vSelf.mapping.structType {
+		return nil, diagnostic.NewError("insert into %s expects %v, got %v", nil, vSelf.table, vSelf.mapping.structType, vValue.Type())
+	}
+
+	return vSelf.Exec(vSelf.mapping.getValues(vValue)...)
 }
 
+//GetFields returns the fields of the insert
+func (vSelf *SqlInsert) GetFields() []string {
+	return vSelf.fields
+}
 
 func (vSelf *SqlInsert) Exec(pParameters ...interface{}) (sql.Result, error) {
 
@@ -98,6 +162,7 @@ func (vSelf *SqlInsert) BeginBulk(pBulkOptions BulkOptions) (bool,error) {
 
 	diagnostic.LogDebug("SqlInsert.BeginBulk", "Starting bulk insert on %s table", vSelf.table)
 
+	vSelf.rejects = &bulkRejects{options: pBulkOptions}
 	vBulkManager,vBulkManagerError:= BuildBulkManager(vSelf,pBulkOptions)
 	if vBulkManagerError != nil {
 		return false,diagnostic.NewError("Error creating bulk manager",vBulkManagerError)
@@ -138,9 +203,38 @@ func (vSelf *SqlInsert) EndBulk() (error) {
 		return diagnostic.NewError("EndBulk failed",vEndBulkError)
 	}
 	vSelf.bulkManager=nil
+
+	vCloseRejectsError:= vSelf.rejects.close()
+	if vCloseRejectsError != nil {
+		return diagnostic.NewError("Failed to close reject file",vCloseRejectsError)
+	}
 	return nil
 }
 
+//GetRejectedRowsCount returns the number of rows rejected by the row recovery during the last bulk
+func (vSelf *SqlInsert) GetRejectedRowsCount() int {
+	if vSelf.rejects == nil {
+		return 0
+	}
+	return vSelf.rejects.getCount()
+}
+
+//rejectRow reject a single failed row when the row recovery is enabled
+func (vSelf *SqlInsert) rejectRow(pRow []interface{}, pRowError error) error {
+	if vSelf.rejects == nil || vSelf.rejects.options.RowRecovery == BulkRowRecovery_None {
+		return pRowError
+	}
+	return vSelf.rejects.reject(pRow, pRowError)
+}
+
+//recoverBatch apply the row recovery of the current bulk to a failed batch
+func (vSelf *SqlInsert) recoverBatch(pRows [][]interface{}, pBatchError error, pInsertRows bulkRowsFunc) error {
+	if vSelf.rejects == nil {
+		return pBatchError
+	}
+	return vSelf.rejects.recoverBatch(pRows, pBatchError, pInsertRows)
+}
+
 func (vSelf *SqlInsert) Close() error {
 
 	if vSelf.bulkManager != nil  {
@@ -159,6 +253,11 @@ func (vSelf *SqlInsert) Close() error {
 
 }
 
+//IsInTransaction returns true if the insert has been created inside a transaction
+func (vSelf *SqlInsert) IsInTransaction() bool {
+	return vSelf.transaction != nil
+}
+
 func (vSelf *SqlInsert) Lock() {
 	vSelf.mutex.Lock()
 }
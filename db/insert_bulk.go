@@ -15,11 +15,40 @@ type BulkManager interface {
 
 const (
 	BulkInsert_DefaultBatchSize = 100
+	BulkInsert_DefaultWorkers = 4
+)
+
+//BulkMode strategy used to perform a bulk insert
+type BulkMode string
+
+const (
+	//BulkMode_Default in memory staging table for sqlite, multi rows inserts otherwise
+	BulkMode_Default BulkMode = ""
+	//BulkMode_MultiRows inserts of BatchSize rows per statement
+	BulkMode_MultiRows BulkMode = "multirows"
+	//BulkMode_InMemory rows are staged in an in memory table then copied in the target table every BatchSize rows
+	BulkMode_InMemory BulkMode = "inmemory"
+	//BulkMode_LoadData rows are streamed to mysql through LOAD DATA LOCAL INFILE
+	BulkMode_LoadData BulkMode = "loaddata"
+	//BulkMode_Transactional single row inserts committed in a transaction every BatchSize rows, the fastest path for sqlite
+	BulkMode_Transactional BulkMode = "transactional"
+	//BulkMode_Parallel multi rows inserts executed concurrently by Workers connections
+	BulkMode_Parallel BulkMode = "parallel"
 )
 
 type BulkOptions struct {
 	BatchSize int
 	BulkManager BulkManager
+	Mode BulkMode
+	//Workers number of concurrent workers of BulkMode_Parallel, default BulkInsert_DefaultWorkers
+	Workers int
+	//RowRecovery strategy to isolate the rows of a failed batch, the other rows are inserted.
+	//Not supported by BulkMode_InMemory and BulkMode_LoadData
+	RowRecovery BulkRowRecovery
+	//OnRejectedRow optional, invoked for each row rejected by the row recovery
+	OnRejectedRow RejectedRowFunc
+	//RejectFile optional, file where rejected rows are appended with the error
+	RejectFile string
 }
 
 func BuildBulkManager(pParent *SqlInsert, pBulkOptions BulkOptions) (BulkManager, error) {
@@ -33,9 +62,40 @@ func BuildBulkManager(pParent *SqlInsert, pBulkOptions BulkOptions) (BulkManager
 		vBatchSize = BulkInsert_DefaultBatchSize
 	}
 
+	if pBulkOptions.RowRecovery != BulkRowRecovery_None {
+		switch pBulkOptions.Mode {
+			case BulkMode_InMemory, BulkMode_LoadData:
+				return nil, diagnostic.NewError("row recovery not supported by bulk mode %s", nil, pBulkOptions.Mode)
+			case BulkMode_Default:
+				if pParent.dbHelper.GetDbType() == DbType_sqlite3 {
+					return NewBulkManagerTransactional(pParent, vBatchSize)
+				}
+		}
+	}
+
+	switch pBulkOptions.Mode {
+		case BulkMode_MultiRows:
+			return NewBulkManagerMultiRows(pParent, vBatchSize)
+		case BulkMode_InMemory:
+			return NewBulkManagerInMemory(pParent, vBatchSize)
+		case BulkMode_LoadData:
+			return NewBulkManagerLoadData(pParent, vBatchSize)
+		case BulkMode_Transactional:
+			return NewBulkManagerTransactional(pParent, vBatchSize)
+		case BulkMode_Parallel:
+			return NewBulkManagerParallel(pParent, vBatchSize, pBulkOptions.Workers)
+		case BulkMode_Default:
+		default:
+			return nil, diagnostic.NewError("unknown bulk mode %s", nil, pBulkOptions.Mode)
+	}
+
 	switch pParent.dbHelper.GetDbType() {
 
 		case DbType_sqlite3:
+			if pParent.IsInTransaction() {
+				//sqlite doesn't allow to attach the in memory database inside a transaction
+				return NewBulkManagerMultiRows(pParent, vBatchSize)
+			}
 			return NewBulkManagerInMemory(pParent, vBatchSize)	
 		default:
 			return NewBulkManagerMultiRows(pParent, vBatchSize)	
@@ -52,19 +112,25 @@ type BulkManagerMultiRows struct {
 
 func NewBulkManagerMultiRows(pParent *SqlInsert, pBatchSize int) (BulkManager, error) {
 
-	vBatchSize:= pBatchSize
-	if pParent.dbHelper.GetDbType() == DbType_sqlite3 {
-		if (pBatchSize*len(pParent.fields) > 999) {
-			vBatchSize = 999 / len(pParent.fields)
-			diagnostic.LogWarning("NewBulkManagerMultiRows","Batch size reduced to %d",nil,vBatchSize)
-		}
-	}
+	vBatchSize:= limitBatchSize(pParent.dbHelper.GetDbType(), pBatchSize, len(pParent.fields))
  
 	vRis:= &BulkManagerMultiRows{parent:pParent,batchSize:vBatchSize}
 	return vRis,nil
 	
 }
 
+//limitBatchSize reduce the number of rows per statement to respect the parameters limit of the database
+func limitBatchSize(pDbType DbType, pBatchSize int, pParametersPerRow int) int {
+	if pDbType == DbType_sqlite3 && pParametersPerRow > 0 {
+		if (pBatchSize*pParametersPerRow > 999) {
+			vBatchSize := 999 / pParametersPerRow
+			diagnostic.LogWarning("limitBatchSize","Batch size reduced to %d",nil,vBatchSize)
+			return vBatchSize
+		}
+	}
+	return pBatchSize
+}
+
 func (vSelf *BulkManagerMultiRows) Begin() error {
 	
 	vStatementString, vStatementStringError := BuildInsertStatementString(vSelf.parent.dbHelper.GetDbType(), vSelf.parent.table, vSelf.parent.fields,InsertOptions{Replace:vSelf.parent.options.Replace, NumberOfAdditionalRows: vSelf.batchSize -1} )
@@ -72,7 +138,7 @@ func (vSelf *BulkManagerMultiRows) Begin() error {
 		return diagnostic.NewError("failed to build insert statement", vStatementStringError)
 	}
 
-	vStatement, vStatementError := vSelf.parent.dbHelper.GetDb().Prepare(vStatementString)
+	vStatement, vStatementError := vSelf.parent.executor.Prepare(vStatementString)
         if vStatementError != nil {
                 return diagnostic.NewError("failed to prepare insert statement %s", vStatementError, vStatementString)
         }
@@ -102,6 +168,9 @@ func (vSelf *BulkManagerMultiRows) Commit() error {
 	if vSelf.pendingRowsCount == vSelf.batchSize {
 
 		_,vInsertError := vSelf.insertStatement.Exec(vSelf.pendingRows...)
+		if vInsertError != nil {
+			vInsertError = vSelf.recoverBatch(vInsertError)
+		}
 		if vInsertError != nil {
 			return diagnostic.NewError("Failed to bulk insert data",vInsertError)
 		}
@@ -112,7 +181,10 @@ func (vSelf *BulkManagerMultiRows) Commit() error {
 			return diagnostic.NewError("failed to build insert statement", vStatementStringError)
 		}
 
-		_,vInsertError := vSelf.parent.dbHelper.Exec(vStatementString,vSelf.pendingRows...)
+		_,vInsertError := vSelf.parent.executor.Exec(vStatementString,vSelf.pendingRows...)
+		if vInsertError != nil {
+			vInsertError = vSelf.recoverBatch(vInsertError)
+		}
 		if vInsertError != nil {
 			return diagnostic.NewError("Failed to bulk insert data",vInsertError)
 		}
@@ -122,6 +194,13 @@ func (vSelf *BulkManagerMultiRows) Commit() error {
 	return nil
 }
 
+func (vSelf *BulkManagerMultiRows) recoverBatch(pBatchError error) error {
+	return vSelf.parent.recoverBatch(splitRows(vSelf.pendingRows, len(vSelf.parent.fields)), pBatchError, vSelf.parent.insertRowsFunc(func(pStatement string, pParameters ...interface{}) error {
+		_, vInsertError := vSelf.parent.executor.Exec(pStatement, pParameters...)
+		return vInsertError
+	}))
+}
+
 func (vSelf *BulkManagerMultiRows) End() error {
 	vCommitError:= vSelf.Commit()
 	if vCommitError != nil {
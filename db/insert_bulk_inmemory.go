@@ -29,9 +29,9 @@ func (vSelf *BulkManagerInMemory) Begin() error {
 
 			vSelf.parent.dbHelper.SetMaxOpenConns(1)
 
-			vSelf.parent.dbHelper.Exec("ATTACH DATABASE ':memory:' AS __memorydb")
+			vSelf.parent.executor.Exec("ATTACH DATABASE ':memory:' AS __memorydb")
 		
-			_,vCreateTableError:=vSelf.parent.dbHelper.GetDb().Exec("CREATE TABLE IF NOT EXISTS __memorydb."+vSelf.parent.table+"_bulk as select * from "+vSelf.parent.table+" where 2=1")
+			_,vCreateTableError:=vSelf.parent.executor.Exec("CREATE TABLE IF NOT EXISTS __memorydb."+vSelf.parent.table+"_bulk as select * from "+vSelf.parent.table+" where 2=1")
 			if vCreateTableError != nil {
 				return diagnostic.NewError("An error occurred while creating temp table", vCreateTableError)
 			}
@@ -42,12 +42,12 @@ func (vSelf *BulkManagerInMemory) Begin() error {
 			}
 
 			var vInsertStatementError error
-			vInsertStatement, vInsertStatementError = vSelf.parent.dbHelper.GetDb().Prepare(vStatementString)
+			vInsertStatement, vInsertStatementError = vSelf.parent.executor.Prepare(vStatementString)
 			if vInsertStatementError != nil {
 				return diagnostic.NewError("failed to prepare insert statement %s", vInsertStatementError, vStatementString)
 			}
 		case DbType_mysql:
-			_,vCreateTableError:=vSelf.parent.dbHelper.GetDb().Exec("CREATE TABLE IF NOT EXISTS "+vSelf.parent.table+"_bulk ENGINE=MEMORY as select * from "+vSelf.parent.table+" where 2=1")
+			_,vCreateTableError:=vSelf.parent.executor.Exec("CREATE TABLE IF NOT EXISTS "+vSelf.parent.table+"_bulk ENGINE=MEMORY as select * from "+vSelf.parent.table+" where 2=1")
 			if vCreateTableError != nil {
 				return diagnostic.NewError("An error occurred while creating temp table", vCreateTableError)
 			}
@@ -58,7 +58,7 @@ func (vSelf *BulkManagerInMemory) Begin() error {
 			}
 
 			var vInsertStatementError error
-			vInsertStatement, vInsertStatementError = vSelf.parent.dbHelper.GetDb().Prepare(vStatementString)
+			vInsertStatement, vInsertStatementError = vSelf.parent.executor.Prepare(vStatementString)
 			if vInsertStatementError != nil {
 				return diagnostic.NewError("failed to prepare insert statement %s", vInsertStatementError, vStatementString)
 			}
@@ -107,12 +107,12 @@ func (vSelf *BulkManagerInMemory) Commit() error {
 				vInsertModifiers = " or replace "
 			}
 
-			_,vCommitError:=vSelf.parent.dbHelper.GetDb().Exec("insert "+vInsertModifiers+" into "+vSelf.parent.table+" select * from   __memorydb."+vSelf.parent.table+"_bulk")
+			_,vCommitError:=vSelf.parent.executor.Exec("insert "+vInsertModifiers+" into "+vSelf.parent.table+" select * from   __memorydb."+vSelf.parent.table+"_bulk")
 			if vCommitError != nil {
 				return diagnostic.NewError("An error occurred while commit bulk", vCommitError)
 			}
 
-			_,vDeleteError:=vSelf.parent.dbHelper.GetDb().Exec("delete from  __memorydb."+vSelf.parent.table+"_bulk")
+			_,vDeleteError:=vSelf.parent.executor.Exec("delete from  __memorydb."+vSelf.parent.table+"_bulk")
 			if vDeleteError != nil {
 				return diagnostic.NewError("An error occurred while cleaning temp table during commit", vDeleteError)
 			}
@@ -124,12 +124,12 @@ func (vSelf *BulkManagerInMemory) Commit() error {
 				vInsertPrefix = "insert into "
 			}
 
-			_,vCommitError:=vSelf.parent.dbHelper.GetDb().Exec(vInsertPrefix+" into "+vSelf.parent.table+" select * from  "+vSelf.parent.table+"_bulk")
+			_,vCommitError:=vSelf.parent.executor.Exec(vInsertPrefix+" into "+vSelf.parent.table+" select * from  "+vSelf.parent.table+"_bulk")
 			if vCommitError != nil {
 				return diagnostic.NewError("An error occurred while commit bulk", vCommitError)
 			}
 
-			_,vDeleteError:=vSelf.parent.dbHelper.GetDb().Exec("delete from "+vSelf.parent.table+"_bulk")
+			_,vDeleteError:=vSelf.parent.executor.Exec("delete from "+vSelf.parent.table+"_bulk")
 			if vDeleteError != nil {
 				return diagnostic.NewError("An error occurred while cleaning temp table during commit", vDeleteError)
 			}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mysinmyc/gocommons/concurrent"
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+var (
+	_LoadDataReadersCounter = concurrent.NewCounter()
+	_LoadDataEscaper        = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r", "\x00", "\\0")
+	_LoadDataHandlersLock   sync.RWMutex
+	_LoadDataRegister       func(string, func() io.Reader)
+	_LoadDataDeregister     func(string)
+	_LoadDataLocation       func(string) (*time.Location, error)
+)
+
+//SetLoadDataReaderHandlers sets the functions of the mysql driver streaming readers to LOAD DATA LOCAL INFILE 'Reader::name'.
+//They are set by importing github.com/mysinmyc/gocommons/db/loaddata, so the driver is linked only by the programs using BulkMode_LoadData
+//Parameters:
+// pRegister = registers a reader by name, usually mysql.RegisterReaderHandler
+// pDeregister = deregisters a reader, usually mysql.DeregisterReaderHandler
+func SetLoadDataReaderHandlers(pRegister func(string, func() io.Reader), pDeregister func(string)) {
+	_LoadDataHandlersLock.Lock()
+	defer _LoadDataHandlersLock.Unlock()
+	_LoadDataRegister = pRegister
+	_LoadDataDeregister = pDeregister
+}
+
+//SetLoadDataLocationResolver sets the function returning the time zone of the mysql connections, the driver converts
+//time values into it (loc parameter). It is set by importing github.com/mysinmyc/gocommons/db/loaddata
+//Parameters:
+// pResolver = returns the location of a data source name
+func SetLoadDataLocationResolver(pResolver func(string) (*time.Location, error)) {
+	_LoadDataHandlersLock.Lock()
+	defer _LoadDataHandlersLock.Unlock()
+	_LoadDataLocation = pResolver
+}
+
+//loadDataLocation returns the time zone of the connections, UTC (the default of the driver) if the data source name
+//is unknown, like for helpers created by NewDbHelperFor
+func (vSelf *DbHelper) loadDataLocation() (*time.Location, error) {
+	_LoadDataHandlersLock.RLock()
+	vResolver := _LoadDataLocation
+	_LoadDataHandlersLock.RUnlock()
+	if vResolver == nil || vSelf.dataSourceName == "" {
+		return time.UTC, nil
+	}
+	return vResolver(vSelf.dataSourceName)
+}
+
+//BulkManagerLoadData streams rows to mysql through LOAD DATA LOCAL INFILE, every batchSize rows the load is completed.
+//The server must allow local_infile and the program must import github.com/mysinmyc/gocommons/db/loaddata
+type BulkManagerLoadData struct {
+	parent           *SqlInsert
+	batchSize        int
+	pendingRowsCount int
+	readerName       string
+	statement        string
+	pipeWriter       *io.PipeWriter
+	buffer           *bufio.Writer
+	rowBuffer        bytes.Buffer
+	loadResult       chan error
+	location         *time.Location
+	register         func(string, func() io.Reader)
+	deregister       func(string)
+}
+
+func NewBulkManagerLoadData(pParent *SqlInsert, pBatchSize int) (BulkManager, error) {
+
+	if pParent.dbHelper.GetDbType() != DbType_mysql {
+		return nil, diagnostic.NewError("LOAD DATA bulk not supported for dbType %s", nil, pParent.dbHelper.GetDbType())
+	}
+
+	_LoadDataHandlersLock.RLock()
+	vRegister, vDeregister := _LoadDataRegister, _LoadDataDeregister
+	_LoadDataHandlersLock.RUnlock()
+	if vRegister == nil || vDeregister == nil {
+		return nil, diagnostic.NewError("LOAD DATA bulk requires importing github.com/mysinmyc/gocommons/db/loaddata", nil)
+	}
+
+	vLocation, vLocationError := pParent.dbHelper.loadDataLocation()
+	if vLocationError != nil {
+		return nil, diagnostic.NewError("failed to read the time zone of the connections", vLocationError)
+	}
+
+	vRis := &BulkManagerLoadData{parent: pParent, batchSize: pBatchSize, location: vLocation, register: vRegister, deregister: vDeregister}
+	return vRis, nil
+}
+
+func (vSelf *BulkManagerLoadData) Begin() error {
+
+	vSelf.readerName = "gocommons_bulk_" + strconv.FormatInt(int64(_LoadDataReadersCounter.IncreaseBy(1)), 10)
+
+	vModifier := ""
+	if vSelf.parent.options.Replace {
+		vModifier = "REPLACE "
+	}
+	vSelf.statement = "LOAD DATA LOCAL INFILE 'Reader::" + vSelf.readerName + "' " + vModifier + "INTO TABLE " + QuoteIdentifier(DbType_mysql, vSelf.parent.table) +
+		` CHARACTER SET binary FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (` + quoteIdentifiers(DbType_mysql, vSelf.parent.fields) + ")"
+	return nil
+}
+
+//beginBatch starts the LOAD DATA statement in background, reading rows from a pipe
+func (vSelf *BulkManagerLoadData) beginBatch() {
+
+	vPipeReader, vPipeWriter := io.Pipe()
+	vSelf.register(vSelf.readerName, func() io.Reader {
+		return vPipeReader
+	})
+
+	vSelf.pipeWriter = vPipeWriter
+	vSelf.buffer = bufio.NewWriterSize(vPipeWriter, 64*1024)
+	vSelf.loadResult = make(chan error, 1)
+
+	go func() {
+		_, vLoadError := vSelf.parent.executor.Exec(vSelf.statement)
+		//unblock the writer in case the statement failed before reading all the data
+		if vLoadError != nil {
+			vPipeReader.CloseWithError(vLoadError)
+		} else {
+			vPipeReader.Close()
+		}
+		vSelf.loadResult <- vLoadError
+	}()
+}
+
+func (vSelf *BulkManagerLoadData) Enqueue(pParameters ...interface{}) error {
+
+	if vSelf.pipeWriter == nil {
+		vSelf.beginBatch()
+	}
+
+	//the row is formatted apart to avoid streaming partial rows
+	vSelf.rowBuffer.Reset()
+	for vCnt, vCurParameter := range pParameters {
+		if vCnt > 0 {
+			vSelf.rowBuffer.WriteByte('\t')
+		}
+		vFormatError := writeLoadDataValue(&vSelf.rowBuffer, vCurParameter, vSelf.location)
+		if vFormatError != nil {
+			return diagnostic.NewError("failed to format value %v", vFormatError, vCurParameter)
+		}
+	}
+	vSelf.rowBuffer.WriteByte('\n')
+
+	_, vWriteError := vSelf.buffer.Write(vSelf.rowBuffer.Bytes())
+	if vWriteError != nil {
+		return diagnostic.NewError("Error during insert bulk", vWriteError)
+	}
+	vSelf.pendingRowsCount++
+
+	if vSelf.pendingRowsCount == vSelf.batchSize {
+		diagnostic.LogDebug("BulkManagerLoadData.Enqueue", "BulkInsert batch size of %d reached, forcing commit", vSelf.batchSize)
+		return vSelf.Commit()
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerLoadData) Commit() error {
+
+	if vSelf.pipeWriter == nil {
+		return nil
+	}
+
+	vFlushError := vSelf.buffer.Flush()
+	vSelf.pipeWriter.Close()
+	vLoadError := <-vSelf.loadResult
+	vSelf.deregister(vSelf.readerName)
+	vSelf.pipeWriter = nil
+	vSelf.buffer = nil
+	vSelf.pendingRowsCount = 0
+
+	if vLoadError != nil {
+		return diagnostic.NewError("An error occurred while loading data", vLoadError)
+	}
+	if vFlushError != nil {
+		return diagnostic.NewError("An error occurred while streaming data", vFlushError)
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerLoadData) End() error {
+	vCommitError := vSelf.Commit()
+	if vCommitError != nil {
+		return diagnostic.NewError("Commit failed", vCommitError)
+	}
+	return nil
+}
+
+//writeLoadDataValue writes a value in the LOAD DATA text format
+//Parameters:
+// pLocation = time zone of the connection, times are converted like the driver does with statement parameters. nil to keep their zone
+func writeLoadDataValue(pWriter *bytes.Buffer, pValue interface{}, pLocation *time.Location) error {
+
+	//same conversions applied by database/sql to statement parameters (pointers, Valuer, numeric types...)
+	vDriverValue, vConvertError := driver.DefaultParameterConverter.ConvertValue(pValue)
+	if vConvertError != nil {
+		return vConvertError
+	}
+
+	var vError error
+	switch vValue := vDriverValue.(type) {
+	case nil:
+		_, vError = pWriter.WriteString(`\N`)
+	case []byte:
+		_, vError = _LoadDataEscaper.WriteString(pWriter, string(vValue))
+	case string:
+		_, vError = _LoadDataEscaper.WriteString(pWriter, vValue)
+	case bool:
+		if vValue {
+			_, vError = pWriter.WriteString("1")
+		} else {
+			_, vError = pWriter.WriteString("0")
+		}
+	case time.Time:
+		if vValue.IsZero() {
+			_, vError = pWriter.WriteString("0000-00-00")
+			break
+		}
+		if pLocation != nil {
+			vValue = vValue.In(pLocation)
+		}
+		_, vError = pWriter.WriteString(vValue.Format("2006-01-02 15:04:05.999999"))
+	case int64:
+		_, vError = pWriter.WriteString(strconv.FormatInt(vValue, 10))
+	case float64:
+		_, vError = pWriter.WriteString(strconv.FormatFloat(vValue, 'g', -1, 64))
+	default:
+		_, vError = _LoadDataEscaper.WriteString(pWriter, fmt.Sprint(vValue))
+	}
+	return vError
+}
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/concurrent"
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//BulkBatchError failure of a batch of rows
+type BulkBatchError struct {
+	Rows  [][]interface{}
+	Cause error
+}
+
+func (vSelf *BulkBatchError) Error() string {
+	return fmt.Sprintf("failed to insert batch of %d rows: %v", len(vSelf.Rows), vSelf.Cause)
+}
+
+//BulkParallelError collects the batches failed during a parallel bulk
+type BulkParallelError struct {
+	Failures []*BulkBatchError
+}
+
+func (vSelf *BulkParallelError) Error() string {
+	vRows := 0
+	for _, vCurFailure := range vSelf.Failures {
+		vRows += len(vCurFailure.Rows)
+	}
+	return fmt.Sprintf("%d batches failed (%d rows), first error: %v", len(vSelf.Failures), vRows, vSelf.Failures[0].Cause)
+}
+
+//GetBulkBatchErrors returns the failed batches of a parallel bulk, nil if the error has a different cause
+func GetBulkBatchErrors(pError error) []*BulkBatchError {
+	vParallelError, vIsParallelError := diagnostic.GetMainError(pError, false).(*BulkParallelError)
+	if vIsParallelError == false {
+		return nil
+	}
+	return vParallelError.Failures
+}
+
+//BulkManagerParallel distributes batches of rows to a dispatcher, each worker inserts them using a dedicated connection.
+//Enqueue is safe for concurrent use
+type BulkManagerParallel struct {
+	parent       *SqlInsert
+	batchSize    int
+	workers      int
+	pendingLock  sync.Mutex
+	pendingRows  [][]interface{}
+	dispatcher   *concurrent.Dispatcher
+	failuresLock sync.Mutex
+	failures     []*BulkBatchError
+}
+
+type bulkParallelWorkerLocals struct {
+	conn            *sql.Conn
+	insertStatement *sql.Stmt
+	initError       error
+}
+
+func NewBulkManagerParallel(pParent *SqlInsert, pBatchSize int, pWorkers int) (BulkManager, error) {
+
+	if pParent.IsInTransaction() {
+		return nil, diagnostic.NewError("parallel bulk not supported inside a transaction", nil)
+	}
+
+	vWorkers := pWorkers
+	if vWorkers < 1 {
+		vWorkers = BulkInsert_DefaultWorkers
+	}
+
+	vRis := &BulkManagerParallel{parent: pParent, batchSize: limitBatchSize(pParent.dbHelper.GetDbType(), pBatchSize, len(pParent.fields)), workers: vWorkers}
+	return vRis, nil
+}
+
+func (vSelf *BulkManagerParallel) Begin() error {
+	vSelf.pendingRows = make([][]interface{}, 0, vSelf.batchSize)
+	vSelf.dispatcher = concurrent.NewDispatcher(vSelf.insertBatch, 1)
+	vSelf.dispatcher.WorkerLifeCycleHandlerFunc = vSelf.workerLifeCycle
+	vSelf.dispatcher.SetErrorHandler(vSelf.onBatchError)
+	return nil
+}
+
+func (vSelf *BulkManagerParallel) workerLifeCycle(pDispatcher *concurrent.Dispatcher, pWorker int, pEvent concurrent.WorkerLifeCycleEvent, pWorkerLocals concurrent.WorkerLocals) (concurrent.WorkerLocals, error) {
+
+	switch pEvent {
+	case concurrent.WorkerLifeCycleEvent_Started:
+		//initialization errors are reported on each batch, a failed worker would leave items in the dispatcher
+		vLocals := &bulkParallelWorkerLocals{}
+		vConn, vConnError := vSelf.parent.dbHelper.GetDb().Conn(context.Background())
+		if vConnError != nil {
+			vLocals.initError = diagnostic.NewError("worker %d failed to obtain a connection", vConnError, pWorker)
+			return vLocals, nil
+		}
+		vLocals.conn = vConn
+
+		vStatementString, vStatementStringError := BuildInsertStatementString(vSelf.parent.dbHelper.GetDbType(), vSelf.parent.table, vSelf.parent.fields, InsertOptions{Replace: vSelf.parent.options.Replace, NumberOfAdditionalRows: vSelf.batchSize - 1})
+		if vStatementStringError != nil {
+			vLocals.initError = diagnostic.NewError("failed to build insert statement", vStatementStringError)
+			return vLocals, nil
+		}
+		vStatement, vStatementError := vConn.PrepareContext(context.Background(), vStatementString)
+		if vStatementError != nil {
+			vLocals.initError = diagnostic.NewError("failed to prepare insert statement %s", vStatementError, vStatementString)
+			return vLocals, nil
+		}
+		vLocals.insertStatement = vStatement
+		return vLocals, nil
+
+	case concurrent.WorkerLifeCycleEvent_Stopped:
+		vLocals, _ := pWorkerLocals.(*bulkParallelWorkerLocals)
+		if vLocals == nil {
+			return nil, nil
+		}
+		if vLocals.insertStatement != nil {
+			vLocals.insertStatement.Close()
+		}
+		if vLocals.conn != nil {
+			return nil, vLocals.conn.Close()
+		}
+	}
+	return pWorkerLocals, nil
+}
+
+func (vSelf *BulkManagerParallel) insertBatch(pDispatcher *concurrent.Dispatcher, pWorker int, pItem interface{}, pWorkerLocals concurrent.WorkerLocals) error {
+
+	vLocals := pWorkerLocals.(*bulkParallelWorkerLocals)
+	if vLocals.initError != nil {
+		return vLocals.initError
+	}
+
+	vRows := pItem.([][]interface{})
+	vParameters := make([]interface{}, 0, len(vRows)*len(vSelf.parent.fields))
+	for _, vCurRow := range vRows {
+		vParameters = append(vParameters, vCurRow...)
+	}
+
+	vInsertRows := vSelf.parent.insertRowsFunc(func(pStatement string, pParameters ...interface{}) error {
+		_, vInsertError := vLocals.conn.ExecContext(context.Background(), pStatement, pParameters...)
+		return vInsertError
+	})
+
+	var vInsertError error
+	if len(vRows) == vSelf.batchSize {
+		_, vInsertError = vLocals.insertStatement.Exec(vParameters...)
+	} else {
+		vInsertError = vInsertRows(vRows)
+	}
+
+	if vInsertError != nil {
+		return vSelf.parent.recoverBatch(vRows, vInsertError, vInsertRows)
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerParallel) onBatchError(pDispatcher *concurrent.Dispatcher, pWorker int, pItem interface{}, pError error, pWorkerLocals concurrent.WorkerLocals) bool {
+	diagnostic.LogWarning("BulkManagerParallel.onBatchError", "worker %d failed to insert a batch", pError, pWorker)
+	vSelf.failuresLock.Lock()
+	vSelf.failures = append(vSelf.failures, &BulkBatchError{Rows: pItem.([][]interface{}), Cause: pError})
+	vSelf.failuresLock.Unlock()
+	return true
+}
+
+func (vSelf *BulkManagerParallel) Enqueue(pParameters ...interface{}) error {
+
+	vRow := make([]interface{}, len(pParameters))
+	copy(vRow, pParameters)
+
+	vSelf.pendingLock.Lock()
+	defer vSelf.pendingLock.Unlock()
+
+	vSelf.pendingRows = append(vSelf.pendingRows, vRow)
+	if len(vSelf.pendingRows) == vSelf.batchSize {
+		return vSelf.dispatchPendingRows()
+	}
+	return nil
+}
+
+//dispatchPendingRows must be invoked holding pendingLock
+func (vSelf *BulkManagerParallel) dispatchPendingRows() error {
+
+	if len(vSelf.pendingRows) == 0 {
+		return nil
+	}
+
+	if vSelf.dispatcher.GetStatus() == concurrent.DispatcherStatus_Ready {
+		vStartError := vSelf.dispatcher.Start(vSelf.workers)
+		if vStartError != nil {
+			return diagnostic.NewError("failed to start bulk workers", vStartError)
+		}
+	}
+
+	vSelf.dispatcher.Enqueue(vSelf.pendingRows)
+	vSelf.pendingRows = make([][]interface{}, 0, vSelf.batchSize)
+	return nil
+}
+
+//Commit wait until all the enqueued rows have been inserted
+//Returns:
+// nil if succeeded, otherwise an error containing the failed batches (see GetBulkBatchErrors)
+func (vSelf *BulkManagerParallel) Commit() error {
+
+	vSelf.pendingLock.Lock()
+	defer vSelf.pendingLock.Unlock()
+
+	vDispatchError := vSelf.dispatchPendingRows()
+	if vDispatchError != nil {
+		return vDispatchError
+	}
+
+	vSelf.dispatcher.WaitForCompletition()
+
+	vSelf.failuresLock.Lock()
+	vFailures := vSelf.failures
+	vSelf.failures = nil
+	vSelf.failuresLock.Unlock()
+
+	if len(vFailures) > 0 {
+		return diagnostic.NewError("parallel bulk insert into %s failed", &BulkParallelError{Failures: vFailures}, vSelf.parent.table)
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerParallel) End() error {
+	vCommitError := vSelf.Commit()
+	if vCommitError != nil {
+		return diagnostic.NewError("Commit failed", vCommitError)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//BulkRowRecovery strategy used to isolate the rows responsible of a batch failure
+type BulkRowRecovery string
+
+const (
+	//BulkRowRecovery_None a failed batch fails the bulk
+	BulkRowRecovery_None BulkRowRecovery = ""
+	//BulkRowRecovery_Bisect the failed batch is split in halves until the failing rows are isolated
+	BulkRowRecovery_Bisect BulkRowRecovery = "bisect"
+	//BulkRowRecovery_RowByRow the rows of the failed batch are retried one at time
+	BulkRowRecovery_RowByRow BulkRowRecovery = "rowbyrow"
+)
+
+//RejectedRowFunc signature of functions notified about rejected rows
+//Parameters:
+// []interface{} = row values
+// error = error caused by the row
+type RejectedRowFunc func([]interface{}, error)
+
+//bulkRowsFunc insert a group of rows in a single statement
+type bulkRowsFunc func([][]interface{}) error
+
+//bulkRejects collects rows rejected during a bulk, it's safe for concurrent use
+type bulkRejects struct {
+	lock       sync.Mutex
+	options    BulkOptions
+	rejectFile *os.File
+	count      int
+}
+
+//recoverBatch isolate and reject the failing rows of a batch, inserting the others
+//Parameters:
+// pRows = rows of the failed batch
+// pBatchError = error of the batch
+// pInsertRows = function used to insert subsets of the batch
+//Returns:
+// nil if the failing rows have been rejected, otherwise the batch error
+func (vSelf *bulkRejects) recoverBatch(pRows [][]interface{}, pBatchError error, pInsertRows bulkRowsFunc) error {
+
+	switch vSelf.options.RowRecovery {
+	case BulkRowRecovery_None:
+		return pBatchError
+	case BulkRowRecovery_RowByRow:
+		diagnostic.LogDebug("bulkRejects.recoverBatch", "batch of %d rows failed, retrying row by row", len(pRows))
+		for _, vCurRow := range pRows {
+			if vRowError := pInsertRows([][]interface{}{vCurRow}); vRowError != nil {
+				vRejectError := vSelf.reject(vCurRow, vRowError)
+				if vRejectError != nil {
+					return vRejectError
+				}
+			}
+		}
+		return nil
+	case BulkRowRecovery_Bisect:
+		diagnostic.LogDebug("bulkRejects.recoverBatch", "batch of %d rows failed, bisecting", len(pRows))
+		return vSelf.bisect(pRows, pBatchError, pInsertRows)
+	}
+	return diagnostic.NewError("unknown row recovery %s", pBatchError, vSelf.options.RowRecovery)
+}
+
+func (vSelf *bulkRejects) bisect(pRows [][]interface{}, pError error, pInsertRows bulkRowsFunc) error {
+
+	if len(pRows) == 1 {
+		return vSelf.reject(pRows[0], pError)
+	}
+
+	vMiddle := len(pRows) / 2
+	for _, vCurHalf := range [][][]interface{}{pRows[:vMiddle], pRows[vMiddle:]} {
+		if vHalfError := pInsertRows(vCurHalf); vHalfError != nil {
+			vBisectError := vSelf.bisect(vCurHalf, vHalfError, pInsertRows)
+			if vBisectError != nil {
+				return vBisectError
+			}
+		}
+	}
+	return nil
+}
+
+//reject notifies a rejected row to the callback and to the reject file
+func (vSelf *bulkRejects) reject(pRow []interface{}, pError error) error {
+
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	vSelf.count++
+
+	if vSelf.options.OnRejectedRow == nil && vSelf.options.RejectFile == "" {
+		diagnostic.LogWarning("bulkRejects.reject", "row %v rejected", pError, pRow)
+	}
+
+	if vSelf.options.OnRejectedRow != nil {
+		vSelf.options.OnRejectedRow(pRow, pError)
+	}
+
+	if vSelf.options.RejectFile == "" {
+		return nil
+	}
+
+	if vSelf.rejectFile == nil {
+		vFile, vFileError := os.OpenFile(vSelf.options.RejectFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if vFileError != nil {
+			return diagnostic.NewError("failed to open reject file %s", vFileError, vSelf.options.RejectFile)
+		}
+		vSelf.rejectFile = vFile
+	}
+
+	//rows are written in the LOAD DATA text format followed by the error message
+	var vLine bytes.Buffer
+	for _, vCurValue := range pRow {
+		if vFormatError := writeLoadDataValue(&vLine, vCurValue, nil); vFormatError != nil {
+			vLine.WriteString("?")
+		}
+		vLine.WriteByte('\t')
+	}
+	_LoadDataEscaper.WriteString(&vLine, diagnostic.GetMainError(pError, false).Error())
+	vLine.WriteByte('\n')
+
+	_, vWriteError := vSelf.rejectFile.Write(vLine.Bytes())
+	if vWriteError != nil {
+		return diagnostic.NewError("failed to write reject file %s", vWriteError, vSelf.options.RejectFile)
+	}
+	return nil
+}
+
+func (vSelf *bulkRejects) getCount() int {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	return vSelf.count
+}
+
+func (vSelf *bulkRejects) close() error {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	if vSelf.rejectFile == nil {
+		return nil
+	}
+	vCloseError := vSelf.rejectFile.Close()
+	vSelf.rejectFile = nil
+	return vCloseError
+}
+
+//splitRows split a flat list of parameters in rows
+func splitRows(pParameters []interface{}, pFieldsCount int) [][]interface{} {
+	vRis := make([][]interface{}, 0, len(pParameters)/pFieldsCount)
+	for vStart := 0; vStart+pFieldsCount <= len(pParameters); vStart += pFieldsCount {
+		vRis = append(vRis, pParameters[vStart:vStart+pFieldsCount])
+	}
+	return vRis
+}
+
+//insertRowsFunc returns a function that inserts rows through a multi rows statement
+func (vSelf *SqlInsert) insertRowsFunc(pExec func(string, ...interface{}) error) bulkRowsFunc {
+	return func(pRows [][]interface{}) error {
+		vStatementString, vStatementStringError := BuildInsertStatementString(vSelf.dbHelper.GetDbType(), vSelf.table, vSelf.fields, InsertOptions{Replace: vSelf.options.Replace, NumberOfAdditionalRows: len(pRows) - 1})
+		if vStatementStringError != nil {
+			return diagnostic.NewError("failed to build insert statement", vStatementStringError)
+		}
+		vParameters := make([]interface{}, 0, len(pRows)*len(vSelf.fields))
+		for _, vCurRow := range pRows {
+			vParameters = append(vParameters, vCurRow...)
+		}
+		return pExec(vStatementString, vParameters...)
+	}
+}
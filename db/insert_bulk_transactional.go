@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//BulkManagerTransactional executes single row inserts grouping them in a transaction every batchSize rows.
+//When the insert already belongs to a transaction the rows are committed with it
+type BulkManagerTransactional struct {
+	parent           *SqlInsert
+	batchSize        int
+	pendingRowsCount int
+	tx               *sql.Tx
+	insertStatement  *sql.Stmt
+}
+
+func NewBulkManagerTransactional(pParent *SqlInsert, pBatchSize int) (BulkManager, error) {
+	vRis := &BulkManagerTransactional{parent: pParent, batchSize: pBatchSize}
+	return vRis, nil
+}
+
+func (vSelf *BulkManagerTransactional) Begin() error {
+	if vSelf.parent.IsInTransaction() {
+		vSelf.insertStatement = vSelf.parent.statement
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerTransactional) beginBatch() error {
+
+	vTx, vBeginError := vSelf.parent.dbHelper.GetDb().Begin()
+	if vBeginError != nil {
+		return diagnostic.NewError("failed to begin bulk transaction", vBeginError)
+	}
+	vSelf.tx = vTx
+	vSelf.insertStatement = vTx.Stmt(vSelf.parent.statement)
+	return nil
+}
+
+func (vSelf *BulkManagerTransactional) Enqueue(pParameters ...interface{}) error {
+
+	if vSelf.insertStatement == nil {
+		vBeginError := vSelf.beginBatch()
+		if vBeginError != nil {
+			return vBeginError
+		}
+	}
+
+	_, vInsertError := vSelf.insertStatement.Exec(pParameters...)
+	if vInsertError != nil {
+		//rows are inserted one at time, a failure already identifies the row
+		vInsertError = vSelf.parent.rejectRow(pParameters, vInsertError)
+	}
+	if vInsertError != nil {
+		return diagnostic.NewError("Error during insert bulk", vInsertError)
+	}
+	vSelf.pendingRowsCount++
+
+	if vSelf.pendingRowsCount == vSelf.batchSize {
+		diagnostic.LogDebug("BulkManagerTransactional.Enqueue", "BulkInsert batch size of %d reached, forcing commit", vSelf.batchSize)
+		return vSelf.Commit()
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerTransactional) Commit() error {
+
+	vSelf.pendingRowsCount = 0
+	if vSelf.tx == nil {
+		return nil
+	}
+
+	vSelf.insertStatement.Close()
+	vSelf.insertStatement = nil
+	vCommitError := vSelf.tx.Commit()
+	vSelf.tx = nil
+	if vCommitError != nil {
+		return diagnostic.NewError("An error occurred while commit bulk", vCommitError)
+	}
+	return nil
+}
+
+func (vSelf *BulkManagerTransactional) End() error {
+	vCommitError := vSelf.Commit()
+	if vCommitError != nil {
+		return diagnostic.NewError("Commit failed", vCommitError)
+	}
+	return nil
+}
@@ -1,17 +1,53 @@
 package db
 
 import (
+	"bytes"
 	"os"
 	"testing"
 	"strconv"
 	"strings"
+	"time"
 	_ "github.com/mattn/go-sqlite3"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 var (
 	dummyData = strings.Repeat("X",500)
 )
+
+func init() {
+	//db/loaddata can't be imported by the tests of db
+	SetLoadDataReaderHandlers(mysql.RegisterReaderHandler, mysql.DeregisterReaderHandler)
+	SetLoadDataLocationResolver(func(pDataSourceName string) (*time.Location, error) {
+		vConfig, vParseError := mysql.ParseDSN(pDataSourceName)
+		if vParseError != nil {
+			return nil, vParseError
+		}
+		return vConfig.Loc, nil
+	})
+}
+
+func TestLoadDataTimeLocation(pTest *testing.T) {
+
+	vDbHelper, vDbHelperError := NewDbHelper(string(DbType_mysql), "test:test@tcp(127.0.0.1:3306)/test?parseTime=true&loc=Europe%2FRome")
+	if vDbHelperError != nil {
+		pTest.Fatal(vDbHelperError)
+	}
+	defer vDbHelper.Close()
+
+	vLocation, vLocationError := vDbHelper.loadDataLocation()
+	if vLocationError != nil || vLocation.String() != "Europe/Rome" {
+		pTest.Fatalf("unexpected location %v %v", vLocation, vLocationError)
+	}
+
+	var vBuffer bytes.Buffer
+	writeLoadDataValue(&vBuffer, time.Date(2020, 1, 2, 10, 30, 0, 500000000, time.UTC), vLocation)
+	vBuffer.WriteByte(' ')
+	writeLoadDataValue(&vBuffer, time.Time{}, vLocation)
+	if vBuffer.String() != "2020-01-02 11:30:00.5 0000-00-00" {
+		pTest.Errorf("unexpected formatted times %s", vBuffer.String())
+	}
+}
 func TestSqlite3InsertBulk(pTest *testing.T) {
 
 	vTempDb:=os.TempDir()+"/__test"+strconv.Itoa(os.Getpid())+".db"
@@ -28,43 +64,36 @@ func TestSqlite3InsertBulk(pTest *testing.T) {
 		pTest.Error("failed to create table",vCreateTableError)
 	}
 
-	testInsert(vDbHelper,"test","fielda",100000,true,true,pTest)
+	testInsert(vDbHelper,"test","fielda",100000,true,true,BulkOptions{},pTest)
 
 	
 }
 
 func TestMysqlInsertBulk(pTest *testing.T) {
 
-	vDbHelper,vDbHelperError:= NewDbHelper(string(DbType_mysql), "test:test@tcp(127.0.0.1:3306)/test")
-
-	if vDbHelperError != nil {
-		pTest.Error(vDbHelperError)
-	}
-
-	defer vDbHelper.Close()
+	vDbHelper := newMysqlTestDbHelper(pTest)
 
 	vTableName:="__test"+strconv.Itoa(os.Getpid())	
 	_,vCreateTableError := vDbHelper.Exec("create table "+vTableName+" (fielda varchar(700) primary key)")
 	if vCreateTableError != nil {
-		pTest.Error("failed to create table",vCreateTableError)
+		pTest.Fatal("failed to create table",vCreateTableError)
 	}
-
-	testInsert(vDbHelper,vTableName,"fielda",100000,true,true,pTest)
-
 	defer vDbHelper.Exec("drop table "+vTableName)	
+
+	testInsert(vDbHelper,vTableName,"fielda",100000,true,true,BulkOptions{},pTest)
 }
 
-func testInsert(pDbHelper *DbHelper, pTargetTable string, pColumnName string, pRowsToInsert int, pReplace bool, pBulk bool, pTest *testing.T) {
+func testInsert(pDbHelper *DbHelper, pTargetTable string, pColumnName string, pRowsToInsert int, pReplace bool, pBulk bool, pBulkOptions BulkOptions, pTest testing.TB) {
 
 	vInsert,vCreateInsertError:=pDbHelper.CreateInsert(pTargetTable,[]string {pColumnName}, InsertOptions{Replace:pReplace})
 	if vCreateInsertError != nil {
-		pTest.Error("An error occurred while creating insert",vCreateInsertError)
+		pTest.Fatal("An error occurred while creating insert",vCreateInsertError)
 	}
 
 	if pBulk {	
-		_,vBeginBulkError:=vInsert.BeginBulk(BulkOptions{})
+		_,vBeginBulkError:=vInsert.BeginBulk(pBulkOptions)
 		if vBeginBulkError != nil {
-			pTest.Error("An error occurred while begin bulk",vBeginBulkError)
+			pTest.Fatal("An error occurred while begin bulk",vBeginBulkError)
 		}	
 	}
 
@@ -78,7 +107,7 @@ func testInsert(pDbHelper *DbHelper, pTargetTable string, pColumnName string, pR
 	if pBulk {
 		vEndBulkError:=vInsert.EndBulk()
 		if vEndBulkError != nil {
-			pTest.Error("An error occurred while end bulk")
+			pTest.Error("An error occurred while end bulk",vEndBulkError)
 		}	
 	}
 
@@ -96,3 +125,206 @@ func testInsert(pDbHelper *DbHelper, pTargetTable string, pColumnName string, pR
 
 	//pDbHelper.Close()
 }
+
+func TestSqlite3InsertBulkTransactional(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "transactional")
+
+	_,vCreateTableError := vDbHelper.Exec("create table if not exists test (fielda text primary key)")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table",vCreateTableError)
+	}
+
+	testInsert(vDbHelper,"test","fielda",10000,true,true,BulkOptions{Mode:BulkMode_Transactional},pTest)
+}
+
+func BenchmarkSqlite3InsertBulk(pBenchmark *testing.B) {
+
+	for _,vCurMode:= range []BulkMode{BulkMode_MultiRows,BulkMode_InMemory,BulkMode_Transactional} {
+		pBenchmark.Run(string(vCurMode), func(pSubBenchmark *testing.B) {
+			vTempDb:=os.TempDir()+"/__bench"+strconv.Itoa(os.Getpid())+".db"
+			os.Remove(vTempDb)
+			defer os.Remove(vTempDb)
+			vDbHelper,vDbHelperError:= NewDbHelper(string(DbType_sqlite3), vTempDb)
+			if vDbHelperError != nil {
+				pSubBenchmark.Fatal(vDbHelperError)
+			}
+			defer vDbHelper.Close()
+
+			vDbHelper.Exec("create table test (fielda text primary key)")
+			pSubBenchmark.ResetTimer()
+			testInsert(vDbHelper,"test","fielda",pSubBenchmark.N,true,true,BulkOptions{Mode:vCurMode},pSubBenchmark)
+		})
+	}
+}
+
+func BenchmarkMysqlInsertBulk(pBenchmark *testing.B) {
+
+	vDbHelper,vDbHelperError:= NewDbHelper(string(DbType_mysql), "test:test@tcp(127.0.0.1:3306)/test")
+	if vDbHelperError != nil {
+		pBenchmark.Fatal(vDbHelperError)
+	}
+	defer vDbHelper.Close()
+	if vPingError := vDbHelper.GetDb().Ping(); vPingError != nil {
+		pBenchmark.Skip("mysql not available", vPingError)
+	}
+
+	for _,vCurMode:= range []BulkMode{BulkMode_MultiRows,BulkMode_InMemory,BulkMode_LoadData} {
+		pBenchmark.Run(string(vCurMode), func(pSubBenchmark *testing.B) {
+			vTableName:="__bench"+strconv.Itoa(os.Getpid())
+			vDbHelper.Exec("create table "+vTableName+" (fielda varchar(700) primary key)")
+			defer vDbHelper.Exec("drop table "+vTableName)
+			pSubBenchmark.ResetTimer()
+			testInsert(vDbHelper,vTableName,"fielda",pSubBenchmark.N,true,true,BulkOptions{Mode:vCurMode},pSubBenchmark)
+		})
+	}
+}
+
+type testInsertRecord struct {
+	Id      int    `db:"id"`
+	Name    string `db:"name"`
+	Skipped string `db:"-"`
+}
+
+func TestSqlite3InsertStruct(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "insertstruct")
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (name text, id integer primary key)")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+
+	vInsert, vCreateInsertError := vDbHelper.CreateInsertFor("test", testInsertRecord{}, InsertOptions{})
+	if vCreateInsertError != nil {
+		pTest.Fatal("An error occurred while creating insert", vCreateInsertError)
+	}
+	defer vInsert.Close()
+
+	if _, vBeginBulkError := vInsert.BeginBulk(BulkOptions{BatchSize: 7}); vBeginBulkError != nil {
+		pTest.Fatal("An error occurred while begin bulk", vBeginBulkError)
+	}
+
+	for vCnt := 0; vCnt < 100; vCnt++ {
+		if _, vExecError := vInsert.ExecStruct(&testInsertRecord{Id: vCnt, Name: "Item " + strconv.Itoa(vCnt)}); vExecError != nil {
+			pTest.Fatal(vExecError)
+		}
+	}
+
+	if vEndBulkError := vInsert.EndBulk(); vEndBulkError != nil {
+		pTest.Fatal("An error occurred while end bulk", vEndBulkError)
+	}
+
+	if _, vExecError := vInsert.ExecStruct(struct{ Id int }{}); vExecError == nil {
+		pTest.Error("expected an error inserting a struct of a different type")
+	}
+
+	vRecord, vQueryError := QueryOneOf[testInsertRecord](vDbHelper, "select * from test where id=?", 42)
+	if vQueryError != nil {
+		pTest.Fatal("query failed", vQueryError)
+	}
+	if vRecord.Name != "Item 42" {
+		pTest.Errorf("unexpected record %#v", vRecord)
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 100 {
+		pTest.Errorf("invalid number of rows in table: current %d expected 100", vCount)
+	}
+}
+
+func TestSqlite3InsertBulkParallel(pTest *testing.T) {
+
+	vTempDb := os.TempDir() + "/__testparallel" + strconv.Itoa(os.Getpid()) + ".db"
+	os.Remove(vTempDb)
+	defer os.Remove(vTempDb)
+	vDbHelper, vDbHelperError := NewDbHelper(string(DbType_sqlite3), vTempDb+"?_busy_timeout=10000")
+	if vDbHelperError != nil {
+		pTest.Fatal(vDbHelperError)
+	}
+	defer vDbHelper.Close()
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (fielda text primary key)")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+
+	testInsert(vDbHelper, "test", "fielda", 10000, true, true, BulkOptions{Mode: BulkMode_Parallel, Workers: 3}, pTest)
+
+	vInsert, vCreateInsertError := vDbHelper.CreateInsert("test", []string{"fielda"}, InsertOptions{})
+	if vCreateInsertError != nil {
+		pTest.Fatal("An error occurred while creating insert", vCreateInsertError)
+	}
+	defer vInsert.Close()
+
+	vInsert.BeginBulk(BulkOptions{Mode: BulkMode_Parallel, BatchSize: 10})
+	for vCnt := 0; vCnt < 25; vCnt++ {
+		vInsert.Exec("New " + strconv.Itoa(vCnt))
+	}
+	//duplicated key
+	vInsert.Exec("Item 1" + dummyData)
+
+	vEndBulkError := vInsert.EndBulk()
+	vFailures := GetBulkBatchErrors(vEndBulkError)
+	if len(vFailures) != 1 || len(vFailures[0].Rows) != 6 {
+		pTest.Fatalf("expected a failure of the last batch, got %v", vEndBulkError)
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 10020 {
+		pTest.Errorf("invalid number of rows in table: current %d expected 10020", vCount)
+	}
+}
+
+func TestSqlite3InsertBulkRowRecovery(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "recovery")
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (fielda integer primary key check (fielda % 10 <> 7))")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+
+	vRejectFile := os.TempDir() + "/__testrejects" + strconv.Itoa(os.Getpid())
+	os.Remove(vRejectFile)
+	defer os.Remove(vRejectFile)
+
+	vExpectedRows := 0
+	for _, vCurOptions := range []BulkOptions{
+		BulkOptions{Mode: BulkMode_MultiRows, RowRecovery: BulkRowRecovery_Bisect, BatchSize: 16},
+		BulkOptions{Mode: BulkMode_MultiRows, RowRecovery: BulkRowRecovery_RowByRow, BatchSize: 16},
+		BulkOptions{Mode: BulkMode_Parallel, RowRecovery: BulkRowRecovery_Bisect, BatchSize: 16, Workers: 1},
+		BulkOptions{RowRecovery: BulkRowRecovery_RowByRow}} {
+
+		vRejected := make(map[int]bool)
+		vCurOptions.OnRejectedRow = func(pRow []interface{}, pError error) {
+			vRejected[pRow[0].(int)] = true
+		}
+		vCurOptions.RejectFile = vRejectFile
+
+		vInsert, vCreateInsertError := vDbHelper.CreateInsert("test", []string{"fielda"}, InsertOptions{})
+		if vCreateInsertError != nil {
+			pTest.Fatal("An error occurred while creating insert", vCreateInsertError)
+		}
+
+		vInsert.BeginBulk(vCurOptions)
+		for vCnt := vExpectedRows; vCnt < vExpectedRows+100; vCnt++ {
+			if _, vExecError := vInsert.Exec(vCnt); vExecError != nil {
+				pTest.Fatal(vExecError)
+			}
+		}
+		if vEndBulkError := vInsert.EndBulk(); vEndBulkError != nil {
+			pTest.Fatalf("bulk %#v failed: %v", vCurOptions, vEndBulkError)
+		}
+		vInsert.Close()
+
+		if len(vRejected) != 10 || vInsert.GetRejectedRowsCount() != 10 || vRejected[vExpectedRows+7] == false {
+			pTest.Errorf("unexpected rejected rows for %#v: %v", vCurOptions, vRejected)
+		}
+		vExpectedRows += 100
+		if vCount := countRows(pTest, vDbHelper, "test"); vCount != vExpectedRows-len(vRejected)*vExpectedRows/100 {
+			pTest.Errorf("invalid number of rows in table: current %d", vCount)
+		}
+	}
+
+	vRejects, vReadError := os.ReadFile(vRejectFile)
+	if vReadError != nil || strings.Count(string(vRejects), "\n") != 40 || strings.HasPrefix(string(vRejects), "7\t") == false {
+		pTest.Errorf("unexpected reject file content %s %v", vRejects, vReadError)
+	}
+}
@@ -0,0 +1,24 @@
+//Package loaddata enables db.BulkMode_LoadData, streaming rows through the LOAD DATA LOCAL INFILE readers of the mysql driver.
+//It is imported for its side effects: import _ "github.com/mysinmyc/gocommons/db/loaddata"
+package loaddata
+
+import (
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mysinmyc/gocommons/db"
+)
+
+func init() {
+	db.SetLoadDataReaderHandlers(mysql.RegisterReaderHandler, mysql.DeregisterReaderHandler)
+	db.SetLoadDataLocationResolver(dataSourceLocation)
+}
+
+//dataSourceLocation returns the loc parameter of a data source name
+func dataSourceLocation(pDataSourceName string) (*time.Location, error) {
+	vConfig, vParseError := mysql.ParseDSN(pDataSourceName)
+	if vParseError != nil {
+		return nil, vParseError
+	}
+	return vConfig.Loc, nil
+}
@@ -0,0 +1,610 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	TABLE_SCHEMA_MIGRATIONS              = "schema_migrations"
+	FIELD_SCHEMA_MIGRATIONS_VERSION      = "version"
+	FIELD_SCHEMA_MIGRATIONS_DESCRIPTION  = "description"
+	FIELD_SCHEMA_MIGRATIONS_APPLIED_AT   = "applied_at"
+	Migrations_DefaultLockTimeout        = time.Minute
+	migrations_LockRetryInterval         = time.Millisecond * 100
+)
+
+var (
+	_MigrationFileRegexp = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+)
+
+//MigrationFunc signature of go migrations, executed inside a transaction
+type MigrationFunc func(*DbHelperTx) error
+
+//Migration a versioned schema change. Up and Down can be implemented by go functions or by sql scripts
+type Migration struct {
+	Version     int64
+	Description string
+	Up          MigrationFunc
+	Down        MigrationFunc
+	UpSql       string
+	DownSql     string
+}
+
+//Migrations a set of migrations tracked in the same table
+type Migrations struct {
+	tableName  string
+	migrations map[int64]*Migration
+}
+
+type MigrationDirection string
+
+const (
+	MigrationDirection_Up   MigrationDirection = "up"
+	MigrationDirection_Down MigrationDirection = "down"
+)
+
+//MigrateOptions options of migration execution
+type MigrateOptions struct {
+	//DryRun when true the migrations to apply are reported but not executed
+	DryRun bool
+	//LockTimeout maximum time to wait for migrations performed by other processes, default Migrations_DefaultLockTimeout
+	LockTimeout time.Duration
+}
+
+//MigrationStep a migration executed (or to be executed in case of dry run)
+type MigrationStep struct {
+	Version     int64
+	Description string
+	Direction   MigrationDirection
+	Sql         string
+	Duration    time.Duration
+}
+
+//MigrationReport outcome of a migration
+type MigrationReport struct {
+	FromVersion int64
+	ToVersion   int64
+	DryRun      bool
+	Steps       []MigrationStep
+}
+
+//MigrationStatus status of a single migration
+type MigrationStatus struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+	//Unknown is true for versions applied on the database but not present in the migrations set
+	Unknown bool
+}
+
+//NewMigrations create an empty set of migrations
+//Parameters:
+// pTableName = table used to track applied migrations, default TABLE_SCHEMA_MIGRATIONS
+func NewMigrations(pTableName string) *Migrations {
+	if pTableName == "" {
+		pTableName = TABLE_SCHEMA_MIGRATIONS
+	}
+	return &Migrations{tableName: pTableName, migrations: make(map[int64]*Migration)}
+}
+
+//GetTableName returns the name of the table tracking applied migrations
+func (vSelf *Migrations) GetTableName() string {
+	return vSelf.tableName
+}
+
+//Add a migration
+func (vSelf *Migrations) Add(pMigration *Migration) error {
+	if pMigration.Version < 1 {
+		return diagnostic.NewError("invalid migration version %d", nil, pMigration.Version)
+	}
+	if vSelf.migrations[pMigration.Version] != nil {
+		return diagnostic.NewError("duplicated migration version %d", nil, pMigration.Version)
+	}
+	if pMigration.Up == nil && pMigration.UpSql == "" {
+		return diagnostic.NewError("migration %d doesn't define an up step", nil, pMigration.Version)
+	}
+	vSelf.migrations[pMigration.Version] = pMigration
+	return nil
+}
+
+//AddFunc add a migration implemented by go functions
+//Parameters:
+// pVersion = migration version
+// pDescription = description
+// pUp = function that applies the migration
+// pDown = optional, function that reverts the migration
+func (vSelf *Migrations) AddFunc(pVersion int64, pDescription string, pUp MigrationFunc, pDown MigrationFunc) error {
+	return vSelf.Add(&Migration{Version: pVersion, Description: pDescription, Up: pUp, Down: pDown})
+}
+
+//AddSql add a migration implemented by sql scripts
+//Parameters:
+// pVersion = migration version
+// pDescription = description
+// pUpSql = statements that apply the migration, separated by ;
+// pDownSql = optional, statements that revert the migration
+func (vSelf *Migrations) AddSql(pVersion int64, pDescription string, pUpSql string, pDownSql string) error {
+	return vSelf.Add(&Migration{Version: pVersion, Description: pDescription, UpSql: pUpSql, DownSql: pDownSql})
+}
+
+//LoadSqlFiles add migrations from sql files named <version>_<description>.up.sql and <version>_<description>.down.sql
+//Parameters:
+// pFs = file system containing the scripts, for example an embed.FS
+// pDir = directory of the scripts inside pFs
+func (vSelf *Migrations) LoadSqlFiles(pFs fs.FS, pDir string) error {
+
+	vEntries, vReadDirError := fs.ReadDir(pFs, pDir)
+	if vReadDirError != nil {
+		return diagnostic.NewError("failed to read migrations directory %s", vReadDirError, pDir)
+	}
+
+	vLoaded := make(map[int64]*Migration)
+	for _, vCurEntry := range vEntries {
+		if vCurEntry.IsDir() {
+			continue
+		}
+		vMatch := _MigrationFileRegexp.FindStringSubmatch(vCurEntry.Name())
+		if vMatch == nil {
+			diagnostic.LogDebug("Migrations.LoadSqlFiles", "ignoring file %s", vCurEntry.Name())
+			continue
+		}
+
+		vVersion, _ := strconv.ParseInt(vMatch[1], 10, 64)
+		vContent, vReadError := fs.ReadFile(pFs, path.Join(pDir, vCurEntry.Name()))
+		if vReadError != nil {
+			return diagnostic.NewError("failed to read migration file %s", vReadError, vCurEntry.Name())
+		}
+
+		vMigration := vLoaded[vVersion]
+		if vMigration == nil {
+			vMigration = &Migration{Version: vVersion, Description: strings.Replace(vMatch[2], "_", " ", -1)}
+			vLoaded[vVersion] = vMigration
+		}
+		if MigrationDirection(vMatch[3]) == MigrationDirection_Up {
+			vMigration.UpSql = string(vContent)
+		} else {
+			vMigration.DownSql = string(vContent)
+		}
+	}
+
+	for _, vCurMigration := range vLoaded {
+		vAddError := vSelf.Add(vCurMigration)
+		if vAddError != nil {
+			return diagnostic.NewError("failed to add migration loaded from %s", vAddError, pDir)
+		}
+	}
+	return nil
+}
+
+//GetLatestVersion returns the highest version of the set
+func (vSelf *Migrations) GetLatestVersion() int64 {
+	var vRis int64
+	for vCurVersion := range vSelf.migrations {
+		if vCurVersion > vRis {
+			vRis = vCurVersion
+		}
+	}
+	return vRis
+}
+
+func (vSelf *Migrations) sortedVersions() []int64 {
+	vRis := make([]int64, 0, len(vSelf.migrations))
+	for vCurVersion := range vSelf.migrations {
+		vRis = append(vRis, vCurVersion)
+	}
+	sort.Slice(vRis, func(i, j int) bool { return vRis[i] < vRis[j] })
+	return vRis
+}
+
+//Migrate apply all the pending migrations
+//Parameters:
+// pMigrations = migrations set
+// pOptions = migration options
+//Returns:
+// the report of the executed steps
+func (vSelf *DbHelper) Migrate(pMigrations *Migrations, pOptions MigrateOptions) (*MigrationReport, error) {
+	return vSelf.MigrateTo(pMigrations, pMigrations.GetLatestVersion(), pOptions)
+}
+
+//MigrateTo apply or revert migrations to reach the given version
+//Parameters:
+// pMigrations = migrations set
+// pVersion = target version, 0 reverts all the migrations
+// pOptions = migration options
+//Returns:
+// the report of the executed steps
+func (vSelf *DbHelper) MigrateTo(pMigrations *Migrations, pVersion int64, pOptions MigrateOptions) (*MigrationReport, error) {
+
+	if pVersion != 0 && pMigrations.migrations[pVersion] == nil {
+		return nil, diagnostic.NewError("unknown migration version %d", nil, pVersion)
+	}
+
+	if pOptions.DryRun {
+		//the migrations table is not created
+		return vSelf.planMigrations(vSelf, pMigrations, pVersion, true)
+	}
+
+	vInitError := vSelf.initMigrations(vSelf.db, pMigrations)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	if pOptions.LockTimeout <= 0 {
+		pOptions.LockTimeout = Migrations_DefaultLockTimeout
+	}
+
+	switch vSelf.GetDbType() {
+	case DbType_sqlite3:
+		return vSelf.migrateSqlite(pMigrations, pVersion, pOptions)
+	case DbType_mysql:
+		return vSelf.migrateMysql(pMigrations, pVersion, pOptions)
+	}
+	return nil, diagnostic.NewError("migrations not supported for dbtype %s", nil, vSelf.GetDbType())
+}
+
+//GetMigrationStatus returns the status of each migration of the set, sorted by version
+func (vSelf *DbHelper) GetMigrationStatus(pMigrations *Migrations) ([]MigrationStatus, error) {
+
+	vInitError := vSelf.initMigrations(vSelf.db, pMigrations)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vApplied, vAppliedError := getAppliedMigrations(vSelf, pMigrations)
+	if vAppliedError != nil {
+		return nil, vAppliedError
+	}
+
+	vRis := make([]MigrationStatus, 0, len(pMigrations.migrations))
+	for _, vCurVersion := range pMigrations.sortedVersions() {
+		vCurStatus := MigrationStatus{Version: vCurVersion, Description: pMigrations.migrations[vCurVersion].Description}
+		if vAppliedMigration, vIsApplied := vApplied[vCurVersion]; vIsApplied {
+			vCurStatus.Applied = true
+			vCurStatus.AppliedAt = vAppliedMigration.AppliedAt
+			delete(vApplied, vCurVersion)
+		}
+		vRis = append(vRis, vCurStatus)
+	}
+
+	for _, vCurApplied := range vApplied {
+		vRis = append(vRis, *vCurApplied)
+	}
+	sort.Slice(vRis, func(i, j int) bool { return vRis[i].Version < vRis[j].Version })
+	return vRis, nil
+}
+
+//Migrate apply all the pending migrations inside the transaction, each step in a savepoint.
+//No lock is acquired: on sqlite the transaction write lock serializes concurrent migrations, on mysql ddl statements commit the transaction implicitly
+//Parameters:
+// pMigrations = migrations set
+//Returns:
+// the report of the executed steps
+func (vSelf *DbHelperTx) Migrate(pMigrations *Migrations) (*MigrationReport, error) {
+
+	vInitError := vSelf.dbHelper.initMigrations(vSelf.tx, pMigrations)
+	if vInitError != nil {
+		return nil, vInitError
+	}
+
+	vRis, vPlanError := vSelf.dbHelper.planMigrations(vSelf, pMigrations, pMigrations.GetLatestVersion(), false)
+	if vPlanError != nil {
+		return nil, vPlanError
+	}
+	return vRis, vSelf.dbHelper.executeMigrationSteps(pMigrations, vRis, vSelf.InTransaction)
+}
+
+func (vSelf *DbHelper) initMigrations(pExecutor SqlExecutor, pMigrations *Migrations) error {
+
+	var vDdl []string
+	switch vSelf.GetDbType() {
+	case DbType_sqlite3:
+		vDdl = []string{
+			"create table if not exists " + pMigrations.tableName + " (" + FIELD_SCHEMA_MIGRATIONS_VERSION + " integer PRIMARY KEY, " + FIELD_SCHEMA_MIGRATIONS_DESCRIPTION + " text, " + FIELD_SCHEMA_MIGRATIONS_APPLIED_AT + " integer)",
+			"create table if not exists " + pMigrations.tableName + "_lock (id integer PRIMARY KEY, locked_at integer)"}
+	case DbType_mysql:
+		vDdl = []string{
+			"create table if not exists " + pMigrations.tableName + " (" + FIELD_SCHEMA_MIGRATIONS_VERSION + " bigint PRIMARY KEY, " + FIELD_SCHEMA_MIGRATIONS_DESCRIPTION + " varchar(255), " + FIELD_SCHEMA_MIGRATIONS_APPLIED_AT + " bigint)"}
+	default:
+		return diagnostic.NewError("migrations not supported for dbtype %s", nil, vSelf.GetDbType())
+	}
+
+	for _, vCurDdl := range vDdl {
+		_, vCreateError := pExecutor.Exec(vCurDdl)
+		if vCreateError != nil {
+			return diagnostic.NewError("failed to create migrations table %s", vCreateError, pMigrations.tableName)
+		}
+	}
+	return nil
+}
+
+//migrateSqlite performs all the steps in a single transaction.
+//The first write on the lock table acquires the sqlite write lock, so concurrent migrations wait until the transaction ends
+func (vSelf *DbHelper) migrateSqlite(pMigrations *Migrations, pVersion int64, pOptions MigrateOptions) (*MigrationReport, error) {
+
+	vDeadline := time.Now().Add(pOptions.LockTimeout)
+	for {
+		var vRis *MigrationReport
+		var vStepError error
+		vLocked := false
+
+		vTransactionError := vSelf.InTransaction(func(pTx *DbHelperTx) error {
+			_, vLockError := pTx.Exec("insert or replace into "+pMigrations.tableName+"_lock (id, locked_at) values (1, ?)", time.Now().Unix())
+			if vLockError != nil {
+				return diagnostic.NewError("failed to lock migrations table", vLockError)
+			}
+			vLocked = true
+
+			var vPlanError error
+			vRis, vPlanError = vSelf.planMigrations(pTx, pMigrations, pVersion, false)
+			if vPlanError != nil {
+				return vPlanError
+			}
+			//steps completed before a failure are committed
+			vStepError = vSelf.executeMigrationSteps(pMigrations, vRis, pTx.InTransaction)
+			return nil
+		})
+
+		if vTransactionError == nil {
+			return vRis, vStepError
+		}
+		if vLocked || time.Now().After(vDeadline) {
+			return nil, diagnostic.NewError("migration failed", vTransactionError)
+		}
+		diagnostic.LogDebug("DbHelper.migrateSqlite", "migrations table %s locked, retrying", pMigrations.tableName)
+		time.Sleep(migrations_LockRetryInterval)
+	}
+}
+
+//migrateMysql holds a named lock for the whole migration, each step is executed in a dedicated transaction
+func (vSelf *DbHelper) migrateMysql(pMigrations *Migrations, pVersion int64, pOptions MigrateOptions) (*MigrationReport, error) {
+
+	vConn, vConnError := vSelf.db.Conn(context.Background())
+	if vConnError != nil {
+		return nil, diagnostic.NewError("failed to obtain a connection for migration lock", vConnError)
+	}
+	defer vConn.Close()
+
+	vLockName := "gocommons_migrations_" + pMigrations.tableName
+	var vLocked sql.NullInt64
+	//get_lock waits whole seconds, the timeout is rounded up so it is never 0
+	vLockTimeoutSeconds := int64((pOptions.LockTimeout + time.Second - 1) / time.Second)
+	vLockError := vConn.QueryRowContext(context.Background(), "select get_lock(?, ?)", vLockName, vLockTimeoutSeconds).Scan(&vLocked)
+	if vLockError != nil {
+		return nil, diagnostic.NewError("failed to acquire migration lock %s", vLockError, vLockName)
+	}
+	if vLocked.Int64 != 1 {
+		return nil, diagnostic.NewError("timeout acquiring migration lock %s", nil, vLockName)
+	}
+	defer vConn.ExecContext(context.Background(), "select release_lock(?)", vLockName)
+
+	vRis, vPlanError := vSelf.planMigrations(vSelf, pMigrations, pVersion, false)
+	if vPlanError != nil {
+		return nil, vPlanError
+	}
+	return vRis, vSelf.executeMigrationSteps(pMigrations, vRis, vSelf.InTransaction)
+}
+
+//planMigrations compute the steps required to reach the target version
+//Parameters:
+// pDryRun = true if the migrations table may not exist yet, then no migration is applied
+func (vSelf *DbHelper) planMigrations(pQuerier Querier, pMigrations *Migrations, pVersion int64, pDryRun bool) (*MigrationReport, error) {
+
+	vApplied := make(map[int64]*MigrationStatus)
+	vTableExists := true
+	if pDryRun {
+		var vExistsError error
+		vTableExists, vExistsError = vSelf.existsMigrationsTable(pQuerier, pMigrations)
+		if vExistsError != nil {
+			return nil, vExistsError
+		}
+	}
+	if vTableExists {
+		var vAppliedError error
+		vApplied, vAppliedError = getAppliedMigrations(pQuerier, pMigrations)
+		if vAppliedError != nil {
+			return nil, vAppliedError
+		}
+	}
+
+	vRis := &MigrationReport{ToVersion: pVersion, DryRun: pDryRun, Steps: []MigrationStep{}}
+	for vCurVersion := range vApplied {
+		if vCurVersion > vRis.FromVersion {
+			vRis.FromVersion = vCurVersion
+		}
+	}
+
+	vVersions := pMigrations.sortedVersions()
+	for _, vCurVersion := range vVersions {
+		if _, vIsApplied := vApplied[vCurVersion]; vIsApplied == false && vCurVersion <= pVersion {
+			vCurMigration := pMigrations.migrations[vCurVersion]
+			vRis.Steps = append(vRis.Steps, MigrationStep{Version: vCurVersion, Description: vCurMigration.Description, Direction: MigrationDirection_Up, Sql: vCurMigration.UpSql})
+		}
+	}
+
+	for vCnt := len(vVersions) - 1; vCnt >= 0; vCnt-- {
+		vCurVersion := vVersions[vCnt]
+		if _, vIsApplied := vApplied[vCurVersion]; vIsApplied && vCurVersion > pVersion {
+			vCurMigration := pMigrations.migrations[vCurVersion]
+			if vCurMigration.Down == nil && vCurMigration.DownSql == "" {
+				return nil, diagnostic.NewError("migration %d cannot be reverted", nil, vCurVersion)
+			}
+			vRis.Steps = append(vRis.Steps, MigrationStep{Version: vCurVersion, Description: vCurMigration.Description, Direction: MigrationDirection_Down, Sql: vCurMigration.DownSql})
+		}
+	}
+
+	return vRis, nil
+}
+
+func (vSelf *DbHelper) executeMigrationSteps(pMigrations *Migrations, pReport *MigrationReport, pInTransaction func(TransactionFunc) error) error {
+
+	for vCnt := range pReport.Steps {
+		vCurStep := &pReport.Steps[vCnt]
+		vCurMigration := pMigrations.migrations[vCurStep.Version]
+		diagnostic.LogInfo("DbHelper.Migrate", "migrating %s %s to version %d: %s", pMigrations.tableName, vCurStep.Direction, vCurStep.Version, vCurStep.Description)
+
+		vStart := time.Now()
+		vStepError := pInTransaction(func(pTx *DbHelperTx) error {
+			var vFunc MigrationFunc
+			if vCurStep.Direction == MigrationDirection_Up {
+				vFunc = vCurMigration.Up
+			} else {
+				vFunc = vCurMigration.Down
+			}
+
+			var vMigrationError error
+			if vFunc != nil {
+				vMigrationError = vFunc(pTx)
+			} else {
+				vMigrationError = execSqlScript(pTx, vCurStep.Sql)
+			}
+			if vMigrationError != nil {
+				return vMigrationError
+			}
+
+			var vTrackError error
+			if vCurStep.Direction == MigrationDirection_Up {
+				_, vTrackError = pTx.Exec("insert into "+pMigrations.tableName+" ("+FIELD_SCHEMA_MIGRATIONS_VERSION+","+FIELD_SCHEMA_MIGRATIONS_DESCRIPTION+","+FIELD_SCHEMA_MIGRATIONS_APPLIED_AT+") values (?,?,?)", vCurStep.Version, vCurStep.Description, time.Now().Unix())
+			} else {
+				_, vTrackError = pTx.Exec("delete from "+pMigrations.tableName+" where "+FIELD_SCHEMA_MIGRATIONS_VERSION+"=?", vCurStep.Version)
+			}
+			return vTrackError
+		})
+		vCurStep.Duration = time.Since(vStart)
+
+		if vStepError != nil {
+			pReport.Steps = pReport.Steps[:vCnt]
+			return diagnostic.NewError("migration %s %d failed", vStepError, vCurStep.Direction, vCurStep.Version)
+		}
+	}
+	return nil
+}
+
+//existsMigrationsTable returns true if the table of the applied migrations exists
+func (vSelf *DbHelper) existsMigrationsTable(pQuerier Querier, pMigrations *Migrations) (bool, error) {
+
+	var vQuery string
+	switch vSelf.GetDbType() {
+	case DbType_sqlite3:
+		vQuery = "select name from sqlite_master where type='table' and name=?"
+	case DbType_mysql:
+		vQuery = "select table_name from information_schema.tables where table_schema=database() and table_name=?"
+	default:
+		return false, diagnostic.NewError("migrations not supported for dbtype %s", nil, vSelf.GetDbType())
+	}
+
+	vRows, vQueryError := pQuerier.Query(vQuery, pMigrations.tableName)
+	if vQueryError != nil {
+		return false, diagnostic.NewError("failed to check migrations table %s", vQueryError, pMigrations.tableName)
+	}
+	defer vRows.Close()
+	vExists := vRows.Next()
+	return vExists, vRows.Err()
+}
+
+func getAppliedMigrations(pQuerier Querier, pMigrations *Migrations) (map[int64]*MigrationStatus, error) {
+
+	vRows, vQueryError := pQuerier.Query("select " + FIELD_SCHEMA_MIGRATIONS_VERSION + "," + FIELD_SCHEMA_MIGRATIONS_DESCRIPTION + "," + FIELD_SCHEMA_MIGRATIONS_APPLIED_AT + " from " + pMigrations.tableName)
+	if vQueryError != nil {
+		return nil, diagnostic.NewError("failed to read applied migrations", vQueryError)
+	}
+	defer vRows.Close()
+
+	vRis := make(map[int64]*MigrationStatus)
+	for vRows.Next() {
+		var vDescription sql.NullString
+		var vAppliedAt sql.NullInt64
+		vCurStatus := &MigrationStatus{Applied: true, Unknown: true}
+		vScanError := vRows.Scan(&vCurStatus.Version, &vDescription, &vAppliedAt)
+		if vScanError != nil {
+			return nil, diagnostic.NewError("failed to read applied migrations", vScanError)
+		}
+		vCurStatus.Description = vDescription.String
+		vCurStatus.AppliedAt = time.Unix(vAppliedAt.Int64, 0)
+		vRis[vCurStatus.Version] = vCurStatus
+	}
+	return vRis, vRows.Err()
+}
+
+//execSqlScript execute the statements of a script one at time
+func execSqlScript(pTx *DbHelperTx, pScript string) error {
+	for _, vCurStatement := range splitSqlScript(pTx.GetDbType(), pScript) {
+		_, vExecError := pTx.Exec(vCurStatement)
+		if vExecError != nil {
+			return diagnostic.NewError("failed to execute statement %s", vExecError, vCurStatement)
+		}
+	}
+	return nil
+}
+
+//splitSqlScript split a script into statements separated by ;, ignoring separators inside quotes and comments.
+//Line comments are removed, block comments are kept because mysql executes the ones beginning with /*!.
+//Mysql scripts also have # line comments and backslash escapes in strings
+func splitSqlScript(pDbType DbType, pScript string) []string {
+
+	vRis := []string{}
+	vCurrent := strings.Builder{}
+	var vQuote rune
+	vLineComment := false
+	vBlockComment := false
+
+	vRunes := []rune(pScript)
+	for vCnt := 0; vCnt < len(vRunes); vCnt++ {
+		vChar := vRunes[vCnt]
+		switch {
+		case vLineComment:
+			if vChar == '\n' {
+				vLineComment = false
+				vCurrent.WriteRune(vChar)
+			}
+			continue
+		case vBlockComment:
+			if vChar == '*' && vCnt+1 < len(vRunes) && vRunes[vCnt+1] == '/' {
+				vBlockComment = false
+				vCurrent.WriteRune(vChar)
+				vCnt++
+				vChar = vRunes[vCnt]
+			}
+		case vQuote != 0:
+			if vChar == '\\' && vQuote != '`' && pDbType == DbType_mysql && vCnt+1 < len(vRunes) {
+				vCurrent.WriteRune(vChar)
+				vCnt++
+				vChar = vRunes[vCnt]
+			} else if vChar == vQuote {
+				vQuote = 0
+			}
+		case vChar == '\'' || vChar == '"' || vChar == '`':
+			vQuote = vChar
+		case vChar == '-' && vCnt+1 < len(vRunes) && vRunes[vCnt+1] == '-', vChar == '#' && pDbType == DbType_mysql:
+			vLineComment = true
+			continue
+		case vChar == '/' && vCnt+1 < len(vRunes) && vRunes[vCnt+1] == '*':
+			vBlockComment = true
+			vCurrent.WriteRune(vChar)
+			vCnt++
+			vChar = vRunes[vCnt]
+		case vChar == ';':
+			if vStatement := strings.TrimSpace(vCurrent.String()); vStatement != "" {
+				vRis = append(vRis, vStatement)
+			}
+			vCurrent.Reset()
+			continue
+		}
+		vCurrent.WriteRune(vChar)
+	}
+
+	if vStatement := strings.TrimSpace(vCurrent.String()); vStatement != "" {
+		vRis = append(vRis, vStatement)
+	}
+	return vRis
+}
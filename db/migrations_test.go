@@ -0,0 +1,114 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSqlite3Migrations(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "migrations")
+
+	vMigrations := NewMigrations("")
+	vLoadError := vMigrations.LoadSqlFiles(fstest.MapFS{
+		"sql/0001_create_test.up.sql":   &fstest.MapFile{Data: []byte("create table test (fielda text); -- comment; with separator\ninsert into test values ('a;b');")},
+		"sql/0001_create_test.down.sql": &fstest.MapFile{Data: []byte("drop table test;")},
+		"sql/readme.txt":                &fstest.MapFile{Data: []byte("ignored")},
+	}, "sql")
+	if vLoadError != nil {
+		pTest.Fatal("failed to load sql files", vLoadError)
+	}
+
+	vMigrations.AddFunc(2, "add column", func(pTx *DbHelperTx) error {
+		_, vError := pTx.Exec("alter table test add column fieldb text")
+		return vError
+	}, func(pTx *DbHelperTx) error {
+		_, vError := pTx.Exec("alter table test drop column fieldb")
+		return vError
+	})
+
+	vDryRunReport, vDryRunError := vDbHelper.Migrate(vMigrations, MigrateOptions{DryRun: true})
+	if vDryRunError != nil {
+		pTest.Fatal("dry run failed", vDryRunError)
+	}
+	if len(vDryRunReport.Steps) != 2 || vDryRunReport.Steps[0].Sql == "" {
+		pTest.Fatalf("unexpected dry run report %#v", vDryRunReport)
+	}
+	if vTables := countRows(pTest, vDbHelper, "sqlite_master"); vTables != 0 {
+		pTest.Errorf("dry run created %d tables", vTables)
+	}
+
+	vReport, vMigrateError := vDbHelper.Migrate(vMigrations, MigrateOptions{})
+	if vMigrateError != nil {
+		pTest.Fatal("migration failed", vMigrateError)
+	}
+	if len(vReport.Steps) != 2 || vReport.FromVersion != 0 || vReport.ToVersion != 2 {
+		pTest.Errorf("unexpected report %#v", vReport)
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 1 {
+		pTest.Errorf("invalid number of rows in table: current %d expected 1", vCount)
+	}
+
+	vReport, vMigrateError = vDbHelper.Migrate(vMigrations, MigrateOptions{})
+	if vMigrateError != nil || len(vReport.Steps) != 0 {
+		pTest.Errorf("second migration should be a no-op: %#v %v", vReport, vMigrateError)
+	}
+
+	vMigrations.AddSql(3, "failing", "insert into test values ('c'); insert into missing values (1)", "")
+	_, vMigrateError = vDbHelper.Migrate(vMigrations, MigrateOptions{})
+	if vMigrateError == nil {
+		pTest.Error("expected a failure applying migration 3")
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 1 {
+		pTest.Errorf("failed migration has not been rolled back: %d rows", vCount)
+	}
+
+	vStatus, vStatusError := vDbHelper.GetMigrationStatus(vMigrations)
+	if vStatusError != nil {
+		pTest.Fatal("status failed", vStatusError)
+	}
+	if len(vStatus) != 3 || vStatus[1].Applied == false || vStatus[2].Applied {
+		pTest.Errorf("unexpected status %#v", vStatus)
+	}
+
+	_, vMigrateError = vDbHelper.MigrateTo(vMigrations, 0, MigrateOptions{})
+	if vMigrateError != nil {
+		pTest.Fatal("downgrade failed", vMigrateError)
+	}
+	if _, vQueryError := vDbHelper.Exec("select * from test"); vQueryError == nil {
+		pTest.Error("table test should have been dropped")
+	}
+}
+
+func TestSplitSqlScript(pTest *testing.T) {
+
+	for vScript, vExpected := range map[string][]string{
+		"create table a (f text); insert into a values ('x;y')":          {"create table a (f text)", "insert into a values ('x;y')"},
+		"select 1; -- comment; with separator\nselect 2":                 {"select 1", "select 2"},
+		"/* header; with separator */ select 1; select /* ; */ 2":        {"/* header; with separator */ select 1", "select /* ; */ 2"},
+		"create table b (f text) /*!50100 engine=innodb; */; select 3":   {"create table b (f text) /*!50100 engine=innodb; */", "select 3"},
+		"select '/* not a comment'; select 4":                            {"select '/* not a comment'", "select 4"},
+		"select 5 /* unterminated; comment":                              {"select 5 /* unterminated; comment"},
+	} {
+		if vStatements := splitSqlScript(DbType_sqlite3, vScript); reflect.DeepEqual(vStatements, vExpected) == false {
+			pTest.Errorf("unexpected statements of %s: %q", vScript, vStatements)
+		}
+	}
+
+	for vScript, vExpected := range map[string][]string{
+		`insert into a values ('it\'s;'); select 6`:                     {`insert into a values ('it\'s;')`, "select 6"},
+		`select "a\\"; select 7`:                                        {`select "a\\"`, "select 7"},
+		"select 8; # comment; with separator\nselect 9":                 {"select 8", "select 9"},
+		"select `a\\`; select 10":                                       {"select `a\\`", "select 10"},
+	} {
+		if vStatements := splitSqlScript(DbType_mysql, vScript); reflect.DeepEqual(vStatements, vExpected) == false {
+			pTest.Errorf("unexpected mysql statements of %s: %q", vScript, vStatements)
+		}
+	}
+
+	//backslashes and # are not special in sqlite
+	if vStatements := splitSqlScript(DbType_sqlite3, `select 'a\'; select '#'`); len(vStatements) != 2 {
+		pTest.Errorf("unexpected sqlite statements %q", vStatements)
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	sql "database/sql"
+	"reflect"
 	"github.com/mysinmyc/gocommons/diagnostic"
 )
 
@@ -9,11 +10,22 @@ type DbHelperRows struct {
 	rows 		*sql.Rows
 	fields 		[]interface{}	
 	columns		[]string
+	mapping		*structMapping
+	mappedFields	[]*structField
+}
+
+//Querier implemented by DbHelper and DbHelperTx
+type Querier interface {
+	Query(string, ...interface{}) (*DbHelperRows, error)
 }
 
 func (vSelf *DbHelper) Query(pQuery string, pArgs ...interface{}) (*DbHelperRows,error) {
+	return queryOn(vSelf.db, pQuery, pArgs...)
+}
 
-	vRows,vError:= vSelf.db.Query(pQuery, pArgs...)
+func queryOn(pExecutor SqlExecutor, pQuery string, pArgs ...interface{}) (*DbHelperRows,error) {
+
+	vRows,vError:= pExecutor.Query(pQuery, pArgs...)
 
 	if vError!=nil {
 		return nil,diagnostic.NewError("failed to perform query %s", vError, pQuery)
@@ -43,3 +55,62 @@ func (vSelf *DbHelperRows) Next() bool {
 func (vSelf *DbHelperRows) Scan(pDest ...interface{}) error {
 	return vSelf.rows.Scan(pDest...)
 }
+
+//ScanStruct copy the columns of the current row into the fields of a struct.
+//Columns are mapped to fields by `db` tag or by name (case insensitive), columns without a matching field are ignored.
+//NULL values can be received by pointer fields or sql.Null* types
+//Parameters:
+// pDest = pointer to the destination struct
+func (vSelf *DbHelperRows) ScanStruct(pDest interface{}) error {
+
+	vDestValue := reflect.ValueOf(pDest)
+	if vDestValue.Kind() != reflect.Ptr || vDestValue.IsNil() {
+		return diagnostic.NewError("destination must be a non nil pointer to struct, got %T", nil, pDest)
+	}
+	vDestValue = vDestValue.Elem()
+
+	if vSelf.mapping == nil || vSelf.mapping.structType != vDestValue.Type() {
+		vMappingError := vSelf.prepareMapping(vDestValue.Type())
+		if vMappingError != nil {
+			return vMappingError
+		}
+	}
+
+	vDest := make([]interface{}, len(vSelf.mappedFields))
+	for vCnt, vCurField := range vSelf.mappedFields {
+		if vCurField == nil {
+			vDest[vCnt] = new(interface{})
+		} else {
+			vDest[vCnt] = vDestValue.FieldByIndex(vCurField.index).Addr().Interface()
+		}
+	}
+
+	vScanError := vSelf.rows.Scan(vDest...)
+	if vScanError != nil {
+		return diagnostic.NewError("failed to scan row into %v", vScanError, vDestValue.Type())
+	}
+	return nil
+}
+
+func (vSelf *DbHelperRows) prepareMapping(pType reflect.Type) error {
+
+	vMapping, vMappingError := getStructMapping(pType)
+	if vMappingError != nil {
+		return diagnostic.NewError("failed to map struct", vMappingError)
+	}
+
+	if vSelf.columns == nil {
+		vColumns, vColumnsError := vSelf.rows.Columns()
+		if vColumnsError != nil {
+			return diagnostic.NewError("failed to read columns", vColumnsError)
+		}
+		vSelf.columns = vColumns
+	}
+
+	vSelf.mappedFields = make([]*structField, len(vSelf.columns))
+	for vCnt, vCurColumn := range vSelf.columns {
+		vSelf.mappedFields[vCnt] = vMapping.getField(vCurColumn)
+	}
+	vSelf.mapping = vMapping
+	return nil
+}
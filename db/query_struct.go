@@ -0,0 +1,136 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//QueryStructs perform a query appending each row to a slice of structs
+//Parameters:
+// pDest = pointer to a slice of structs or of pointers to structs
+// pQuery = query to execute
+// pArgs = query parameters
+func (vSelf *DbHelper) QueryStructs(pDest interface{}, pQuery string, pArgs ...interface{}) error {
+	return queryStructs(vSelf, pDest, pQuery, pArgs...)
+}
+
+//QueryOne perform a query copying the first row into a struct
+//Parameters:
+// pDest = pointer to the destination struct
+// pQuery = query to execute
+// pArgs = query parameters
+//Returns:
+// nil if succeeded, an error satisfying IsNoRows if the query returned no rows
+func (vSelf *DbHelper) QueryOne(pDest interface{}, pQuery string, pArgs ...interface{}) error {
+	return queryOne(vSelf, pDest, pQuery, pArgs...)
+}
+
+func (vSelf *DbHelperTx) QueryStructs(pDest interface{}, pQuery string, pArgs ...interface{}) error {
+	return queryStructs(vSelf, pDest, pQuery, pArgs...)
+}
+
+func (vSelf *DbHelperTx) QueryOne(pDest interface{}, pQuery string, pArgs ...interface{}) error {
+	return queryOne(vSelf, pDest, pQuery, pArgs...)
+}
+
+//QueryStructsOf perform a query returning each row as a struct of type T
+//Parameters:
+// pQuerier = DbHelper or DbHelperTx
+// pQuery = query to execute
+// pArgs = query parameters
+func QueryStructsOf[T any](pQuerier Querier, pQuery string, pArgs ...interface{}) ([]T, error) {
+	vRis := make([]T, 0)
+	vQueryError := queryStructs(pQuerier, &vRis, pQuery, pArgs...)
+	if vQueryError != nil {
+		return nil, vQueryError
+	}
+	return vRis, nil
+}
+
+//QueryOneOf perform a query returning the first row as a struct of type T
+//Parameters:
+// pQuerier = DbHelper or DbHelperTx
+// pQuery = query to execute
+// pArgs = query parameters
+//Returns:
+// the struct or an error satisfying IsNoRows if the query returned no rows
+func QueryOneOf[T any](pQuerier Querier, pQuery string, pArgs ...interface{}) (*T, error) {
+	vRis := new(T)
+	vQueryError := queryOne(pQuerier, vRis, pQuery, pArgs...)
+	if vQueryError != nil {
+		return nil, vQueryError
+	}
+	return vRis, nil
+}
+
+//IsNoRows returns true if the error has been caused by a query without results
+func IsNoRows(pError error) bool {
+	if pError == nil {
+		return false
+	}
+	return diagnostic.GetMainError(pError, false) == sql.ErrNoRows
+}
+
+func queryStructs(pQuerier Querier, pDest interface{}, pQuery string, pArgs ...interface{}) error {
+
+	vSliceValue := reflect.ValueOf(pDest)
+	if vSliceValue.Kind() != reflect.Ptr || vSliceValue.Elem().Kind() != reflect.Slice {
+		return diagnostic.NewError("destination must be a pointer to slice, got %T", nil, pDest)
+	}
+	vSliceValue = vSliceValue.Elem()
+
+	vElementType := vSliceValue.Type().Elem()
+	vElementIsPtr := vElementType.Kind() == reflect.Ptr
+	if vElementIsPtr {
+		vElementType = vElementType.Elem()
+	}
+	if vElementType.Kind() != reflect.Struct {
+		return diagnostic.NewError("slice elements of %T are not structs", nil, pDest)
+	}
+
+	vRows, vQueryError := pQuerier.Query(pQuery, pArgs...)
+	if vQueryError != nil {
+		return vQueryError
+	}
+	defer vRows.Close()
+
+	for vRows.Next() {
+		vCurElement := reflect.New(vElementType)
+		vScanError := vRows.ScanStruct(vCurElement.Interface())
+		if vScanError != nil {
+			return vScanError
+		}
+		if vElementIsPtr {
+			vSliceValue.Set(reflect.Append(vSliceValue, vCurElement))
+		} else {
+			vSliceValue.Set(reflect.Append(vSliceValue, vCurElement.Elem()))
+		}
+	}
+
+	vRowsError := vRows.Err()
+	if vRowsError != nil {
+		return diagnostic.NewError("failed to read rows of query %s", vRowsError, pQuery)
+	}
+	return nil
+}
+
+func queryOne(pQuerier Querier, pDest interface{}, pQuery string, pArgs ...interface{}) error {
+
+	vRows, vQueryError := pQuerier.Query(pQuery, pArgs...)
+	if vQueryError != nil {
+		return vQueryError
+	}
+	defer vRows.Close()
+
+	if vRows.Next() == false {
+		vRowsError := vRows.Err()
+		if vRowsError != nil {
+			return diagnostic.NewError("failed to read rows of query %s", vRowsError, pQuery)
+		}
+		return diagnostic.NewError("no rows returned by query %s", sql.ErrNoRows, pQuery)
+	}
+
+	return vRows.ScanStruct(pDest)
+}
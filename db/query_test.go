@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+type testAudit struct {
+	Note sql.NullString `db:"note"`
+}
+
+type testRecord struct {
+	testAudit
+	Id       int64   `db:"id"`
+	Name     string
+	Optional *string `db:"optional"`
+	Ignored  string  `db:"-"`
+}
+
+func TestSqlite3QueryStructs(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "query")
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (id integer primary key, NAME text, optional text, note text, extra text)")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+	vDbHelper.Exec("insert into test values (1, 'first', null, 'a note', 'x'), (2, 'second', 'set', null, 'y')")
+
+	var vRecords []testRecord
+	vQueryError := vDbHelper.QueryStructs(&vRecords, "select * from test order by id")
+	if vQueryError != nil {
+		pTest.Fatal("query failed", vQueryError)
+	}
+
+	if len(vRecords) != 2 {
+		pTest.Fatalf("invalid number of records: current %d expected 2", len(vRecords))
+	}
+	if vRecords[0].Name != "first" || vRecords[0].Optional != nil || vRecords[0].Note.String != "a note" {
+		pTest.Errorf("unexpected first record %#v", vRecords[0])
+	}
+	if vRecords[1].Optional == nil || *vRecords[1].Optional != "set" || vRecords[1].Note.Valid {
+		pTest.Errorf("unexpected second record %#v", vRecords[1])
+	}
+
+	vRecord, vQueryOneError := QueryOneOf[testRecord](vDbHelper, "select id, name from test where id=?", 2)
+	if vQueryOneError != nil {
+		pTest.Fatal("query one failed", vQueryOneError)
+	}
+	if vRecord.Name != "second" {
+		pTest.Errorf("unexpected record %#v", vRecord)
+	}
+
+	_, vQueryOneError = QueryOneOf[testRecord](vDbHelper, "select id from test where id=?", 3)
+	if IsNoRows(vQueryOneError) == false {
+		pTest.Error("expected no rows error, got", vQueryOneError)
+	}
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	//StructTag_Db name of the struct tag used to map fields to columns
+	//Use `db:"column_name"` to set the column name, `db:"-"` to ignore the field
+	StructTag_Db = "db"
+)
+
+type structField struct {
+	column string
+	index  []int
+}
+
+//structMapping describes how the fields of a struct type are mapped to columns
+type structMapping struct {
+	structType reflect.Type
+	fields     []*structField
+	byColumn   map[string]*structField
+	byLower    map[string]*structField
+}
+
+var (
+	_StructMappingsLock sync.RWMutex
+	_StructMappings     = make(map[reflect.Type]*structMapping)
+	_ScannerType        = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+//getStructMapping returns the mapping of a struct type, building it the first time it is requested
+func getStructMapping(pType reflect.Type) (*structMapping, error) {
+
+	if pType.Kind() != reflect.Struct {
+		return nil, diagnostic.NewError("type %v is not a struct", nil, pType)
+	}
+
+	_StructMappingsLock.RLock()
+	vRis := _StructMappings[pType]
+	_StructMappingsLock.RUnlock()
+	if vRis != nil {
+		return vRis, nil
+	}
+
+	vRis = &structMapping{structType: pType, byColumn: make(map[string]*structField), byLower: make(map[string]*structField)}
+	vRis.addFields(pType, nil)
+
+	if len(vRis.fields) == 0 {
+		return nil, diagnostic.NewError("type %v doesn't contain mappable fields", nil, pType)
+	}
+
+	_StructMappingsLock.Lock()
+	_StructMappings[pType] = vRis
+	_StructMappingsLock.Unlock()
+	return vRis, nil
+}
+
+func (vSelf *structMapping) addFields(pType reflect.Type, pParentIndex []int) {
+
+	for vCnt := 0; vCnt < pType.NumField(); vCnt++ {
+		vCurField := pType.Field(vCnt)
+		vTag := vCurField.Tag.Get(StructTag_Db)
+		if vTag == "-" {
+			continue
+		}
+
+		vIndex := make([]int, len(pParentIndex), len(pParentIndex)+1)
+		copy(vIndex, pParentIndex)
+		vIndex = append(vIndex, vCnt)
+
+		//fields of embedded structs are promoted as in go
+		if vCurField.Anonymous && vTag == "" && vCurField.Type.Kind() == reflect.Struct && reflect.PtrTo(vCurField.Type).Implements(_ScannerType) == false {
+			vSelf.addFields(vCurField.Type, vIndex)
+			continue
+		}
+
+		if vCurField.PkgPath != "" {
+			//unexported
+			continue
+		}
+
+		vColumn := vTag
+		if vColumn == "" {
+			vColumn = vCurField.Name
+		}
+
+		if vSelf.byColumn[vColumn] != nil {
+			continue
+		}
+
+		vStructField := &structField{column: vColumn, index: vIndex}
+		vSelf.fields = append(vSelf.fields, vStructField)
+		vSelf.byColumn[vColumn] = vStructField
+		vLower := strings.ToLower(vColumn)
+		if vSelf.byLower[vLower] == nil {
+			vSelf.byLower[vLower] = vStructField
+		}
+	}
+}
+
+//getField returns the field mapped to a column, looking first for an exact match and then for a case insensitive one
+func (vSelf *structMapping) getField(pColumn string) *structField {
+	vRis := vSelf.byColumn[pColumn]
+	if vRis == nil {
+		vRis = vSelf.byLower[strings.ToLower(pColumn)]
+	}
+	return vRis
+}
+
+//getColumns returns the name of mapped columns in field order
+func (vSelf *structMapping) getColumns() []string {
+	vRis := make([]string, len(vSelf.fields))
+	for vCnt, vCurField := range vSelf.fields {
+		vRis[vCnt] = vCurField.column
+	}
+	return vRis
+}
+
+//getValues returns the values of mapped fields in field order
+func (vSelf *structMapping) getValues(pStruct reflect.Value) []interface{} {
+	vRis := make([]interface{}, len(vSelf.fields))
+	for vCnt, vCurField := range vSelf.fields {
+		vRis[vCnt] = pStruct.FieldByIndex(vCurField.index).Interface()
+	}
+	return vRis
+}
+
+//indirectStruct dereferences pointers until reaching a struct value
+func indirectStruct(pValue interface{}) (reflect.Value, error) {
+	vRis := reflect.ValueOf(pValue)
+	for vRis.Kind() == reflect.Ptr {
+		if vRis.IsNil() {
+			return reflect.Value{}, diagnostic.NewError("nil pointer to %v", nil, vRis.Type())
+		}
+		vRis = vRis.Elem()
+	}
+	if vRis.Kind() != reflect.Struct {
+		return reflect.Value{}, diagnostic.NewError("value of type %T is not a struct", nil, pValue)
+	}
+	return vRis, nil
+}
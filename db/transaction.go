@@ -0,0 +1,211 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+//DbHelperTx wraps a database transaction, exposing the same facilities of DbHelper bound to it
+type DbHelperTx struct {
+	dbHelper          *DbHelper
+	tx                *sql.Tx
+	savepointsCounter int
+	actor             string
+}
+
+//TransactionFunc signature of functions executed inside a transaction
+//Parameters:
+// *DbHelperTx = current transaction
+//Returns:
+// nil to commit, otherwise an error to rollback
+type TransactionFunc func(*DbHelperTx) error
+
+//InTransaction execute a function inside a transaction.
+//The transaction is committed if the function succeed, rolled back if it returns an error or panics
+//Parameters:
+// pFunc = function to execute
+//Returns:
+// nil if the transaction has been committed, otherwise the error occurred
+func (vSelf *DbHelper) InTransaction(pFunc TransactionFunc) error {
+
+	vTx, vBeginError := vSelf.db.Begin()
+	if vBeginError != nil {
+		return diagnostic.NewError("failed to begin transaction", vBeginError)
+	}
+
+	vDbHelperTx := &DbHelperTx{dbHelper: vSelf, tx: vTx}
+
+	vFuncError := runTransactionFunc(pFunc, vDbHelperTx, func() {
+		vTx.Rollback()
+	})
+
+	if vFuncError != nil {
+		vRollbackError := vTx.Rollback()
+		if vRollbackError != nil {
+			diagnostic.LogWarning("DbHelper.InTransaction", "failed to rollback transaction", vRollbackError)
+		}
+		return diagnostic.NewError("transaction rolled back", vFuncError)
+	}
+
+	vCommitError := vTx.Commit()
+	if vCommitError != nil {
+		return diagnostic.NewError("failed to commit transaction", vCommitError)
+	}
+	return nil
+}
+
+//InTransaction execute a function inside a nested transaction implemented by a savepoint.
+//Changes of the nested function are discarded if it fails, without affecting the outer transaction
+//Parameters:
+// pFunc = function to execute
+//Returns:
+// nil if the savepoint has been released, otherwise the error occurred
+func (vSelf *DbHelperTx) InTransaction(pFunc TransactionFunc) error {
+
+	vSelf.savepointsCounter++
+	vSavepoint := "gocommons_sp" + strconv.Itoa(vSelf.savepointsCounter)
+
+	_, vSavepointError := vSelf.tx.Exec("SAVEPOINT " + vSavepoint)
+	if vSavepointError != nil {
+		return diagnostic.NewError("failed to create savepoint %s", vSavepointError, vSavepoint)
+	}
+
+	vFuncError := runTransactionFunc(pFunc, vSelf, func() {
+		vSelf.rollbackToSavepoint(vSavepoint)
+	})
+
+	if vFuncError != nil {
+		vRollbackError := vSelf.rollbackToSavepoint(vSavepoint)
+		if vRollbackError != nil {
+			diagnostic.LogWarning("DbHelperTx.InTransaction", "failed to rollback to savepoint %s", vRollbackError, vSavepoint)
+		}
+		return diagnostic.NewError("savepoint %s rolled back", vFuncError, vSavepoint)
+	}
+
+	_, vReleaseError := vSelf.tx.Exec("RELEASE SAVEPOINT " + vSavepoint)
+	if vReleaseError != nil {
+		return diagnostic.NewError("failed to release savepoint %s", vReleaseError, vSavepoint)
+	}
+	return nil
+}
+
+func (vSelf *DbHelperTx) rollbackToSavepoint(pSavepoint string) error {
+	_, vRollbackError := vSelf.tx.Exec("ROLLBACK TO SAVEPOINT " + pSavepoint)
+	if vRollbackError != nil {
+		return vRollbackError
+	}
+	//after a rollback the savepoint is still active
+	_, vReleaseError := vSelf.tx.Exec("RELEASE SAVEPOINT " + pSavepoint)
+	return vReleaseError
+}
+
+func runTransactionFunc(pFunc TransactionFunc, pDbHelperTx *DbHelperTx, pOnPanic func()) error {
+	defer func() {
+		if vPanic := recover(); vPanic != nil {
+			pOnPanic()
+			panic(vPanic)
+		}
+	}()
+	return pFunc(pDbHelperTx)
+}
+
+//GetDbHelper returns the DbHelper that started the transaction
+func (vSelf *DbHelperTx) GetDbHelper() *DbHelper {
+	return vSelf.dbHelper
+}
+
+//GetTx returns the underlying transaction
+func (vSelf *DbHelperTx) GetTx() *sql.Tx {
+	return vSelf.tx
+}
+
+//SetActor sets who makes the changes of the transaction, it's recorded in the history of the beans
+func (vSelf *DbHelperTx) SetActor(pActor string) {
+	vSelf.actor = pActor
+}
+
+//GetActor returns who makes the changes of the transaction
+func (vSelf *DbHelperTx) GetActor() string {
+	return vSelf.actor
+}
+
+func (vSelf *DbHelperTx) GetDbType() DbType {
+	return vSelf.dbHelper.GetDbType()
+}
+
+func (vSelf *DbHelperTx) Exec(pQuery string, pParameters ...interface{}) (sql.Result, error) {
+	return vSelf.tx.Exec(pQuery, pParameters...)
+}
+
+func (vSelf *DbHelperTx) Query(pQuery string, pArgs ...interface{}) (*DbHelperRows, error) {
+	return queryOn(vSelf.tx, pQuery, pArgs...)
+}
+
+func (vSelf *DbHelperTx) CreateInsert(pTable string, pFields []string, pOptions InsertOptions) (*SqlInsert, error) {
+	return vSelf.dbHelper.createInsert(vSelf.tx, vSelf, pTable, pFields, pOptions)
+}
+
+func (vSelf *DbHelperTx) CreateInsertFor(pTable string, pSample interface{}, pOptions InsertOptions) (*SqlInsert, error) {
+	return vSelf.dbHelper.createInsertFor(vSelf.tx, vSelf, pTable, pSample, pOptions)
+}
+
+func (vSelf *DbHelperTx) LoadBean(pBean IndentifiableInDb) error {
+	return vSelf.dbHelper.loadBean(vSelf.tx, vSelf, pBean)
+}
+
+func (vSelf *DbHelperTx) SaveBean(pBean IndentifiableInDb) error {
+	return vSelf.dbHelper.saveBean(vSelf.tx, vSelf, pBean, 0)
+}
+
+func (vSelf *DbHelperTx) SaveBeanWithTTL(pBean IndentifiableInDb, pTTL time.Duration) error {
+	return vSelf.dbHelper.saveBean(vSelf.tx, vSelf, pBean, pTTL)
+}
+
+func (vSelf *DbHelperTx) DeleteBean(pBean IndentifiableInDb) error {
+	return vSelf.dbHelper.deleteBean(vSelf.tx, vSelf, pBean)
+}
+
+func (vSelf *DbHelperTx) ExistsBean(pBean IndentifiableInDb) (bool, error) {
+	return vSelf.dbHelper.existsBean(vSelf.tx, vSelf, pBean)
+}
+
+func (vSelf *DbHelperTx) GetBeanMetadata(pBean IndentifiableInDb) (*BeanMetadata, error) {
+	return vSelf.dbHelper.getBeanMetadata(vSelf.tx, vSelf, pBean)
+}
+
+func (vSelf *DbHelperTx) AdoptLegacyBeans(pNamespace string) (int, error) {
+	return vSelf.dbHelper.adoptLegacyBeans(vSelf.tx, vSelf, pNamespace)
+}
+
+func (vSelf *DbHelperTx) ListBeanIds(pNamespace string, pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+	return vSelf.dbHelper.listBeanIds(vSelf.tx, vSelf, pNamespace, pPrefix, pLimit, pCursor)
+}
+
+//IterateBeans returns an iterator over the beans of the transaction, it must be closed before the end of the transaction
+func (vSelf *DbHelperTx) IterateBeans(pNamespace string, pPrefix string) (*persistency.BeanIterator, error) {
+	return vSelf.dbHelper.iterateBeans(vSelf.tx, vSelf, pNamespace, pPrefix)
+}
+
+func (vSelf *DbHelperTx) FindBeanIds(pIndexName string, pValue interface{}) ([]string, error) {
+	return vSelf.dbHelper.findBeanIds(vSelf.tx, vSelf, pIndexName, pValue)
+}
+
+func (vSelf *DbHelperTx) FindBeans(pIndexName string, pValue interface{}) (*persistency.BeanIterator, error) {
+	return vSelf.dbHelper.findBeans(vSelf.tx, vSelf, pIndexName, pValue)
+}
+
+func (vSelf *DbHelperTx) ListBeanRevisions(pBean IndentifiableInDb) ([]BeanRevision, error) {
+	return vSelf.dbHelper.listBeanRevisions(vSelf.tx, vSelf, pBean)
+}
+
+func (vSelf *DbHelperTx) LoadBeanRevision(pBean IndentifiableInDb, pRevision int64) error {
+	return vSelf.dbHelper.loadBeanRevision(vSelf.tx, vSelf, pBean, pRevision)
+}
+
+func (vSelf *DbHelperTx) DiffBeanRevisions(pBean IndentifiableInDb, pFromRevision int64, pToRevision int64) ([]persistency.JsonDifference, error) {
+	return vSelf.dbHelper.diffBeanRevisions(vSelf.tx, vSelf, pBean, pFromRevision, pToRevision)
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mysinmyc/gocommons/persistency"
+)
+
+type testBean struct {
+	Id    string
+	Value string
+}
+
+func (vSelf *testBean) GetIdInDb() string {
+	return vSelf.Id
+}
+
+func newSqlite3TestDbHelper(pTest *testing.T, pName string) *DbHelper {
+	vTempDb := os.TempDir() + "/__test" + pName + strconv.Itoa(os.Getpid()) + ".db"
+	os.Remove(vTempDb)
+	pTest.Cleanup(func() { os.Remove(vTempDb) })
+
+	vDbHelper, vDbHelperError := NewDbHelper(string(DbType_sqlite3), vTempDb)
+	if vDbHelperError != nil {
+		pTest.Fatal(vDbHelperError)
+	}
+	pTest.Cleanup(func() { vDbHelper.Close() })
+	return vDbHelper
+}
+
+//newMysqlTestDbHelper connects to the test database, the test is skipped if it isn't available
+func newMysqlTestDbHelper(pTest *testing.T) *DbHelper {
+	vDbHelper, vDbHelperError := NewDbHelper(string(DbType_mysql), "test:test@tcp(127.0.0.1:3306)/test")
+	if vDbHelperError != nil {
+		pTest.Fatal(vDbHelperError)
+	}
+	pTest.Cleanup(func() { vDbHelper.Close() })
+	if vPingError := vDbHelper.GetDb().Ping(); vPingError != nil {
+		pTest.Skip("mysql test database not available", vPingError)
+	}
+	return vDbHelper
+}
+
+func countRows(pTest *testing.T, pDbHelper *DbHelper, pTable string) int {
+	var vCount int
+	vCountError := pDbHelper.GetDb().QueryRow("select count(*) from " + pTable).Scan(&vCount)
+	if vCountError != nil {
+		pTest.Fatal("an error occurred while counting rows", vCountError)
+	}
+	return vCount
+}
+
+func TestSqlite3Transaction(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "tx")
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (fielda text primary key)")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+	if vInitError := vDbHelper.InitBeans(); vInitError != nil {
+		pTest.Fatal("failed to initialize beans", vInitError)
+	}
+
+	vRollbackError := vDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		vInsert, vInsertError := pTx.CreateInsert("test", []string{"fielda"}, InsertOptions{})
+		if vInsertError != nil {
+			return vInsertError
+		}
+		defer vInsert.Close()
+		vInsert.Exec("discarded")
+		return errors.New("forced rollback")
+	})
+	if vRollbackError == nil {
+		pTest.Error("expected an error from the rolled back transaction")
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 0 {
+		pTest.Errorf("rolled back rows still present: %d", vCount)
+	}
+
+	vCommitError := vDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		if _, vExecError := pTx.Exec("insert into test values (?)", "outer"); vExecError != nil {
+			return vExecError
+		}
+
+		pTx.InTransaction(func(pNestedTx *DbHelperTx) error {
+			pNestedTx.Exec("insert into test values (?)", "nested")
+			return errors.New("forced savepoint rollback")
+		})
+
+		if vBeanError := pTx.SaveBean(&testBean{Id: "bean1", Value: "inside tx"}); vBeanError != nil {
+			return vBeanError
+		}
+
+		vLoadedBean := &testBean{Id: "bean1"}
+		if vLoadError := pTx.LoadBean(vLoadedBean); vLoadError != nil {
+			return vLoadError
+		}
+		if vLoadedBean.Value != "inside tx" {
+			pTest.Errorf("unexpected bean value %s", vLoadedBean.Value)
+		}
+		return nil
+	})
+	if vCommitError != nil {
+		pTest.Fatal("transaction failed", vCommitError)
+	}
+
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 1 {
+		pTest.Errorf("invalid number of rows in table: current %d expected 1", vCount)
+	}
+
+	vLoadError := vDbHelper.LoadBean(&testBean{Id: "bean1"})
+	if vLoadError != nil {
+		pTest.Error("bean saved in committed transaction not found", vLoadError)
+	}
+
+	vDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		pTx.SaveBean(&testBean{Id: "bean2"})
+		return errors.New("forced rollback")
+	})
+	if persistency.IsBeanNotFound(vDbHelper.LoadBean(&testBean{Id: "bean2"})) == false {
+		pTest.Error("bean saved in rolled back transaction found")
+	}
+
+	//beans in transactions require InitBeans
+	vNewDbHelper := newSqlite3TestDbHelper(pTest, "txinit")
+	vNotInitializedError := vNewDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		return pTx.SaveBean(&testBean{Id: "bean3"})
+	})
+	if vNotInitializedError == nil {
+		pTest.Error("bean saved in a transaction before InitBeans")
+	}
+	if vInitError := vNewDbHelper.InitBeans(); vInitError != nil {
+		pTest.Fatal("failed to initialize beans", vInitError)
+	}
+	vNewDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		pTx.SaveBean(&testBean{Id: "bean3"})
+		return errors.New("forced rollback")
+	})
+	if countRows(pTest, vNewDbHelper, TABLE_BEANS) != 0 {
+		pTest.Error("bean saved in rolled back transaction found")
+	}
+	if vSaveError := vNewDbHelper.SaveBean(&testBean{Id: "bean3"}); vSaveError != nil {
+		pTest.Error("failed to save bean after rollback", vSaveError)
+	}
+}
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/mysinmyc/gocommons/concurrent"
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+var (
+	_BulkUpdateTablesCounter = concurrent.NewCounter()
+)
+
+//SqlBulkUpdate updates rows by key. Values are staged in a temporary table and applied to the target table every BatchSize rows through a join.
+//It follows the BulkManager life cycle: Begin, Enqueue keys and values, Commit, End
+type SqlBulkUpdate struct {
+	dbHelper         *DbHelper
+	executor         SqlExecutor
+	transaction      *DbHelperTx
+	conn             *sql.Conn
+	table            string
+	tempTable        string
+	keyFields        []string
+	valueFields      []string
+	options          BulkOptions
+	batchSize        int
+	stagingInsert    *SqlInsert
+	pendingRowsCount int
+	updatedRows      int64
+}
+
+//CreateBulkUpdate create a bulk update
+//Parameters:
+// pTable = target table
+// pKeyFields = columns identifying the rows to update
+// pValueFields = columns to update
+// pOptions = bulk options, BatchSize is the number of rows staged before applying them
+func (vSelf *DbHelper) CreateBulkUpdate(pTable string, pKeyFields []string, pValueFields []string, pOptions BulkOptions) (*SqlBulkUpdate, error) {
+	return vSelf.createBulkUpdate(nil, nil, pTable, pKeyFields, pValueFields, pOptions)
+}
+
+func (vSelf *DbHelperTx) CreateBulkUpdate(pTable string, pKeyFields []string, pValueFields []string, pOptions BulkOptions) (*SqlBulkUpdate, error) {
+	return vSelf.dbHelper.createBulkUpdate(vSelf.tx, vSelf, pTable, pKeyFields, pValueFields, pOptions)
+}
+
+func (vSelf *DbHelper) createBulkUpdate(pExecutor SqlExecutor, pTransaction *DbHelperTx, pTable string, pKeyFields []string, pValueFields []string, pOptions BulkOptions) (*SqlBulkUpdate, error) {
+
+	if len(pKeyFields) == 0 || len(pValueFields) == 0 {
+		return nil, diagnostic.NewError("bulk update of %s requires key and value fields", nil, pTable)
+	}
+
+	switch vSelf.GetDbType() {
+	case DbType_sqlite3, DbType_mysql:
+	default:
+		return nil, diagnostic.NewError("Bulk update not supported for dbType %s", nil, vSelf.GetDbType())
+	}
+
+	vBatchSize := pOptions.BatchSize
+	if vBatchSize < 1 {
+		vBatchSize = BulkInsert_DefaultBatchSize
+	}
+
+	return &SqlBulkUpdate{dbHelper: vSelf, executor: pExecutor, transaction: pTransaction, table: pTable, keyFields: pKeyFields, valueFields: pValueFields, options: pOptions, batchSize: vBatchSize}, nil
+}
+
+//Begin creates the temporary table. Outside a transaction a dedicated connection is held until End, temporary tables are visible only to the connection that created them
+func (vSelf *SqlBulkUpdate) Begin() error {
+
+	if vSelf.transaction == nil {
+		vConn, vConnError := vSelf.dbHelper.GetDb().Conn(context.Background())
+		if vConnError != nil {
+			return diagnostic.NewError("failed to obtain a connection for bulk update", vConnError)
+		}
+		vSelf.conn = vConn
+		vSelf.executor = &connExecutor{conn: vConn}
+	}
+
+	vDbType := vSelf.dbHelper.GetDbType()
+	vSelf.tempTable = "gocommons_bulkupdate_" + strconv.FormatInt(int64(_BulkUpdateTablesCounter.IncreaseBy(1)), 10)
+	vFields := append(append([]string{}, vSelf.keyFields...), vSelf.valueFields...)
+
+	vSelect := " select " + quoteIdentifiers(vDbType, vFields) + " from " + QuoteIdentifier(vDbType, vSelf.table) + " where 2=1"
+	var vDdl []string
+	switch vDbType {
+	case DbType_mysql:
+		//create index commits the transaction in mysql, unlike the keys declared by create temporary table
+		vDdl = []string{"create temporary table " + QuoteIdentifier(vDbType, vSelf.tempTable) + " (index (" + quoteIdentifiers(vDbType, vSelf.keyFields) + "))" + vSelect}
+	default:
+		vDdl = []string{
+			"create temp table " + QuoteIdentifier(vDbType, vSelf.tempTable) + " as" + vSelect,
+			"create index " + QuoteIdentifier(vDbType, vSelf.tempTable+"_keys") + " on " + QuoteIdentifier(vDbType, vSelf.tempTable) + " (" + quoteIdentifiers(vDbType, vSelf.keyFields) + ")"}
+	}
+	for _, vCurDdl := range vDdl {
+		_, vCreateError := vSelf.executor.Exec(vCurDdl)
+		if vCreateError != nil {
+			vSelf.releaseConn()
+			return diagnostic.NewError("An error occurred while creating temp table", vCreateError)
+		}
+	}
+
+	vStagingInsert, vStagingInsertError := vSelf.dbHelper.createInsert(vSelf.executor, vSelf.transaction, vSelf.tempTable, vFields, InsertOptions{})
+	if vStagingInsertError != nil {
+		vSelf.releaseConn()
+		return diagnostic.NewError("failed to create staging insert", vStagingInsertError)
+	}
+	if _, vBeginError := vStagingInsert.BeginBulk(BulkOptions{Mode: BulkMode_MultiRows, BatchSize: vSelf.batchSize}); vBeginError != nil {
+		vStagingInsert.Close()
+		vSelf.releaseConn()
+		return diagnostic.NewError("failed to begin staging bulk", vBeginError)
+	}
+	vSelf.stagingInsert = vStagingInsert
+	vSelf.updatedRows = 0
+	return nil
+}
+
+//Enqueue a row to update
+//Parameters:
+// pKeyAndValues = values of key fields followed by values of value fields
+func (vSelf *SqlBulkUpdate) Enqueue(pKeyAndValues ...interface{}) error {
+
+	if len(pKeyAndValues) != len(vSelf.keyFields)+len(vSelf.valueFields) {
+		return diagnostic.NewError("bulk update of %s expects %d values, got %d", nil, vSelf.table, len(vSelf.keyFields)+len(vSelf.valueFields), len(pKeyAndValues))
+	}
+
+	_, vStageError := vSelf.stagingInsert.Exec(pKeyAndValues...)
+	if vStageError != nil {
+		return diagnostic.NewError("Error during bulk update staging", vStageError)
+	}
+	vSelf.pendingRowsCount++
+
+	if vSelf.pendingRowsCount == vSelf.batchSize {
+		diagnostic.LogDebug("SqlBulkUpdate.Enqueue", "BulkUpdate batch size of %d reached, forcing commit", vSelf.batchSize)
+		return vSelf.Commit()
+	}
+	return nil
+}
+
+//Commit applies the staged rows to the target table
+func (vSelf *SqlBulkUpdate) Commit() error {
+
+	if vSelf.pendingRowsCount == 0 {
+		return nil
+	}
+
+	vStagingError := vSelf.stagingInsert.Commit()
+	if vStagingError != nil {
+		return diagnostic.NewError("An error occurred while staging rows", vStagingError)
+	}
+
+	vDbType := vSelf.dbHelper.GetDbType()
+	vTable := QuoteIdentifier(vDbType, vSelf.table)
+	vTempTable := QuoteIdentifier(vDbType, vSelf.tempTable)
+
+	vJoin := make([]string, len(vSelf.keyFields))
+	for vCnt, vCurField := range vSelf.keyFields {
+		vJoin[vCnt] = vTempTable + "." + QuoteIdentifier(vDbType, vCurField) + "=" + vTable + "." + QuoteIdentifier(vDbType, vCurField)
+	}
+	vJoinCondition := strings.Join(vJoin, " and ")
+
+	vAssignments := make([]string, len(vSelf.valueFields))
+	var vUpdateStatement string
+	switch vDbType {
+	case DbType_mysql:
+		for vCnt, vCurField := range vSelf.valueFields {
+			vAssignments[vCnt] = vTable + "." + QuoteIdentifier(vDbType, vCurField) + "=" + vTempTable + "." + QuoteIdentifier(vDbType, vCurField)
+		}
+		vUpdateStatement = "update " + vTable + " join " + vTempTable + " on " + vJoinCondition + " set " + strings.Join(vAssignments, ",")
+	default:
+		for vCnt, vCurField := range vSelf.valueFields {
+			vAssignments[vCnt] = QuoteIdentifier(vDbType, vCurField) + "=(select " + vTempTable + "." + QuoteIdentifier(vDbType, vCurField) + " from " + vTempTable + " where " + vJoinCondition + ")"
+		}
+		vUpdateStatement = "update " + vTable + " set " + strings.Join(vAssignments, ",") + " where exists (select 1 from " + vTempTable + " where " + vJoinCondition + ")"
+	}
+
+	vResult, vUpdateError := vSelf.executor.Exec(vUpdateStatement)
+	if vUpdateError != nil {
+		return diagnostic.NewError("An error occurred while commit bulk update", vUpdateError)
+	}
+	if vAffected, vAffectedError := vResult.RowsAffected(); vAffectedError == nil {
+		vSelf.updatedRows += vAffected
+	}
+
+	_, vDeleteError := vSelf.executor.Exec("delete from " + vTempTable)
+	if vDeleteError != nil {
+		return diagnostic.NewError("An error occurred while cleaning temp table during commit", vDeleteError)
+	}
+	vSelf.pendingRowsCount = 0
+	return nil
+}
+
+//End applies the pending rows and drops the temporary table
+func (vSelf *SqlBulkUpdate) End() error {
+
+	if vSelf.stagingInsert == nil {
+		return nil
+	}
+
+	vCommitError := vSelf.Commit()
+
+	vSelf.stagingInsert.Close()
+	vSelf.stagingInsert = nil
+	//drop table commits the transaction in mysql, drop temporary table doesn't
+	vDrop := "drop table "
+	if vSelf.dbHelper.GetDbType() == DbType_mysql {
+		vDrop = "drop temporary table "
+	}
+	_, vDropError := vSelf.executor.Exec(vDrop + QuoteIdentifier(vSelf.dbHelper.GetDbType(), vSelf.tempTable))
+	vSelf.releaseConn()
+
+	if vCommitError != nil {
+		return diagnostic.NewError("Commit failed", vCommitError)
+	}
+	if vDropError != nil {
+		return diagnostic.NewError("failed to drop temp table %s", vDropError, vSelf.tempTable)
+	}
+	return nil
+}
+
+//GetUpdatedRowsCount returns the number of rows updated since Begin
+func (vSelf *SqlBulkUpdate) GetUpdatedRowsCount() int64 {
+	return vSelf.updatedRows
+}
+
+func (vSelf *SqlBulkUpdate) releaseConn() {
+	if vSelf.conn != nil {
+		vSelf.conn.Close()
+		vSelf.conn = nil
+		vSelf.executor = nil
+	}
+}
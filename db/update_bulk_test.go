@@ -0,0 +1,141 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestSqlite3BulkUpdateDelete(pTest *testing.T) {
+
+	vDbHelper := newSqlite3TestDbHelper(pTest, "bulkupdate")
+
+	_, vCreateTableError := vDbHelper.Exec("create table test (groupid integer, itemid integer, value text, primary key (groupid, itemid))")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+	for vCnt := 0; vCnt < 250; vCnt++ {
+		if _, vInsertError := vDbHelper.Exec("insert into test values (?,?,?)", vCnt%2, vCnt, "original"); vInsertError != nil {
+			pTest.Fatal("failed to insert row", vInsertError)
+		}
+	}
+
+	vUpdate, vUpdateError := vDbHelper.CreateBulkUpdate("test", []string{"groupid", "itemid"}, []string{"value"}, BulkOptions{BatchSize: 30})
+	if vUpdateError != nil {
+		pTest.Fatal("failed to create bulk update", vUpdateError)
+	}
+	if vBeginError := vUpdate.Begin(); vBeginError != nil {
+		pTest.Fatal("failed to begin bulk update", vBeginError)
+	}
+	for vCnt := 0; vCnt < 100; vCnt++ {
+		if vEnqueueError := vUpdate.Enqueue(vCnt%2, vCnt, "updated"+strconv.Itoa(vCnt)); vEnqueueError != nil {
+			pTest.Fatal("failed to enqueue update", vEnqueueError)
+		}
+	}
+	//not existing row
+	vUpdate.Enqueue(1, 0, "missing")
+	if vEndError := vUpdate.End(); vEndError != nil {
+		pTest.Fatal("failed to end bulk update", vEndError)
+	}
+	if vUpdate.GetUpdatedRowsCount() != 100 {
+		pTest.Errorf("expected 100 updated rows, got %d", vUpdate.GetUpdatedRowsCount())
+	}
+
+	var vValue string
+	if vQueryError := vDbHelper.GetDb().QueryRow("select value from test where itemid=?", 42).Scan(&vValue); vQueryError != nil || vValue != "updated42" {
+		pTest.Errorf("unexpected value %s %v", vValue, vQueryError)
+	}
+	if vCount := countRows(pTest, vDbHelper, "test where value='original'"); vCount != 150 {
+		pTest.Errorf("expected 150 rows not updated, got %d", vCount)
+	}
+
+	vDelete, vDeleteError := vDbHelper.CreateBulkDelete("test", []string{"itemid"}, BulkOptions{BatchSize: 40})
+	if vDeleteError != nil {
+		pTest.Fatal("failed to create bulk delete", vDeleteError)
+	}
+	vDelete.Begin()
+	for vCnt := 0; vCnt < 100; vCnt++ {
+		if vEnqueueError := vDelete.Enqueue(vCnt); vEnqueueError != nil {
+			pTest.Fatal("failed to enqueue delete", vEnqueueError)
+		}
+	}
+	if vEndError := vDelete.End(); vEndError != nil {
+		pTest.Fatal("failed to end bulk delete", vEndError)
+	}
+	if vDelete.GetDeletedRowsCount() != 100 {
+		pTest.Errorf("expected 100 deleted rows, got %d", vDelete.GetDeletedRowsCount())
+	}
+
+	vTxError := vDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		vCompositeDelete, vCompositeDeleteError := pTx.CreateBulkDelete("test", []string{"groupid", "itemid"}, BulkOptions{BatchSize: 7})
+		if vCompositeDeleteError != nil {
+			return vCompositeDeleteError
+		}
+		vCompositeDelete.Begin()
+		for vCnt := 100; vCnt < 150; vCnt++ {
+			if vEnqueueError := vCompositeDelete.Enqueue(vCnt%2, vCnt); vEnqueueError != nil {
+				return vEnqueueError
+			}
+		}
+		return vCompositeDelete.End()
+	})
+	if vTxError != nil {
+		pTest.Fatal("bulk delete in transaction failed", vTxError)
+	}
+	if vCount := countRows(pTest, vDbHelper, "test"); vCount != 100 {
+		pTest.Errorf("expected 100 remaining rows, got %d", vCount)
+	}
+}
+
+func TestSqlite3BulkUpdateRollback(pTest *testing.T) {
+	testBulkUpdateRollback(pTest, newSqlite3TestDbHelper(pTest, "bulkupdaterollback"))
+}
+
+func TestMysqlBulkUpdateRollback(pTest *testing.T) {
+	testBulkUpdateRollback(pTest, newMysqlTestDbHelper(pTest))
+}
+
+//testBulkUpdateRollback checks that a bulk update inside a transaction is undone by the rollback
+func testBulkUpdateRollback(pTest *testing.T, pDbHelper *DbHelper) {
+
+	vTableName := "__testbulkupdate" + strconv.Itoa(os.Getpid())
+	_, vCreateTableError := pDbHelper.Exec("create table " + vTableName + " (itemid integer primary key, value varchar(20))")
+	if vCreateTableError != nil {
+		pTest.Fatal("failed to create table", vCreateTableError)
+	}
+	defer pDbHelper.Exec("drop table " + vTableName)
+	for vCnt := 0; vCnt < 50; vCnt++ {
+		if _, vInsertError := pDbHelper.Exec("insert into "+vTableName+" values (?,?)", vCnt, "original"); vInsertError != nil {
+			pTest.Fatal("failed to insert row", vInsertError)
+		}
+	}
+
+	vTxError := pDbHelper.InTransaction(func(pTx *DbHelperTx) error {
+		vUpdate, vUpdateError := pTx.CreateBulkUpdate(vTableName, []string{"itemid"}, []string{"value"}, BulkOptions{BatchSize: 20})
+		if vUpdateError != nil {
+			return vUpdateError
+		}
+		if vBeginError := vUpdate.Begin(); vBeginError != nil {
+			return vBeginError
+		}
+		for vCnt := 0; vCnt < 50; vCnt++ {
+			if vEnqueueError := vUpdate.Enqueue(vCnt, "updated"); vEnqueueError != nil {
+				return vEnqueueError
+			}
+		}
+		if vEndError := vUpdate.End(); vEndError != nil {
+			return vEndError
+		}
+		if vUpdate.GetUpdatedRowsCount() != 50 {
+			pTest.Errorf("expected 50 updated rows, got %d", vUpdate.GetUpdatedRowsCount())
+		}
+		return errors.New("forced rollback")
+	})
+	if vTxError == nil {
+		pTest.Fatal("transaction not rolled back")
+	}
+	if vCount := countRows(pTest, pDbHelper, vTableName+" where value='original'"); vCount != 50 {
+		pTest.Errorf("bulk update not rolled back, %d rows not updated", vCount)
+	}
+}
@@ -0,0 +1,109 @@
+package myfileutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//WriteFileAtomic replace the content of a file so that after a crash the file has either the old or the new content.
+//Data are written into a temporary file of the same directory, synced and renamed over the file, then the directory is synced.
+//A new file gets mode 0644, an existing one keeps its mode
+//Parameters:
+// pFile = file to write
+// pData = new content
+// pBackups = number of previous versions kept as pFile.1 (the latest) ... pFile.N, 0 for none
+func WriteFileAtomic(pFile string, pData []byte, pBackups int) (vRisError error) {
+
+	vDir := filepath.Dir(pFile)
+	vMode := os.FileMode(0644)
+	vFileInfo, vStatError := os.Stat(pFile)
+	if vStatError == nil {
+		vMode = vFileInfo.Mode().Perm()
+	} else if os.IsNotExist(vStatError) == false {
+		return diagnostic.NewError("Failed to read file %s", vStatError, pFile)
+	}
+
+	vTempFile, vTempError := ioutil.TempFile(vDir, "."+filepath.Base(pFile)+".tmp")
+	if vTempError != nil {
+		return diagnostic.NewError("Failed to create temporary file for %s", vTempError, pFile)
+	}
+	defer func() {
+		if vRisError != nil {
+			vTempFile.Close()
+			os.Remove(vTempFile.Name())
+		}
+	}()
+
+	if _, vWriteError := vTempFile.Write(pData); vWriteError != nil {
+		return diagnostic.NewError("Failed to write temporary file %s", vWriteError, vTempFile.Name())
+	}
+	if vChmodError := vTempFile.Chmod(vMode); vChmodError != nil {
+		return diagnostic.NewError("Failed to set mode of temporary file %s", vChmodError, vTempFile.Name())
+	}
+	if vSyncError := vTempFile.Sync(); vSyncError != nil {
+		return diagnostic.NewError("Failed to write temporary file %s", vSyncError, vTempFile.Name())
+	}
+	if vCloseError := vTempFile.Close(); vCloseError != nil {
+		return diagnostic.NewError("Failed to write temporary file %s", vCloseError, vTempFile.Name())
+	}
+
+	if pBackups > 0 && vStatError == nil {
+		if vBackupError := rotateBackups(pFile, pBackups); vBackupError != nil {
+			return vBackupError
+		}
+	}
+
+	if vRenameError := os.Rename(vTempFile.Name(), pFile); vRenameError != nil {
+		return diagnostic.NewError("Failed to replace file %s", vRenameError, pFile)
+	}
+
+	return syncDir(vDir)
+}
+
+//rotateBackups shifts the backups of a file and copies the file into pFile.1, the file itself is left in place
+func rotateBackups(pFile string, pBackups int) error {
+
+	vOldest := pFile + "." + strconv.Itoa(pBackups)
+	if vRemoveError := os.Remove(vOldest); vRemoveError != nil && os.IsNotExist(vRemoveError) == false {
+		return diagnostic.NewError("Failed to delete backup %s", vRemoveError, vOldest)
+	}
+	for vCnt := pBackups - 1; vCnt >= 1; vCnt-- {
+		vBackup := pFile + "." + strconv.Itoa(vCnt)
+		vRenameError := os.Rename(vBackup, pFile+"."+strconv.Itoa(vCnt+1))
+		if vRenameError != nil && os.IsNotExist(vRenameError) == false {
+			return diagnostic.NewError("Failed to rotate backup %s", vRenameError, vBackup)
+		}
+	}
+
+	//a hard link keeps the previous version without copying it, filesystems without links get a copy
+	vLatest := pFile + ".1"
+	if os.Link(pFile, vLatest) != nil {
+		if vCopyError := CopyFile(pFile, vLatest); vCopyError != nil {
+			return diagnostic.NewError("Failed to backup file %s", vCopyError, pFile)
+		}
+	}
+	return nil
+}
+
+//syncDir makes durable the entries of a directory, like a renamed file. Not supported on windows
+func syncDir(pDir string) error {
+
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	vDir, vOpenError := os.Open(pDir)
+	if vOpenError != nil {
+		return diagnostic.NewError("Failed to open directory %s", vOpenError, pDir)
+	}
+	defer vDir.Close()
+	if vSyncError := vDir.Sync(); vSyncError != nil {
+		return diagnostic.NewError("Failed to sync directory %s", vSyncError, pDir)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package myfileutils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	//FileLock_WaitForever timeout of LockFile waiting until the lock is acquired
+	FileLock_WaitForever time.Duration = -1
+	fileLock_MaxPollInterval           = 100 * time.Millisecond
+)
+
+//FileLock exclusive advisory lock of a file, shared by processes and by goroutines of the same process.
+//Advisory locks don't prevent access by code not acquiring them
+type FileLock struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+type LockTimeoutError struct {
+	error
+	File    string
+	Timeout time.Duration
+}
+
+func (vSelf *LockTimeoutError) Error() string {
+	return fmt.Sprintf("lock of file %s not acquired within %v", vSelf.File, vSelf.Timeout)
+}
+
+func IsLockTimeout(pError error) bool {
+	if pError == nil {
+		return false
+	}
+	_, vIsLockTimeout := diagnostic.GetMainError(pError, false).(*LockTimeoutError)
+	return vIsLockTimeout
+}
+
+//LockFile acquires the exclusive lock of a file, the file is created if missing and never deleted
+//Parameters:
+// pFile = file to lock
+// pTimeout = max wait, 0 to fail immediately if the file is locked, FileLock_WaitForever to wait indefinitely
+//Returns:
+// the lock, to release by Unlock
+// an error satisfying IsLockTimeout if the lock has not been acquired in time
+func LockFile(pFile string, pTimeout time.Duration) (*FileLock, error) {
+
+	vFile, vOpenError := os.OpenFile(pFile, os.O_RDWR|os.O_CREATE, 0644)
+	if vOpenError != nil {
+		return nil, diagnostic.NewError("Failed to open lock file %s", vOpenError, pFile)
+	}
+
+	vDeadline := time.Now().Add(pTimeout)
+	vPollInterval := time.Millisecond
+	for {
+		vLocked, vLockError := tryLockFile(vFile)
+		if vLockError != nil {
+			vFile.Close()
+			return nil, diagnostic.NewError("Failed to lock file %s", vLockError, pFile)
+		}
+		if vLocked {
+			return &FileLock{file: vFile}, nil
+		}
+		if pTimeout >= 0 && time.Now().After(vDeadline) {
+			vFile.Close()
+			return nil, &LockTimeoutError{File: pFile, Timeout: pTimeout}
+		}
+		time.Sleep(vPollInterval)
+		if vPollInterval < fileLock_MaxPollInterval {
+			vPollInterval *= 2
+		}
+	}
+}
+
+//Unlock releases the lock, further calls do nothing
+func (vSelf *FileLock) Unlock() error {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	if vSelf.file == nil {
+		return nil
+	}
+	vFile := vSelf.file
+	vSelf.file = nil
+	vUnlockError := unlockFile(vFile)
+	//closing the file releases the lock anyway
+	vCloseError := vFile.Close()
+	if vUnlockError != nil {
+		return diagnostic.NewError("Failed to unlock file %s", vUnlockError, vFile.Name())
+	}
+	if vCloseError != nil {
+		return diagnostic.NewError("Failed to close lock file %s", vCloseError, vFile.Name())
+	}
+	return nil
+}
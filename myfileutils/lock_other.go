@@ -0,0 +1,23 @@
+//go:build !unix
+
+package myfileutils
+
+import (
+	"os"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//IsFileLockSupported returns true if the platform implements LockFile
+func IsFileLockSupported() bool {
+	return false
+}
+
+//tryLockFile file locking is implemented only by unix systems
+func tryLockFile(pFile *os.File) (bool, error) {
+	return false, diagnostic.NewError("file locking not supported on this platform", nil)
+}
+
+func unlockFile(pFile *os.File) error {
+	return nil
+}
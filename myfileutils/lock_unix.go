@@ -0,0 +1,34 @@
+//go:build unix
+
+package myfileutils
+
+import (
+	"os"
+	"syscall"
+)
+
+//IsFileLockSupported returns true if the platform implements LockFile
+func IsFileLockSupported() bool {
+	return true
+}
+
+//tryLockFile acquires a flock without waiting, returns false if another file descriptor holds it
+func tryLockFile(pFile *os.File) (bool, error) {
+	for {
+		vError := syscall.Flock(int(pFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch vError {
+		case nil:
+			return true, nil
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		case syscall.EINTR:
+			continue
+		default:
+			return false, vError
+		}
+	}
+}
+
+func unlockFile(pFile *os.File) error {
+	return syscall.Flock(int(pFile.Fd()), syscall.LOCK_UN)
+}
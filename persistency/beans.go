@@ -1,12 +1,13 @@
 package persistency
 
 import (
-	"encoding/json"
-	"os"
 	"bytes"
+	"os"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/myfileutils"
 )
 
 
@@ -30,37 +31,128 @@ func LoadBeanFromFile(pFile string, pBean interface{}) error {
 		return diagnostic.NewError("error while reading file %s", vFileContentError, pFile)
 	}
 
-	vUnmarshalError := json.Unmarshal(vFileContent, pBean)
+	vUpgraded, vUnmarshalError := UnmarshalAndUpgradeBean(vFileContent, pBean)
 
 	if vUnmarshalError != nil {
-		return diagnostic.NewError("error while unmarshalling file %s", vFileContentError, pFile)
+		return diagnostic.NewError("error while unmarshalling file %s", vUnmarshalError, pFile)
+	}
+
+	if vUpgraded && IsBeanUpgradeWriteBack(pBean) {
+		if vWriteBackError := writeBackUpgradedBeanFile(pFile, pBean, vFileContent); vWriteBackError != nil {
+			diagnostic.LogWarning("LoadBeanFromFile", "upgraded bean not saved into %s", vWriteBackError, pFile)
+		}
 	}
 
 	return nil
 }
 
-func SaveBeanIntoFile(pBean interface{},pFile string ) error {
-	
-	vFile,vFileError:=os.Create(pFile)
+//writeBackUpgradedBeanFile saves an upgraded bean with the codec it was loaded with.
+//The file is written only if it is not locked (where file locks are supported) and still has the loaded content,
+//the version of versioned beans is unchanged
+func writeBackUpgradedBeanFile(pFile string, pBean interface{}, pLoadedContent []byte) error {
+
+	if myfileutils.IsFileLockSupported() {
+		vLock, vLockError := LockBeanFile(pFile, 0)
+		if myfileutils.IsLockTimeout(vLockError) {
+			//a LoadBeanForUpdate in progress saves the upgraded bean
+			return nil
+		}
+		if vLockError != nil {
+			return vLockError
+		}
+		defer vLock.Release()
+	}
 
-	if vFileError != nil {
-		return diagnostic.NewError("error while opening file %s", vFileError, pFile)
+	vFileContent, vFileContentError := ioutil.ReadFile(pFile)
+	if vFileContentError != nil || bytes.Equal(vFileContent, pLoadedContent) == false {
+		return vFileContentError
 	}
-	defer vFile.Close()
 
-	vMarshalledBean, vMarshallingError := json.Marshal(pBean)
+	vCodecName, vCodecNameError := GetBeanCodecName(pLoadedContent)
+	if vCodecNameError != nil {
+		return vCodecNameError
+	}
+	var vCodec Codec = IndentedJsonCodec{}
+	if vCodecName != CodecName_Json {
+		vCodec, vCodecNameError = GetCodec(vCodecName)
+		if vCodecNameError != nil {
+			return vCodecNameError
+		}
+	}
 
+	vMarshalledBean, vMarshallingError := MarshalBean(vCodec, pBean)
 	if vMarshallingError != nil {
-		return diagnostic.NewError("Error while marshalling bean to json",vMarshallingError)
+		return vMarshallingError
 	}
+	return myfileutils.WriteFileAtomic(pFile, vMarshalledBean, 0)
+}
 
-	var vNiceJson bytes.Buffer
-	json.Indent(&vNiceJson,vMarshalledBean,"","\t")
+//SaveBeanIntoFile save a bean as indented json
+func SaveBeanIntoFile(pBean interface{},pFile string ) error {
+	return SaveBeanIntoFileWithCodec(pBean, pFile, IndentedJsonCodec{})
+}
 
+//BeanFileOptions settings of SaveBeanIntoFileWithOptions
+type BeanFileOptions struct {
+	//Codec codec of the bean, nil for json
+	Codec Codec
+	//Backups number of previous versions kept as file.1 (the latest) ... file.N, 0 for none
+	Backups int
+}
 
-	_,vWriteError:=vNiceJson.WriteTo(vFile)
+//SaveBeanIntoFileWithCodec save a bean serialized by a codec, LoadBeanFromFile detects the codec from the file content
+//Parameters:
+// pBean = bean to save
+// pFile = destination file
+// pCodec = codec, nil for json
+func SaveBeanIntoFileWithCodec(pBean interface{}, pFile string, pCodec Codec) error {
+	return SaveBeanIntoFileWithOptions(pBean, pFile, BeanFileOptions{Codec: pCodec})
+}
+
+//SaveBeanIntoFileWithOptions save a bean atomically: after a crash the file contains either the previous or the new bean (see myfileutils.WriteFileAtomic).
+//The lock of the file (see LockBeanFile) is held during the save, on platforms supporting it
+//Parameters:
+// pBean = bean to save
+// pFile = destination file
+// pOptions = codec and backups
+func SaveBeanIntoFileWithOptions(pBean interface{}, pFile string, pOptions BeanFileOptions) error {
+
+	if myfileutils.IsFileLockSupported() {
+		vLock, vLockError := LockBeanFile(pFile, BeanFile_SaveLockTimeout)
+		if vLockError != nil {
+			return vLockError
+		}
+		defer vLock.Release()
+	}
+	return saveBeanIntoFile(pBean, pFile, pOptions)
+}
+
+//saveBeanIntoFile save a bean like SaveBeanIntoFileWithOptions, the caller holds the lock of the file
+func saveBeanIntoFile(pBean interface{}, pFile string, pOptions BeanFileOptions) (vRisError error) {
+
+	if vVersioned, vIsVersioned := pBean.(VersionedBean); vIsVersioned {
+		vVersion := vVersioned.GetBeanVersion()
+		vVersionError := checkBeanFileVersion(vVersioned, pFile)
+		if vVersionError != nil {
+			return vVersionError
+		}
+		vVersioned.SetBeanVersion(vVersion + 1)
+		defer func() {
+			if vRisError != nil {
+				vVersioned.SetBeanVersion(vVersion)
+			}
+		}()
+	}
+	
+	vMarshalledBean, vMarshallingError := MarshalBean(pOptions.Codec, pBean)
+
+	if vMarshallingError != nil {
+		return vMarshallingError
+	}
+
+	vWriteError := myfileutils.WriteFileAtomic(pFile, vMarshalledBean, pOptions.Backups)
 	if vWriteError != nil {
-		return diagnostic.NewError("Error while marshalling bean to json",vWriteError)
+		return diagnostic.NewError("error while writing file %s", vWriteError, pFile)
 	}
 
 	return nil
@@ -78,3 +170,74 @@ func IsBeanNotFound(pError error) bool {
 
 	return vIsBeanNotFound
 }
+
+
+//VersionedBean beans implementing it are saved only if the stored copy still has the version they have been loaded with.
+//The version is increased by each save, new beans have version 0
+type VersionedBean interface {
+	GetBeanVersion() int64
+	SetBeanVersion(int64)
+}
+
+type ConcurrentModificationError struct {
+	error
+	BeanID          string
+	ExpectedVersion int64
+}
+
+func (vSelf *ConcurrentModificationError) Error() string {
+	return fmt.Sprintf("Bean with id %s has been modified, expected version %d", vSelf.BeanID, vSelf.ExpectedVersion)
+}
+
+func IsConcurrentModification(pError error) bool {
+	if pError == nil {
+		return false
+	}
+
+	vMainError := diagnostic.GetMainError(pError,false)
+
+	_,vIsConcurrentModification := vMainError.(*ConcurrentModificationError)
+
+	return vIsConcurrentModification
+}
+
+//checkBeanFileVersion verify that the file contains the same version of the bean, a missing file has version 0
+func checkBeanFileVersion(pBean VersionedBean, pFile string) error {
+
+	vFileContent, vFileContentError := ioutil.ReadFile(pFile)
+	if os.IsNotExist(vFileContentError) {
+		vFileContent = nil
+	} else if vFileContentError != nil {
+		return diagnostic.NewError("error while reading file %s", vFileContentError, pFile)
+	}
+
+	return checkStoredBeanVersion(pBean, vFileContent, pFile)
+}
+
+//checkStoredBeanVersion verify that the stored copy of a bean has the same version of the bean, a missing copy has version 0
+//Parameters:
+// pBean = bean to save
+// pStoredData = serialized stored copy, nil if missing
+// pId = id of the bean reported by errors
+func checkStoredBeanVersion(pBean VersionedBean, pStoredData []byte, pId string) error {
+
+	var vStoredVersion int64
+	if pStoredData != nil {
+		vBeanType := reflect.TypeOf(pBean)
+		if vBeanType.Kind() != reflect.Ptr {
+			return diagnostic.NewError("versioned bean %T must be a pointer", nil, pBean)
+		}
+		vStored := reflect.New(vBeanType.Elem()).Interface()
+		//the stored copy is replaced also if invalid
+		_, vUnmarshalError := unmarshalAndUpgradeBean(pStoredData, vStored)
+		if vUnmarshalError != nil {
+			return diagnostic.NewError("error while unmarshalling stored bean %s", vUnmarshalError, pId)
+		}
+		vStoredVersion = vStored.(VersionedBean).GetBeanVersion()
+	}
+
+	if vStoredVersion != pBean.GetBeanVersion() {
+		return &ConcurrentModificationError{BeanID: pId, ExpectedVersion: pBean.GetBeanVersion()}
+	}
+	return nil
+}
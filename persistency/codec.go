@@ -0,0 +1,245 @@
+package persistency
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	CodecName_Json         = "json"
+	CodecName_IndentedJson = "json-indent"
+	CodecName_Gob          = "gob"
+	CodecName_Cbor         = "cbor"
+	//codec_Marker prefix of beans serialized by codecs other than json, followed by the codec name and a new line.
+	//Json documents never begin with a NUL character, so beans without marker are json
+	codec_Marker = "\x00codec:"
+)
+
+var (
+	_CodecsLock sync.RWMutex
+	_Codecs     = map[string]Codec{
+		CodecName_Json:         JsonCodec{},
+		CodecName_IndentedJson: IndentedJsonCodec{},
+		CodecName_Gob:          GobCodec{},
+		CodecName_Cbor:         CborCodec{}}
+)
+
+//Codec serializes beans
+type Codec interface {
+	//GetName returns the name of the codec, stored with the beans to read them after switching codec
+	GetName() string
+	Marshal(pBean interface{}) ([]byte, error)
+	Unmarshal(pData []byte, pBean interface{}) error
+}
+
+//RegisterCodec makes a codec available to UnmarshalBean and GetCodec
+func RegisterCodec(pCodec Codec) error {
+	if pCodec.GetName() == "" || strings.ContainsAny(pCodec.GetName(), "+\n") {
+		return diagnostic.NewError("invalid codec name %s", nil, pCodec.GetName())
+	}
+	_CodecsLock.Lock()
+	defer _CodecsLock.Unlock()
+	_Codecs[pCodec.GetName()] = pCodec
+	return nil
+}
+
+//GetCodec returns a codec by name, names of compressed and encrypted codecs are composed by the codec and the wrappers (ex. json+gzip+aesgcm).
+//Encrypted codecs use the default key ring (see SetDefaultEncryptionKeyRing)
+func GetCodec(pName string) (Codec, error) {
+
+	if vPlus := strings.LastIndex(pName, "+"); vPlus > 0 {
+		vCodec, vCodecError := GetCodec(pName[:vPlus])
+		if vCodecError != nil {
+			return nil, vCodecError
+		}
+		if pName[vPlus+1:] == Encryption_AesGcm {
+			return NewEncryptedCodec(vCodec, nil), nil
+		}
+		return NewCompressedCodec(vCodec, pName[vPlus+1:])
+	}
+
+	_CodecsLock.RLock()
+	defer _CodecsLock.RUnlock()
+	vRis := _Codecs[pName]
+	if vRis == nil {
+		return nil, diagnostic.NewError("unknown codec %s", nil, pName)
+	}
+	return vRis, nil
+}
+
+//IsJsonCodec returns true if a codec produces plain json, such beans are stored without codec marker and can be queried by json functions
+func IsJsonCodec(pCodec Codec) bool {
+	return pCodec == nil || pCodec.GetName() == CodecName_Json || pCodec.GetName() == CodecName_IndentedJson
+}
+
+//MarshalBean validate and serialize a bean (see ValidateBean), the result begins with the codec marker unless the codec produces json
+//Parameters:
+// pCodec = codec, nil for json
+// pBean = bean to serialize
+func MarshalBean(pCodec Codec, pBean interface{}) ([]byte, error) {
+
+	if pCodec == nil {
+		pCodec = JsonCodec{}
+	}
+
+	if vValidateError := ValidateBean(pBean); vValidateError != nil {
+		return nil, vValidateError
+	}
+
+	var vMarshalled interface{} = pBean
+	if vSchemaVersioned, vIsSchemaVersioned := pBean.(SchemaVersionedBean); vIsSchemaVersioned && isJsonBasedCodec(pCodec) {
+		vStamped, vStampError := stampBeanSchema(vSchemaVersioned)
+		if vStampError != nil {
+			return nil, diagnostic.NewError("Error while marshalling bean with codec %s", vStampError, pCodec.GetName())
+		}
+		vMarshalled = vStamped
+	}
+
+	vData, vMarshalError := pCodec.Marshal(vMarshalled)
+	if vMarshalError != nil {
+		return nil, diagnostic.NewError("Error while marshalling bean with codec %s", vMarshalError, pCodec.GetName())
+	}
+	if IsJsonCodec(pCodec) {
+		return vData, nil
+	}
+
+	vRis := make([]byte, 0, len(codec_Marker)+len(pCodec.GetName())+1+len(vData))
+	vRis = append(vRis, codec_Marker...)
+	vRis = append(vRis, pCodec.GetName()...)
+	vRis = append(vRis, '\n')
+	return append(vRis, vData...), nil
+}
+
+//UnmarshalBean deserialize a bean serialized by MarshalBean with any registered codec, beans implementing SchemaVersionedBean are upgraded.
+//The bean is validated (see ValidateBean), invalid beans are returned with an error satisfying IsValidationError
+func UnmarshalBean(pData []byte, pBean interface{}) error {
+	_, vUnmarshalError := UnmarshalAndUpgradeBean(pData, pBean)
+	return vUnmarshalError
+}
+
+//unmarshalBeanData deserialize a bean without upgrading it
+func unmarshalBeanData(pData []byte, pBean interface{}) error {
+
+	vCodec, vPayload, vCodecError := splitCodecMarker(pData)
+	if vCodecError != nil {
+		return vCodecError
+	}
+
+	vUnmarshalError := vCodec.Unmarshal(vPayload, pBean)
+	if vUnmarshalError != nil {
+		return diagnostic.NewError("Error while unmarshalling bean with codec %s", vUnmarshalError, vCodec.GetName())
+	}
+	return nil
+}
+
+//GetBeanCodecName returns the name of the codec of a serialized bean
+func GetBeanCodecName(pData []byte) (string, error) {
+	vCodec, _, vCodecError := splitCodecMarker(pData)
+	if vCodecError != nil {
+		return "", vCodecError
+	}
+	return vCodec.GetName(), nil
+}
+
+//BeanDataToJson converts a serialized bean to json without knowing its type.
+//Codecs requiring the type of the bean, like gob, are not supported
+func BeanDataToJson(pData []byte) ([]byte, error) {
+
+	vCodec, vPayload, vCodecError := splitCodecMarker(pData)
+	if vCodecError != nil {
+		return nil, vCodecError
+	}
+	if IsJsonCodec(vCodec) {
+		return vPayload, nil
+	}
+
+	//codecs based on json fill the raw message as is, so numbers keep their precision
+	var vRaw json.RawMessage
+	if vCodec.Unmarshal(vPayload, &vRaw) == nil {
+		return vRaw, nil
+	}
+
+	var vGeneric interface{}
+	vUnmarshalError := vCodec.Unmarshal(vPayload, &vGeneric)
+	if vUnmarshalError != nil {
+		return nil, diagnostic.NewError("codec %s can't be converted to json", vUnmarshalError, vCodec.GetName())
+	}
+	vRis, vMarshalError := json.Marshal(vGeneric)
+	if vMarshalError != nil {
+		return nil, diagnostic.NewError("codec %s can't be converted to json", vMarshalError, vCodec.GetName())
+	}
+	return vRis, nil
+}
+
+//splitCodecMarker returns the codec of a serialized bean and the data following the marker
+func splitCodecMarker(pData []byte) (Codec, []byte, error) {
+
+	if bytes.HasPrefix(pData, []byte(codec_Marker)) == false {
+		return JsonCodec{}, pData, nil
+	}
+
+	vEnd := bytes.IndexByte(pData, '\n')
+	if vEnd < 0 {
+		return nil, nil, diagnostic.NewError("invalid codec marker", nil)
+	}
+	vCodec, vCodecError := GetCodec(string(pData[len(codec_Marker):vEnd]))
+	if vCodecError != nil {
+		return nil, nil, vCodecError
+	}
+	return vCodec, pData[vEnd+1:], nil
+}
+
+//JsonCodec compact json
+type JsonCodec struct{}
+
+func (vSelf JsonCodec) GetName() string {
+	return CodecName_Json
+}
+
+func (vSelf JsonCodec) Marshal(pBean interface{}) ([]byte, error) {
+	return json.Marshal(pBean)
+}
+
+func (vSelf JsonCodec) Unmarshal(pData []byte, pBean interface{}) error {
+	return json.Unmarshal(pData, pBean)
+}
+
+//IndentedJsonCodec json indented by tabs, readable by JsonCodec
+type IndentedJsonCodec struct{}
+
+func (vSelf IndentedJsonCodec) GetName() string {
+	return CodecName_IndentedJson
+}
+
+func (vSelf IndentedJsonCodec) Marshal(pBean interface{}) ([]byte, error) {
+	return json.MarshalIndent(pBean, "", "\t")
+}
+
+func (vSelf IndentedJsonCodec) Unmarshal(pData []byte, pBean interface{}) error {
+	return json.Unmarshal(pData, pBean)
+}
+
+//GobCodec encoding/gob, beans must be pointers to concrete types
+type GobCodec struct{}
+
+func (vSelf GobCodec) GetName() string {
+	return CodecName_Gob
+}
+
+func (vSelf GobCodec) Marshal(pBean interface{}) ([]byte, error) {
+	var vRis bytes.Buffer
+	vEncodeError := gob.NewEncoder(&vRis).Encode(pBean)
+	if vEncodeError != nil {
+		return nil, vEncodeError
+	}
+	return vRis.Bytes(), nil
+}
+
+func (vSelf GobCodec) Unmarshal(pData []byte, pBean interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(pData)).Decode(pBean)
+}
@@ -0,0 +1,302 @@
+package persistency
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	cbor_MajorUnsigned = 0
+	cbor_MajorNegative = 1
+	cbor_MajorBytes    = 2
+	cbor_MajorText     = 3
+	cbor_MajorArray    = 4
+	cbor_MajorMap      = 5
+	cbor_MajorTag      = 6
+	cbor_MajorSimple   = 7
+	cbor_False         = 0xf4
+	cbor_True          = 0xf5
+	cbor_Null          = 0xf6
+	cbor_Float64       = 0xfb
+	cbor_MaxDepth      = 1000
+)
+
+//CborCodec CBOR (RFC 8949) encoding of the json representation of the beans, so json tags and custom json marshallers are honored.
+//Map keys are sorted, indefinite lengths are not supported
+type CborCodec struct{}
+
+func (vSelf CborCodec) GetName() string {
+	return CodecName_Cbor
+}
+
+func (vSelf CborCodec) Marshal(pBean interface{}) ([]byte, error) {
+
+	vJson, vJsonError := json.Marshal(pBean)
+	if vJsonError != nil {
+		return nil, vJsonError
+	}
+
+	vDecoder := json.NewDecoder(bytes.NewReader(vJson))
+	vDecoder.UseNumber()
+	var vGeneric interface{}
+	if vDecodeError := vDecoder.Decode(&vGeneric); vDecodeError != nil {
+		return nil, vDecodeError
+	}
+
+	var vRis bytes.Buffer
+	if vEncodeError := cborEncode(&vRis, vGeneric); vEncodeError != nil {
+		return nil, vEncodeError
+	}
+	return vRis.Bytes(), nil
+}
+
+func (vSelf CborCodec) Unmarshal(pData []byte, pBean interface{}) error {
+
+	vDecoder := &cborDecoder{data: pData}
+	vGeneric, vDecodeError := vDecoder.decode(0)
+	if vDecodeError != nil {
+		return vDecodeError
+	}
+	if vDecoder.offset != len(pData) {
+		return diagnostic.NewError("%d bytes following cbor item", nil, len(pData)-vDecoder.offset)
+	}
+
+	vJson, vJsonError := json.Marshal(vGeneric)
+	if vJsonError != nil {
+		return vJsonError
+	}
+	return json.Unmarshal(vJson, pBean)
+}
+
+func cborWriteHead(pBuffer *bytes.Buffer, pMajor byte, pValue uint64) {
+	var vHead [9]byte
+	vHead[0] = pMajor << 5
+	vLength := 1
+	switch {
+	case pValue < 24:
+		vHead[0] |= byte(pValue)
+	case pValue <= math.MaxUint8:
+		vHead[0] |= 24
+		vHead[1] = byte(pValue)
+		vLength = 2
+	case pValue <= math.MaxUint16:
+		vHead[0] |= 25
+		binary.BigEndian.PutUint16(vHead[1:], uint16(pValue))
+		vLength = 3
+	case pValue <= math.MaxUint32:
+		vHead[0] |= 26
+		binary.BigEndian.PutUint32(vHead[1:], uint32(pValue))
+		vLength = 5
+	default:
+		vHead[0] |= 27
+		binary.BigEndian.PutUint64(vHead[1:], pValue)
+		vLength = 9
+	}
+	pBuffer.Write(vHead[:vLength])
+}
+
+//cborEncode writes a value decoded from json with UseNumber
+func cborEncode(pBuffer *bytes.Buffer, pValue interface{}) error {
+
+	switch vValue := pValue.(type) {
+	case nil:
+		pBuffer.WriteByte(cbor_Null)
+	case bool:
+		if vValue {
+			pBuffer.WriteByte(cbor_True)
+		} else {
+			pBuffer.WriteByte(cbor_False)
+		}
+	case json.Number:
+		if vInt, vIntError := vValue.Int64(); vIntError == nil {
+			if vInt >= 0 {
+				cborWriteHead(pBuffer, cbor_MajorUnsigned, uint64(vInt))
+			} else {
+				cborWriteHead(pBuffer, cbor_MajorNegative, uint64(-1-vInt))
+			}
+			return nil
+		}
+		vFloat, vFloatError := vValue.Float64()
+		if vFloatError != nil {
+			return diagnostic.NewError("invalid number %s", vFloatError, vValue)
+		}
+		var vFloatBytes [9]byte
+		vFloatBytes[0] = cbor_Float64
+		binary.BigEndian.PutUint64(vFloatBytes[1:], math.Float64bits(vFloat))
+		pBuffer.Write(vFloatBytes[:])
+	case string:
+		cborWriteHead(pBuffer, cbor_MajorText, uint64(len(vValue)))
+		pBuffer.WriteString(vValue)
+	case []interface{}:
+		cborWriteHead(pBuffer, cbor_MajorArray, uint64(len(vValue)))
+		for _, vCurItem := range vValue {
+			if vItemError := cborEncode(pBuffer, vCurItem); vItemError != nil {
+				return vItemError
+			}
+		}
+	case map[string]interface{}:
+		vKeys := make([]string, 0, len(vValue))
+		for vCurKey := range vValue {
+			vKeys = append(vKeys, vCurKey)
+		}
+		sort.Strings(vKeys)
+		cborWriteHead(pBuffer, cbor_MajorMap, uint64(len(vKeys)))
+		for _, vCurKey := range vKeys {
+			cborWriteHead(pBuffer, cbor_MajorText, uint64(len(vCurKey)))
+			pBuffer.WriteString(vCurKey)
+			if vItemError := cborEncode(pBuffer, vValue[vCurKey]); vItemError != nil {
+				return vItemError
+			}
+		}
+	default:
+		return diagnostic.NewError("unsupported value of type %T", nil, pValue)
+	}
+	return nil
+}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+func (vSelf *cborDecoder) read(pLength uint64) ([]byte, error) {
+	if pLength > uint64(len(vSelf.data)-vSelf.offset) {
+		return nil, diagnostic.NewError("truncated cbor data at offset %d", nil, vSelf.offset)
+	}
+	vRis := vSelf.data[vSelf.offset : vSelf.offset+int(pLength)]
+	vSelf.offset += int(pLength)
+	return vRis, nil
+}
+
+//readHead returns major type, additional information and argument of the next item
+func (vSelf *cborDecoder) readHead() (byte, byte, uint64, error) {
+
+	vFirst, vFirstError := vSelf.read(1)
+	if vFirstError != nil {
+		return 0, 0, 0, vFirstError
+	}
+	vMajor, vInfo := vFirst[0]>>5, vFirst[0]&0x1f
+
+	switch {
+	case vInfo < 24:
+		return vMajor, vInfo, uint64(vInfo), nil
+	case vInfo <= 27:
+		vArgument, vArgumentError := vSelf.read(1 << (vInfo - 24))
+		if vArgumentError != nil {
+			return 0, 0, 0, vArgumentError
+		}
+		var vRis uint64
+		for _, vCurByte := range vArgument {
+			vRis = vRis<<8 | uint64(vCurByte)
+		}
+		return vMajor, vInfo, vRis, nil
+	default:
+		return 0, 0, 0, diagnostic.NewError("unsupported cbor additional information %d at offset %d", nil, vInfo, vSelf.offset-1)
+	}
+}
+
+func (vSelf *cborDecoder) decode(pDepth int) (interface{}, error) {
+
+	if pDepth > cbor_MaxDepth {
+		return nil, diagnostic.NewError("cbor nesting exceeds %d levels", nil, cbor_MaxDepth)
+	}
+
+	vMajor, vInfo, vArgument, vHeadError := vSelf.readHead()
+	if vHeadError != nil {
+		return nil, vHeadError
+	}
+
+	switch vMajor {
+	case cbor_MajorUnsigned:
+		return vArgument, nil
+	case cbor_MajorNegative:
+		if vArgument > math.MaxInt64 {
+			return nil, diagnostic.NewError("cbor negative integer out of range", nil)
+		}
+		return -1 - int64(vArgument), nil
+	case cbor_MajorBytes:
+		return vSelf.read(vArgument)
+	case cbor_MajorText:
+		vText, vTextError := vSelf.read(vArgument)
+		return string(vText), vTextError
+	case cbor_MajorArray:
+		if vArgument > uint64(len(vSelf.data)) {
+			return nil, diagnostic.NewError("invalid cbor array length %d", nil, vArgument)
+		}
+		vRis := make([]interface{}, 0, vArgument)
+		for vCnt := uint64(0); vCnt < vArgument; vCnt++ {
+			vItem, vItemError := vSelf.decode(pDepth + 1)
+			if vItemError != nil {
+				return nil, vItemError
+			}
+			vRis = append(vRis, vItem)
+		}
+		return vRis, nil
+	case cbor_MajorMap:
+		if vArgument > uint64(len(vSelf.data)) {
+			return nil, diagnostic.NewError("invalid cbor map length %d", nil, vArgument)
+		}
+		vRis := make(map[string]interface{}, vArgument)
+		for vCnt := uint64(0); vCnt < vArgument; vCnt++ {
+			vKey, vKeyError := vSelf.decode(pDepth + 1)
+			if vKeyError != nil {
+				return nil, vKeyError
+			}
+			vValue, vValueError := vSelf.decode(pDepth + 1)
+			if vValueError != nil {
+				return nil, vValueError
+			}
+			if vText, vIsText := vKey.(string); vIsText {
+				vRis[vText] = vValue
+			} else {
+				vRis[fmt.Sprint(vKey)] = vValue
+			}
+		}
+		return vRis, nil
+	case cbor_MajorTag:
+		//tags are ignored, the content is returned
+		return vSelf.decode(pDepth + 1)
+	default:
+		switch vInfo {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return float64(cborHalfToFloat(uint16(vArgument))), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(vArgument))), nil
+		case 27:
+			return math.Float64frombits(vArgument), nil
+		}
+		return nil, diagnostic.NewError("unsupported cbor simple value %d", nil, vArgument)
+	}
+}
+
+//cborHalfToFloat converts an IEEE 754 half precision number
+func cborHalfToFloat(pHalf uint16) float32 {
+	vSign := uint32(pHalf&0x8000) << 16
+	vExponent := uint32(pHalf>>10) & 0x1f
+	vMantissa := uint32(pHalf & 0x3ff)
+
+	switch vExponent {
+	case 0:
+		vRis := float32(math.Ldexp(float64(vMantissa), -24))
+		if vSign != 0 {
+			vRis = -vRis
+		}
+		return vRis
+	case 0x1f:
+		return math.Float32frombits(vSign | 0x7f800000 | vMantissa<<13)
+	default:
+		return math.Float32frombits(vSign | (vExponent+112)<<23 | vMantissa<<13)
+	}
+}
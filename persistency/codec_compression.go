@@ -0,0 +1,91 @@
+package persistency
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	Compression_Gzip  = "gzip"
+	Compression_Flate = "flate"
+)
+
+//compressedCodec compresses the output of another codec
+type compressedCodec struct {
+	codec       Codec
+	compression string
+}
+
+//NewCompressedCodec wraps a codec compressing its output, the name of the result is codec name+compression (ex. json+gzip).
+//Compressed beans are stored with codec marker, so they can't be queried by json functions
+//Parameters:
+// pCodec = codec to compress
+// pCompression = Compression_Gzip or Compression_Flate
+func NewCompressedCodec(pCodec Codec, pCompression string) (Codec, error) {
+	switch pCompression {
+	case Compression_Gzip, Compression_Flate:
+	default:
+		return nil, diagnostic.NewError("unsupported compression %s", nil, pCompression)
+	}
+	return &compressedCodec{codec: pCodec, compression: pCompression}, nil
+}
+
+func (vSelf *compressedCodec) GetName() string {
+	return vSelf.codec.GetName() + "+" + vSelf.compression
+}
+
+func (vSelf *compressedCodec) Marshal(pBean interface{}) ([]byte, error) {
+
+	vData, vMarshalError := vSelf.codec.Marshal(pBean)
+	if vMarshalError != nil {
+		return nil, vMarshalError
+	}
+
+	var vRis bytes.Buffer
+	var vWriter io.WriteCloser
+	switch vSelf.compression {
+	case Compression_Gzip:
+		vWriter = gzip.NewWriter(&vRis)
+	default:
+		vFlateWriter, vFlateError := flate.NewWriter(&vRis, flate.DefaultCompression)
+		if vFlateError != nil {
+			return nil, vFlateError
+		}
+		vWriter = vFlateWriter
+	}
+
+	if _, vWriteError := vWriter.Write(vData); vWriteError != nil {
+		return nil, diagnostic.NewError("%s compression failed", vWriteError, vSelf.compression)
+	}
+	if vCloseError := vWriter.Close(); vCloseError != nil {
+		return nil, diagnostic.NewError("%s compression failed", vCloseError, vSelf.compression)
+	}
+	return vRis.Bytes(), nil
+}
+
+func (vSelf *compressedCodec) Unmarshal(pData []byte, pBean interface{}) error {
+
+	var vReader io.ReadCloser
+	switch vSelf.compression {
+	case Compression_Gzip:
+		vGzipReader, vGzipError := gzip.NewReader(bytes.NewReader(pData))
+		if vGzipError != nil {
+			return diagnostic.NewError("gzip decompression failed", vGzipError)
+		}
+		vReader = vGzipReader
+	default:
+		vReader = flate.NewReader(bytes.NewReader(pData))
+	}
+	defer vReader.Close()
+
+	vData, vReadError := ioutil.ReadAll(vReader)
+	if vReadError != nil {
+		return diagnostic.NewError("%s decompression failed", vReadError, vSelf.compression)
+	}
+	return vSelf.codec.Unmarshal(vData, pBean)
+}
@@ -0,0 +1,243 @@
+package persistency
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	Encryption_AesGcm = "aesgcm"
+)
+
+var (
+	_DefaultKeyRingLock sync.RWMutex
+	_DefaultKeyRing     *EncryptionKeyRing
+)
+
+//EncryptionKeyRing keys of the encrypting codec. Beans are encrypted by the current key and decrypted by the key they have been encrypted with,
+//so keys replaced by a rotation must be kept until beans are rewrapped (see RewrapBeanFiles)
+type EncryptionKeyRing struct {
+	lock         sync.RWMutex
+	keys         map[string]cipher.AEAD
+	currentKeyId string
+}
+
+//NewEncryptionKeyRing create an empty key ring
+func NewEncryptionKeyRing() *EncryptionKeyRing {
+	return &EncryptionKeyRing{keys: make(map[string]cipher.AEAD)}
+}
+
+//SetDefaultEncryptionKeyRing sets the key ring used by encrypting codecs created without key ring,
+//like the ones obtained by GetCodec while unmarshalling beans
+func SetDefaultEncryptionKeyRing(pKeyRing *EncryptionKeyRing) {
+	_DefaultKeyRingLock.Lock()
+	defer _DefaultKeyRingLock.Unlock()
+	_DefaultKeyRing = pKeyRing
+}
+
+//GetDefaultEncryptionKeyRing returns the key ring set by SetDefaultEncryptionKeyRing
+func GetDefaultEncryptionKeyRing() *EncryptionKeyRing {
+	_DefaultKeyRingLock.RLock()
+	defer _DefaultKeyRingLock.RUnlock()
+	return _DefaultKeyRing
+}
+
+//AddKey adds a key to the ring, the first key added becomes the current one
+//Parameters:
+// pKeyId = identifier stored with the encrypted beans, at most 255 bytes
+// pKey = AES key of 16, 24 or 32 bytes
+func (vSelf *EncryptionKeyRing) AddKey(pKeyId string, pKey []byte) error {
+
+	if pKeyId == "" || len(pKeyId) > 255 {
+		return diagnostic.NewError("invalid key id %s", nil, pKeyId)
+	}
+
+	vBlock, vBlockError := aes.NewCipher(pKey)
+	if vBlockError != nil {
+		return diagnostic.NewError("invalid key %s", vBlockError, pKeyId)
+	}
+	vAead, vAeadError := cipher.NewGCM(vBlock)
+	if vAeadError != nil {
+		return diagnostic.NewError("invalid key %s", vAeadError, pKeyId)
+	}
+
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	vSelf.keys[pKeyId] = vAead
+	if vSelf.currentKeyId == "" {
+		vSelf.currentKeyId = pKeyId
+	}
+	return nil
+}
+
+//SetCurrentKey sets the key encrypting new beans
+func (vSelf *EncryptionKeyRing) SetCurrentKey(pKeyId string) error {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	if vSelf.keys[pKeyId] == nil {
+		return diagnostic.NewError("unknown key %s", nil, pKeyId)
+	}
+	vSelf.currentKeyId = pKeyId
+	return nil
+}
+
+//GetCurrentKeyId returns the id of the key encrypting new beans
+func (vSelf *EncryptionKeyRing) GetCurrentKeyId() string {
+	vSelf.lock.RLock()
+	defer vSelf.lock.RUnlock()
+	return vSelf.currentKeyId
+}
+
+//encrypt returns key id length, key id, nonce and ciphertext
+func (vSelf *EncryptionKeyRing) encrypt(pPlain []byte, pAdditionalData []byte) ([]byte, error) {
+
+	vSelf.lock.RLock()
+	vKeyId := vSelf.currentKeyId
+	vAead := vSelf.keys[vKeyId]
+	vSelf.lock.RUnlock()
+	if vAead == nil {
+		return nil, diagnostic.NewError("encryption key ring without keys", nil)
+	}
+
+	vRis := make([]byte, 1+len(vKeyId)+vAead.NonceSize(), 1+len(vKeyId)+vAead.NonceSize()+len(pPlain)+vAead.Overhead())
+	vRis[0] = byte(len(vKeyId))
+	copy(vRis[1:], vKeyId)
+	vNonce := vRis[1+len(vKeyId):]
+	if _, vNonceError := io.ReadFull(rand.Reader, vNonce); vNonceError != nil {
+		return nil, diagnostic.NewError("failed to generate nonce", vNonceError)
+	}
+	return vAead.Seal(vRis, vNonce, pPlain, pAdditionalData), nil
+}
+
+//decrypt returns plain data and id of the key
+func (vSelf *EncryptionKeyRing) decrypt(pData []byte, pAdditionalData []byte) ([]byte, string, error) {
+
+	if len(pData) < 1 || len(pData) < 1+int(pData[0]) {
+		return nil, "", diagnostic.NewError("invalid encrypted data", nil)
+	}
+	vKeyId := string(pData[1 : 1+int(pData[0])])
+
+	vSelf.lock.RLock()
+	vAead := vSelf.keys[vKeyId]
+	vSelf.lock.RUnlock()
+	if vAead == nil {
+		return nil, vKeyId, diagnostic.NewError("unknown key %s", nil, vKeyId)
+	}
+
+	vNonceStart := 1 + len(vKeyId)
+	if len(pData) < vNonceStart+vAead.NonceSize() {
+		return nil, vKeyId, diagnostic.NewError("invalid encrypted data", nil)
+	}
+	vPlain, vOpenError := vAead.Open(nil, pData[vNonceStart:vNonceStart+vAead.NonceSize()], pData[vNonceStart+vAead.NonceSize():], pAdditionalData)
+	if vOpenError != nil {
+		return nil, vKeyId, diagnostic.NewError("failed to decrypt data with key %s", vOpenError, vKeyId)
+	}
+	return vPlain, vKeyId, nil
+}
+
+//encryptedCodec encrypts the output of another codec with AES-GCM
+type encryptedCodec struct {
+	codec   Codec
+	keyRing *EncryptionKeyRing
+}
+
+//NewEncryptedCodec wraps a codec encrypting its output, the name of the result is codec name+aesgcm (ex. json+gzip+aesgcm).
+//The name of the codec is authenticated together with the data
+//Parameters:
+// pCodec = codec to encrypt, compression must precede encryption
+// pKeyRing = keys, nil for the default key ring at the time of use (see SetDefaultEncryptionKeyRing)
+func NewEncryptedCodec(pCodec Codec, pKeyRing *EncryptionKeyRing) Codec {
+	return &encryptedCodec{codec: pCodec, keyRing: pKeyRing}
+}
+
+func (vSelf *encryptedCodec) GetName() string {
+	return vSelf.codec.GetName() + "+" + Encryption_AesGcm
+}
+
+func (vSelf *encryptedCodec) getKeyRing() (*EncryptionKeyRing, error) {
+	vRis := vSelf.keyRing
+	if vRis == nil {
+		vRis = GetDefaultEncryptionKeyRing()
+	}
+	if vRis == nil {
+		return nil, diagnostic.NewError("no encryption key ring for codec %s", nil, vSelf.GetName())
+	}
+	return vRis, nil
+}
+
+func (vSelf *encryptedCodec) Marshal(pBean interface{}) ([]byte, error) {
+
+	vKeyRing, vKeyRingError := vSelf.getKeyRing()
+	if vKeyRingError != nil {
+		return nil, vKeyRingError
+	}
+
+	vData, vMarshalError := vSelf.codec.Marshal(pBean)
+	if vMarshalError != nil {
+		return nil, vMarshalError
+	}
+	return vKeyRing.encrypt(vData, []byte(vSelf.GetName()))
+}
+
+func (vSelf *encryptedCodec) Unmarshal(pData []byte, pBean interface{}) error {
+
+	vKeyRing, vKeyRingError := vSelf.getKeyRing()
+	if vKeyRingError != nil {
+		return vKeyRingError
+	}
+
+	vPlain, _, vDecryptError := vKeyRing.decrypt(pData, []byte(vSelf.GetName()))
+	if vDecryptError != nil {
+		return vDecryptError
+	}
+	return vSelf.codec.Unmarshal(vPlain, pBean)
+}
+
+//RewrapBeanData encrypts again with the current key a bean encrypted with another key, the bean type is not required
+//Parameters:
+// pData = serialized bean
+// pKeyRing = keys, nil for the default key ring
+//Returns:
+// rewrapped bean
+// false if the bean is not encrypted or already encrypted with the current key, the data is returned unchanged
+// error
+func RewrapBeanData(pData []byte, pKeyRing *EncryptionKeyRing) ([]byte, bool, error) {
+
+	vCodec, vPayload, vCodecError := splitCodecMarker(pData)
+	if vCodecError != nil {
+		return nil, false, vCodecError
+	}
+	if strings.HasSuffix(vCodec.GetName(), "+"+Encryption_AesGcm) == false {
+		return pData, false, nil
+	}
+
+	vKeyRing := pKeyRing
+	if vKeyRing == nil {
+		vKeyRing = GetDefaultEncryptionKeyRing()
+	}
+	if vKeyRing == nil {
+		return nil, false, diagnostic.NewError("no encryption key ring", nil)
+	}
+
+	vAdditionalData := []byte(vCodec.GetName())
+	vPlain, vKeyId, vDecryptError := vKeyRing.decrypt(vPayload, vAdditionalData)
+	if vDecryptError != nil {
+		return nil, false, vDecryptError
+	}
+	if vKeyId == vKeyRing.GetCurrentKeyId() {
+		return pData, false, nil
+	}
+
+	vEncrypted, vEncryptError := vKeyRing.encrypt(vPlain, vAdditionalData)
+	if vEncryptError != nil {
+		return nil, false, vEncryptError
+	}
+	vMarkerLength := len(pData) - len(vPayload)
+	return append(append(make([]byte, 0, vMarkerLength+len(vEncrypted)), pData[:vMarkerLength]...), vEncrypted...), true, nil
+}
@@ -0,0 +1,282 @@
+package persistency
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type testCodecItem struct {
+	Name     string
+	Quantity int
+	Price    float64
+	Tags     []string
+}
+
+type testCodecBean struct {
+	Id      string
+	Enabled bool
+	Ratio   float64
+	Offset  int64
+	Items   []testCodecItem
+	Labels  map[string]string
+	Payload []byte
+}
+
+func newTestCodecBean(pItems int) *testCodecBean {
+	vRis := &testCodecBean{Id: "bean1", Enabled: true, Ratio: 0.25, Offset: -123456789012, Labels: map[string]string{"env": "test", "owner": "me"}, Payload: []byte{0, 1, 2, 255}}
+	for vCnt := 0; vCnt < pItems; vCnt++ {
+		vRis.Items = append(vRis.Items, testCodecItem{Name: "item" + strconv.Itoa(vCnt), Quantity: vCnt, Price: float64(vCnt) * 1.5, Tags: []string{"a", "b"}})
+	}
+	return vRis
+}
+
+func getTestCodecs(pTest testing.TB) []Codec {
+	vRis := []Codec{JsonCodec{}, IndentedJsonCodec{}, GobCodec{}, CborCodec{}}
+	for _, vCurName := range []string{"json+gzip", "cbor+flate", "gob+gzip"} {
+		vCodec, vCodecError := GetCodec(vCurName)
+		if vCodecError != nil {
+			pTest.Fatal("failed to get codec", vCodecError)
+		}
+		vRis = append(vRis, vCodec)
+	}
+	return vRis
+}
+
+func TestCodecs(pTest *testing.T) {
+
+	vBean := newTestCodecBean(10)
+	for _, vCurCodec := range getTestCodecs(pTest) {
+		pTest.Run(vCurCodec.GetName(), func(pTest *testing.T) {
+
+			vData, vMarshalError := MarshalBean(vCurCodec, vBean)
+			if vMarshalError != nil {
+				pTest.Fatal("failed to marshal", vMarshalError)
+			}
+			if vHasMarker := bytes.HasPrefix(vData, []byte(codec_Marker)); vHasMarker == IsJsonCodec(vCurCodec) {
+				pTest.Errorf("unexpected codec marker %v", vHasMarker)
+			}
+
+			vDecoded := &testCodecBean{}
+			if vUnmarshalError := UnmarshalBean(vData, vDecoded); vUnmarshalError != nil {
+				pTest.Fatal("failed to unmarshal", vUnmarshalError)
+			}
+			if reflect.DeepEqual(vBean, vDecoded) == false {
+				pTest.Errorf("expected %v, got %v", vBean, vDecoded)
+			}
+
+			vCodecName, _ := GetBeanCodecName(vData)
+			if IsJsonCodec(vCurCodec) == false && vCodecName != vCurCodec.GetName() {
+				pTest.Errorf("unexpected codec name %s", vCodecName)
+			}
+
+			vJson, vJsonError := BeanDataToJson(vData)
+			if vCurCodec.GetName() == CodecName_Gob || vCurCodec.GetName() == "gob+gzip" {
+				if vJsonError == nil {
+					pTest.Error("gob converted to json without bean type")
+				}
+				return
+			}
+			vFromJson := &testCodecBean{}
+			if vJsonError != nil || UnmarshalBean(vJson, vFromJson) != nil || reflect.DeepEqual(vBean, vFromJson) == false {
+				pTest.Errorf("failed to convert to json %v %s", vJsonError, vJson)
+			}
+		})
+	}
+
+	if _, vCodecError := GetCodec("json+zip"); vCodecError == nil {
+		pTest.Error("expected an error for an unknown compression")
+	}
+	if vUnmarshalError := UnmarshalBean([]byte(codec_Marker+"unknown\n{}"), &testCodecBean{}); vUnmarshalError == nil {
+		pTest.Error("expected an error for an unknown codec")
+	}
+}
+
+func TestCborEncoding(pTest *testing.T) {
+
+	//examples of RFC 8949 appendix A
+	vData, vMarshalError := CborCodec{}.Marshal(map[string]interface{}{"a": 1, "b": []interface{}{2, 3}})
+	if vMarshalError != nil {
+		pTest.Fatal("failed to marshal", vMarshalError)
+	}
+	if vExpected := []byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x82, 0x02, 0x03}; bytes.Equal(vData, vExpected) == false {
+		pTest.Errorf("expected %x, got %x", vExpected, vData)
+	}
+
+	var vDecoded []interface{}
+	//[-1000, 1.5 as half precision, true, null, 1000000]
+	if vUnmarshalError := (CborCodec{}).Unmarshal([]byte{0x85, 0x39, 0x03, 0xe7, 0xf9, 0x3e, 0x00, 0xf5, 0xf6, 0x1a, 0x00, 0x0f, 0x42, 0x40}, &vDecoded); vUnmarshalError != nil {
+		pTest.Fatal("failed to unmarshal", vUnmarshalError)
+	}
+	if vExpected := []interface{}{float64(-1000), 1.5, true, nil, float64(1000000)}; reflect.DeepEqual(vDecoded, vExpected) == false {
+		pTest.Errorf("expected %v, got %v", vExpected, vDecoded)
+	}
+
+	if vUnmarshalError := (CborCodec{}).Unmarshal([]byte{0x82, 0x01}, &vDecoded); vUnmarshalError == nil {
+		pTest.Error("expected an error for truncated data")
+	}
+}
+
+func TestBeanFileCodecs(pTest *testing.T) {
+
+	vDir, vDirError := ioutil.TempDir("", "beanfilecodecs")
+	if vDirError != nil {
+		pTest.Fatal(vDirError)
+	}
+	defer os.RemoveAll(vDir)
+
+	vBean := newTestCodecBean(3)
+	vFile := filepath.Join(vDir, "bean.json")
+
+	if vSaveError := SaveBeanIntoFile(vBean, vFile); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	if vContent, _ := ioutil.ReadFile(vFile); bytes.HasPrefix(vContent, []byte("{\n\t")) == false {
+		pTest.Errorf("expected indented json, got %s", vContent)
+	}
+
+	vGzip, _ := GetCodec("gob+gzip")
+	if vSaveError := SaveBeanIntoFileWithCodec(vBean, vFile, vGzip); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	vLoaded := &testCodecBean{}
+	if vLoadError := LoadBeanFromFile(vFile, vLoaded); vLoadError != nil || reflect.DeepEqual(vBean, vLoaded) == false {
+		pTest.Errorf("failed to load bean saved with codec %v", vLoadError)
+	}
+}
+
+func BenchmarkCodecs(pBenchmark *testing.B) {
+
+	vBean := newTestCodecBean(10000)
+	for _, vCurCodec := range getTestCodecs(pBenchmark) {
+
+		vData, vMarshalError := MarshalBean(vCurCodec, vBean)
+		if vMarshalError != nil {
+			pBenchmark.Fatal("failed to marshal", vMarshalError)
+		}
+
+		pBenchmark.Run("Marshal/"+vCurCodec.GetName(), func(pBenchmark *testing.B) {
+			pBenchmark.ReportMetric(float64(len(vData)), "bytes/bean")
+			for vCnt := 0; vCnt < pBenchmark.N; vCnt++ {
+				if _, vMarshalError := MarshalBean(vCurCodec, vBean); vMarshalError != nil {
+					pBenchmark.Fatal(vMarshalError)
+				}
+			}
+		})
+
+		pBenchmark.Run("Unmarshal/"+vCurCodec.GetName(), func(pBenchmark *testing.B) {
+			for vCnt := 0; vCnt < pBenchmark.N; vCnt++ {
+				if vUnmarshalError := UnmarshalBean(vData, &testCodecBean{}); vUnmarshalError != nil {
+					pBenchmark.Fatal(vUnmarshalError)
+				}
+			}
+		})
+	}
+}
+
+func newTestKeyRing(pTest *testing.T, pKeyIds ...string) *EncryptionKeyRing {
+	vRis := NewEncryptionKeyRing()
+	for vCnt, vCurKeyId := range pKeyIds {
+		if vAddError := vRis.AddKey(vCurKeyId, bytes.Repeat([]byte{byte(vCnt + 1)}, 32)); vAddError != nil {
+			pTest.Fatal("failed to add key", vAddError)
+		}
+	}
+	return vRis
+}
+
+func TestEncryptedCodec(pTest *testing.T) {
+
+	vKeyRing := newTestKeyRing(pTest, "key1", "key2")
+	if vKeyRing.GetCurrentKeyId() != "key1" {
+		pTest.Errorf("unexpected current key %s", vKeyRing.GetCurrentKeyId())
+	}
+	if vAddError := vKeyRing.AddKey("short", []byte("short")); vAddError == nil {
+		pTest.Error("expected an error for an invalid key")
+	}
+
+	vCompressed, _ := NewCompressedCodec(JsonCodec{}, Compression_Gzip)
+	vCodec := NewEncryptedCodec(vCompressed, vKeyRing)
+	if vCodec.GetName() != "json+gzip+aesgcm" {
+		pTest.Errorf("unexpected codec name %s", vCodec.GetName())
+	}
+
+	vBean := newTestCodecBean(3)
+	vData, vMarshalError := MarshalBean(vCodec, vBean)
+	if vMarshalError != nil {
+		pTest.Fatal("failed to marshal", vMarshalError)
+	}
+	if bytes.Contains(vData, []byte("item1")) {
+		pTest.Error("bean not encrypted")
+	}
+
+	//decoding relies on the default key ring
+	if vUnmarshalError := UnmarshalBean(vData, &testCodecBean{}); vUnmarshalError == nil {
+		pTest.Error("decrypted without key ring")
+	}
+	SetDefaultEncryptionKeyRing(vKeyRing)
+	defer SetDefaultEncryptionKeyRing(nil)
+
+	vDecoded := &testCodecBean{}
+	if vUnmarshalError := UnmarshalBean(vData, vDecoded); vUnmarshalError != nil || reflect.DeepEqual(vBean, vDecoded) == false {
+		pTest.Errorf("failed to decrypt %v", vUnmarshalError)
+	}
+
+	vTampered := append([]byte{}, vData...)
+	vTampered[len(vTampered)-1] ^= 1
+	if vUnmarshalError := UnmarshalBean(vTampered, &testCodecBean{}); vUnmarshalError == nil {
+		pTest.Error("tampered data decrypted")
+	}
+
+	if _, vChanged, _ := RewrapBeanData(vData, nil); vChanged {
+		pTest.Error("bean encrypted by current key rewrapped")
+	}
+	vKeyRing.SetCurrentKey("key2")
+	vRewrapped, vChanged, vRewrapError := RewrapBeanData(vData, nil)
+	if vRewrapError != nil || vChanged == false {
+		pTest.Fatalf("failed to rewrap %v", vRewrapError)
+	}
+
+	vOnlyNewKey := NewEncryptionKeyRing()
+	vOnlyNewKey.AddKey("key2", bytes.Repeat([]byte{2}, 32))
+	SetDefaultEncryptionKeyRing(vOnlyNewKey)
+	if vUnmarshalError := UnmarshalBean(vRewrapped, vDecoded); vUnmarshalError != nil || reflect.DeepEqual(vBean, vDecoded) == false {
+		pTest.Errorf("failed to decrypt rewrapped bean %v", vUnmarshalError)
+	}
+
+	if vPlain, vChanged, _ := RewrapBeanData([]byte(`{"Id":"x"}`), nil); vChanged || string(vPlain) != `{"Id":"x"}` {
+		pTest.Error("plain bean rewrapped")
+	}
+}
+
+func TestRewrapBeanFiles(pTest *testing.T) {
+
+	vDir, vDirError := ioutil.TempDir("", "rewrapbeanfiles")
+	if vDirError != nil {
+		pTest.Fatal(vDirError)
+	}
+	defer os.RemoveAll(vDir)
+
+	vKeyRing := newTestKeyRing(pTest, "old", "new")
+	vCodec := NewEncryptedCodec(JsonCodec{}, vKeyRing)
+	SaveBeanIntoFileWithCodec(newTestCodecBean(1), GetBeanFilePath(vDir, "encrypted"), vCodec)
+	SaveBeanIntoFile(newTestCodecBean(1), GetBeanFilePath(vDir, "plain"))
+
+	vKeyRing.SetCurrentKey("new")
+	vCount, vRewrapError := RewrapBeanFiles(vDir, vKeyRing)
+	if vRewrapError != nil || vCount != 1 {
+		pTest.Errorf("unexpected rewrap result %d %v", vCount, vRewrapError)
+	}
+	if vCount, _ = RewrapBeanFiles(vDir, vKeyRing); vCount != 0 {
+		pTest.Errorf("beans rewrapped twice")
+	}
+
+	vContent, _ := ioutil.ReadFile(GetBeanFilePath(vDir, "encrypted"))
+	vPlain, vKeyId, vDecryptError := vKeyRing.decrypt(vContent[len(codec_Marker+vCodec.GetName()+"\n"):], []byte(vCodec.GetName()))
+	if vDecryptError != nil || vKeyId != "new" || bytes.Contains(vPlain, []byte("item0")) == false {
+		pTest.Errorf("unexpected rewrapped file %s %v", vKeyId, vDecryptError)
+	}
+}
@@ -0,0 +1,103 @@
+package persistency
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//JsonDifference a value changed between two json documents
+type JsonDifference struct {
+	//Path of the value, object keys are separated by dots and array items are indexed (ex. Address.Lines[1])
+	Path string
+	//From previous value, nil if added
+	From interface{}
+	//To new value, nil if removed
+	To interface{}
+}
+
+//DiffJson compares two json documents
+//Parameters:
+// pFrom = previous document, nil or empty for none
+// pTo = new document, nil or empty for none
+//Returns:
+// the differences sorted by path, numbers are returned as json.Number
+func DiffJson(pFrom []byte, pTo []byte) ([]JsonDifference, error) {
+
+	vFrom, vFromError := decodeJsonForDiff(pFrom)
+	if vFromError != nil {
+		return nil, vFromError
+	}
+	vTo, vToError := decodeJsonForDiff(pTo)
+	if vToError != nil {
+		return nil, vToError
+	}
+
+	vRis := make([]JsonDifference, 0)
+	diffJsonValues("", vFrom, vTo, &vRis)
+	return vRis, nil
+}
+
+func decodeJsonForDiff(pDocument []byte) (interface{}, error) {
+	if len(pDocument) == 0 {
+		return nil, nil
+	}
+	vDecoder := json.NewDecoder(bytes.NewReader(pDocument))
+	vDecoder.UseNumber()
+	var vRis interface{}
+	vDecodeError := vDecoder.Decode(&vRis)
+	if vDecodeError != nil {
+		return nil, diagnostic.NewError("failed to decode json", vDecodeError)
+	}
+	return vRis, nil
+}
+
+func diffJsonValues(pPath string, pFrom interface{}, pTo interface{}, pDifferences *[]JsonDifference) {
+
+	vFromObject, vFromIsObject := pFrom.(map[string]interface{})
+	vToObject, vToIsObject := pTo.(map[string]interface{})
+	if vFromIsObject && vToIsObject {
+		vKeys := make([]string, 0, len(vFromObject)+len(vToObject))
+		for vCurKey := range vFromObject {
+			vKeys = append(vKeys, vCurKey)
+		}
+		for vCurKey := range vToObject {
+			if _, vIsCommon := vFromObject[vCurKey]; vIsCommon == false {
+				vKeys = append(vKeys, vCurKey)
+			}
+		}
+		sort.Strings(vKeys)
+		for _, vCurKey := range vKeys {
+			vCurPath := vCurKey
+			if pPath != "" {
+				vCurPath = pPath + "." + vCurKey
+			}
+			diffJsonValues(vCurPath, vFromObject[vCurKey], vToObject[vCurKey], pDifferences)
+		}
+		return
+	}
+
+	vFromArray, vFromIsArray := pFrom.([]interface{})
+	vToArray, vToIsArray := pTo.([]interface{})
+	if vFromIsArray && vToIsArray {
+		for vCnt := 0; vCnt < len(vFromArray) || vCnt < len(vToArray); vCnt++ {
+			var vFromItem, vToItem interface{}
+			if vCnt < len(vFromArray) {
+				vFromItem = vFromArray[vCnt]
+			}
+			if vCnt < len(vToArray) {
+				vToItem = vToArray[vCnt]
+			}
+			diffJsonValues(pPath+"["+strconv.Itoa(vCnt)+"]", vFromItem, vToItem, pDifferences)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(pFrom, pTo) == false {
+		*pDifferences = append(*pDifferences, JsonDifference{Path: pPath, From: pFrom, To: pTo})
+	}
+}
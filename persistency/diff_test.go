@@ -0,0 +1,35 @@
+package persistency
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffJson(pTest *testing.T) {
+
+	vDifferences, vDiffError := DiffJson([]byte(`{"Name":"a","Count":1,"Tags":["x","y"],"Address":{"City":"Rome"}}`), []byte(`{"Name":"a","Count":2,"Tags":["x"],"Address":{"City":"Milan","Zip":"20100"}}`))
+	if vDiffError != nil {
+		pTest.Fatal("failed to diff", vDiffError)
+	}
+
+	vExpected := []JsonDifference{
+		{Path: "Address.City", From: "Rome", To: "Milan"},
+		{Path: "Address.Zip", From: nil, To: "20100"},
+		{Path: "Count", From: json.Number("1"), To: json.Number("2")},
+		{Path: "Tags[1]", From: "y", To: nil}}
+	if len(vDifferences) != len(vExpected) {
+		pTest.Fatalf("unexpected differences %v", vDifferences)
+	}
+	for vCnt, vCurExpected := range vExpected {
+		if vDifferences[vCnt] != vCurExpected {
+			pTest.Errorf("difference %d: expected %v, got %v", vCnt, vCurExpected, vDifferences[vCnt])
+		}
+	}
+
+	if vDifferences, _ = DiffJson(nil, []byte(`{"Name":"a"}`)); len(vDifferences) != 1 || vDifferences[0].Path != "" {
+		pTest.Errorf("unexpected differences from empty document %v", vDifferences)
+	}
+	if _, vDiffError = DiffJson([]byte(`{`), nil); vDiffError == nil {
+		pTest.Error("expected an error for invalid json")
+	}
+}
@@ -0,0 +1,227 @@
+package persistency
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/myfileutils"
+)
+
+const (
+	//BeanFile_Extension extension of the files of beans saved in a directory
+	BeanFile_Extension = ".json"
+)
+
+//GetBeanFilePath returns the path of the file of a bean saved in a directory.
+//The id is escaped, so ids containing path separators remain inside the directory
+//Parameters:
+// pDir = directory of the beans
+// pId = id of the bean
+func GetBeanFilePath(pDir string, pId string) string {
+	return filepath.Join(pDir, url.PathEscape(pId)+BeanFile_Extension)
+}
+
+//DeleteBeanFile delete the file of a bean, waiting for its lock like the save functions.
+//The backups (see BeanFileOptions) are kept to recover the bean, the lock file is kept
+//because processes waiting for the lock would lock a removed file
+//Returns:
+// nil if succeeded, an error satisfying IsBeanNotFound if the file doesn't exist
+func DeleteBeanFile(pFile string) error {
+
+	if vExists, vExistsError := ExistsBeanFile(pFile); vExistsError != nil || vExists == false {
+		if vExistsError != nil {
+			return vExistsError
+		}
+		return &BeanNotFoundError{BeanID: pFile}
+	}
+
+	if myfileutils.IsFileLockSupported() {
+		vLock, vLockError := LockBeanFile(pFile, BeanFile_SaveLockTimeout)
+		if vLockError != nil {
+			return vLockError
+		}
+		defer vLock.Release()
+	}
+
+	vRemoveError := os.Remove(pFile)
+	if os.IsNotExist(vRemoveError) {
+		return &BeanNotFoundError{BeanID: pFile}
+	}
+	if vRemoveError != nil {
+		return diagnostic.NewError("error while deleting file %s", vRemoveError, pFile)
+	}
+	return nil
+}
+
+//ExistsBeanFile returns true if the file of a bean exists
+func ExistsBeanFile(pFile string) (bool, error) {
+	_, vStatError := os.Stat(pFile)
+	if os.IsNotExist(vStatError) {
+		return false, nil
+	}
+	if vStatError != nil {
+		return false, diagnostic.NewError("error while checking file %s", vStatError, pFile)
+	}
+	return true, nil
+}
+
+//ListBeanFileIds list the ids of the beans saved in a directory, sorted by id
+//Parameters:
+// pDir = directory of the beans
+// pPrefix = returns only ids beginning with the prefix, empty for all
+// pLimit = max number of ids returned, 0 for unlimited
+// pCursor = returns only ids following the cursor, empty to start from the first
+//Returns:
+// ids
+// cursor of the next page, empty if there are no more ids
+// error if the directory can't be read
+func ListBeanFileIds(pDir string, pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+
+	vIds, vIdsError := readBeanFileIds(pDir, pPrefix)
+	if vIdsError != nil {
+		return nil, "", vIdsError
+	}
+
+	vPage, vNextCursor := pageBeanIds(vIds, pLimit, pCursor)
+	return vPage, vNextCursor, nil
+}
+
+//pageBeanIds returns a page of sorted ids and the cursor of the next page, empty if there are no more ids
+func pageBeanIds(pIds []string, pLimit int, pCursor string) ([]string, string) {
+
+	vStart := 0
+	if pCursor != "" {
+		vStart = sort.Search(len(pIds), func(pIndex int) bool { return pIds[pIndex] > pCursor })
+	}
+	vIds := pIds[vStart:]
+
+	if pLimit <= 0 || len(vIds) <= pLimit {
+		return vIds, ""
+	}
+	return vIds[:pLimit], vIds[pLimit-1]
+}
+
+//IterateBeanFiles returns an iterator over the beans saved in a directory, sorted by id.
+//Files are read one at time, during Next
+//Parameters:
+// pDir = directory of the beans
+// pPrefix = iterates only ids beginning with the prefix, empty for all
+func IterateBeanFiles(pDir string, pPrefix string) (*BeanIterator, error) {
+
+	vIds, vIdsError := readBeanFileIds(pDir, pPrefix)
+	if vIdsError != nil {
+		return nil, vIdsError
+	}
+
+	vNext := 0
+	return NewBeanIterator(func() (string, []byte, bool, error) {
+		for vNext < len(vIds) {
+			vId := vIds[vNext]
+			vNext++
+			vFile := GetBeanFilePath(pDir, vId)
+			vFileContent, vFileContentError := ioutil.ReadFile(vFile)
+			if os.IsNotExist(vFileContentError) {
+				//deleted after the directory has been listed
+				continue
+			}
+			if vFileContentError != nil {
+				return "", nil, false, diagnostic.NewError("error while reading file %s", vFileContentError, vFile)
+			}
+			return vId, vFileContent, true, nil
+		}
+		return "", nil, false, nil
+	}, nil), nil
+}
+
+//readBeanFileIds returns the sorted ids of the beans in a directory beginning with a prefix
+func readBeanFileIds(pDir string, pPrefix string) ([]string, error) {
+
+	vEntries, vReadDirError := ioutil.ReadDir(pDir)
+	if os.IsNotExist(vReadDirError) {
+		return []string{}, nil
+	}
+	if vReadDirError != nil {
+		return nil, diagnostic.NewError("error while reading directory %s", vReadDirError, pDir)
+	}
+
+	vIds := make([]string, 0, len(vEntries))
+	for _, vCurEntry := range vEntries {
+		if vCurEntry.Mode().IsRegular() == false || strings.HasSuffix(vCurEntry.Name(), BeanFile_Extension) == false {
+			continue
+		}
+		vId, vUnescapeError := url.PathUnescape(strings.TrimSuffix(vCurEntry.Name(), BeanFile_Extension))
+		if vUnescapeError != nil {
+			diagnostic.LogWarning("readBeanFileIds", "ignored file %s in %s", vUnescapeError, vCurEntry.Name(), pDir)
+			continue
+		}
+		if strings.HasPrefix(vId, pPrefix) {
+			vIds = append(vIds, vId)
+		}
+	}
+	sort.Strings(vIds)
+	return vIds, nil
+}
+
+//RewrapBeanFiles encrypts again with the current key the beans of a directory encrypted with other keys
+//Parameters:
+// pDir = directory of the beans
+// pKeyRing = keys, nil for the default key ring
+//Returns:
+// number of rewrapped beans
+// error
+func RewrapBeanFiles(pDir string, pKeyRing *EncryptionKeyRing) (int, error) {
+
+	vIds, vIdsError := readBeanFileIds(pDir, "")
+	if vIdsError != nil {
+		return 0, vIdsError
+	}
+
+	vRis := 0
+	for _, vCurId := range vIds {
+		vChanged, vRewrapError := rewrapBeanFile(GetBeanFilePath(pDir, vCurId), pKeyRing)
+		if vRewrapError != nil {
+			return vRis, vRewrapError
+		}
+		if vChanged {
+			vRis++
+		}
+	}
+	return vRis, nil
+}
+
+//rewrapBeanFile rewraps a bean file holding its lock, on platforms supporting it
+func rewrapBeanFile(pFile string, pKeyRing *EncryptionKeyRing) (bool, error) {
+
+	if myfileutils.IsFileLockSupported() {
+		vLock, vLockError := LockBeanFile(pFile, BeanFile_SaveLockTimeout)
+		if vLockError != nil {
+			return false, vLockError
+		}
+		defer vLock.Release()
+	}
+
+	vFileContent, vFileContentError := ioutil.ReadFile(pFile)
+	if os.IsNotExist(vFileContentError) {
+		return false, nil
+	}
+	if vFileContentError != nil {
+		return false, diagnostic.NewError("error while reading file %s", vFileContentError, pFile)
+	}
+
+	vRewrapped, vChanged, vRewrapError := RewrapBeanData(vFileContent, pKeyRing)
+	if vRewrapError != nil {
+		return false, diagnostic.NewError("error while rewrapping file %s", vRewrapError, pFile)
+	}
+	if vChanged == false {
+		return false, nil
+	}
+	if vWriteError := myfileutils.WriteFileAtomic(pFile, vRewrapped, 0); vWriteError != nil {
+		return false, diagnostic.NewError("error while writing file %s", vWriteError, pFile)
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package persistency
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testBean struct {
+	Id    string
+	Value int
+}
+
+func TestBeanFiles(pTest *testing.T) {
+
+	vDir := pTest.TempDir()
+
+	for vCnt := 0; vCnt < 12; vCnt++ {
+		vBean := &testBean{Id: "group/" + strconv.Itoa(10+vCnt), Value: vCnt}
+		if vSaveError := SaveBeanIntoFile(vBean, GetBeanFilePath(vDir, vBean.Id)); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+	SaveBeanIntoFile(&testBean{Id: "other"}, GetBeanFilePath(vDir, "other"))
+
+	vIds, vCursor, vListError := ListBeanFileIds(vDir, "group/", 5, "")
+	if vListError != nil {
+		pTest.Fatal("failed to list beans", vListError)
+	}
+	if len(vIds) != 5 || vIds[0] != "group/10" || vCursor != "group/14" {
+		pTest.Errorf("unexpected first page %v cursor %s", vIds, vCursor)
+	}
+	vIds, vCursor, _ = ListBeanFileIds(vDir, "group/", 10, vCursor)
+	if len(vIds) != 7 || vCursor != "" {
+		pTest.Errorf("unexpected last page %v cursor %s", vIds, vCursor)
+	}
+
+	vIterator, vIteratorError := IterateBeanFiles(vDir, "group/2")
+	if vIteratorError != nil {
+		pTest.Fatal("failed to iterate beans", vIteratorError)
+	}
+	vBeans := IterateBeansOf[testBean](vIterator)
+	defer vBeans.Close()
+	vSum := 0
+	for vBeans.Next() {
+		vSum += vBeans.GetBean().Value
+	}
+	if vBeans.GetError() != nil || vSum != 10+11 {
+		pTest.Errorf("unexpected iteration result %d %v", vSum, vBeans.GetError())
+	}
+
+	vOtherFile := GetBeanFilePath(vDir, "other")
+	if vExists, _ := ExistsBeanFile(vOtherFile); vExists == false {
+		pTest.Error("bean other not found")
+	}
+	if vDeleteError := DeleteBeanFile(vOtherFile); vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	if vDeleteError := DeleteBeanFile(vOtherFile); IsBeanNotFound(vDeleteError) == false {
+		pTest.Errorf("expected bean not found, got %v", vDeleteError)
+	}
+}
+
+type testVersionedBean struct {
+	Value   string
+	Version int64
+}
+
+func (vSelf *testVersionedBean) GetBeanVersion() int64 {
+	return vSelf.Version
+}
+
+func (vSelf *testVersionedBean) SetBeanVersion(pVersion int64) {
+	vSelf.Version = pVersion
+}
+
+func TestBeanFilesOptimisticConcurrency(pTest *testing.T) {
+
+	vFile := GetBeanFilePath(pTest.TempDir(), "versioned")
+
+	vFirst := &testVersionedBean{Value: "first"}
+	if vSaveError := SaveBeanIntoFile(vFirst, vFile); vSaveError != nil || vFirst.Version != 1 {
+		pTest.Fatalf("failed to save bean %v, version %d", vSaveError, vFirst.Version)
+	}
+
+	vSecond := &testVersionedBean{}
+	LoadBeanFromFile(vFile, vSecond)
+
+	vFirst.Value = "updated"
+	if vSaveError := SaveBeanIntoFile(vFirst, vFile); vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+
+	vSaveError := SaveBeanIntoFile(vSecond, vFile)
+	if IsConcurrentModification(vSaveError) == false || vSecond.Version != 1 {
+		pTest.Errorf("expected concurrent modification keeping version 1, got %v version %d", vSaveError, vSecond.Version)
+	}
+}
+
+func TestBeanFilesAtomicSave(pTest *testing.T) {
+
+	vDir := pTest.TempDir()
+	vFile := GetBeanFilePath(vDir, "atomic")
+	vOptions := BeanFileOptions{Backups: 2}
+
+	for vCnt := 1; vCnt <= 4; vCnt++ {
+		if vSaveError := SaveBeanIntoFileWithOptions(&testBean{Id: "atomic", Value: vCnt}, vFile, vOptions); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+
+	for vCnt, vCurFile := range []string{vFile, vFile + ".1", vFile + ".2"} {
+		vLoaded := &testBean{}
+		if vLoadError := LoadBeanFromFile(vCurFile, vLoaded); vLoadError != nil || vLoaded.Value != 4-vCnt {
+			pTest.Errorf("unexpected content of %s %v %v", vCurFile, vLoaded, vLoadError)
+		}
+	}
+	if _, vStatError := os.Stat(vFile + ".3"); os.IsNotExist(vStatError) == false {
+		pTest.Error("backup beyond the limit kept")
+	}
+
+	//a bean that can't be marshalled leaves the file untouched
+	if vSaveError := SaveBeanIntoFile(map[string]interface{}{"channel": make(chan int)}, vFile); vSaveError == nil {
+		pTest.Fatal("unmarshallable bean saved")
+	}
+	vLoaded := &testBean{}
+	if vLoadError := LoadBeanFromFile(vFile, vLoaded); vLoadError != nil || vLoaded.Value != 4 {
+		pTest.Errorf("file damaged by failed save %v %v", vLoaded, vLoadError)
+	}
+
+	vEntries, _ := ioutil.ReadDir(vDir)
+	vBeanFiles := 0
+	for _, vCurEntry := range vEntries {
+		if strings.HasSuffix(vCurEntry.Name(), BeanFile_LockExtension) == false {
+			vBeanFiles++
+		}
+	}
+	if vBeanFiles != 3 {
+		pTest.Errorf("unexpected files left in directory %d", vBeanFiles)
+	}
+	if vIds, _, _ := ListBeanFileIds(vDir, "", 0, ""); len(vIds) != 1 {
+		pTest.Errorf("backups listed as beans %v", vIds)
+	}
+}
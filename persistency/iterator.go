@@ -0,0 +1,129 @@
+package persistency
+
+import (
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//BeanIteratorNextFunc returns the next serialized bean of a store
+//Returns:
+// id of the bean
+// serialized bean
+// false when there are no more beans
+// error if the store can't be read
+type BeanIteratorNextFunc func() (string, []byte, bool, error)
+
+//BeanIterator streams the beans of a store without keeping all of them in memory.
+//Call Next before each bean and Close at the end
+type BeanIterator struct {
+	nextFunc  BeanIteratorNextFunc
+	closeFunc func() error
+	id        string
+	data      []byte
+	err       error
+}
+
+//NewBeanIterator create an iterator
+//Parameters:
+// pNextFunc = function returning the beans one at time
+// pCloseFunc = optional, function releasing the resources of the store
+func NewBeanIterator(pNextFunc BeanIteratorNextFunc, pCloseFunc func() error) *BeanIterator {
+	return &BeanIterator{nextFunc: pNextFunc, closeFunc: pCloseFunc}
+}
+
+//Next move to the next bean
+//Returns:
+// false if there are no more beans or an error occurred (see GetError)
+func (vSelf *BeanIterator) Next() bool {
+
+	if vSelf.err != nil || vSelf.nextFunc == nil {
+		return false
+	}
+
+	vId, vData, vFound, vNextError := vSelf.nextFunc()
+	if vNextError != nil {
+		vSelf.err = vNextError
+		return false
+	}
+	if vFound == false {
+		vSelf.nextFunc = nil
+		vSelf.id, vSelf.data = "", nil
+		return false
+	}
+	vSelf.id, vSelf.data = vId, vData
+	return true
+}
+
+//GetId returns the id of the current bean
+func (vSelf *BeanIterator) GetId() string {
+	return vSelf.id
+}
+
+//GetData returns the serialized current bean
+func (vSelf *BeanIterator) GetData() []byte {
+	return vSelf.data
+}
+
+//Unmarshal the current bean, the codec is detected from the data (see UnmarshalBean)
+//Parameters:
+// pBean = pointer to the destination
+func (vSelf *BeanIterator) Unmarshal(pBean interface{}) error {
+	vUnmarshalError := UnmarshalBean(vSelf.data, pBean)
+	if vUnmarshalError != nil {
+		return diagnostic.NewError("error while unmarshalling bean %s", vUnmarshalError, vSelf.id)
+	}
+	return nil
+}
+
+//GetError returns the error that stopped the iteration, nil if the iteration completed
+func (vSelf *BeanIterator) GetError() error {
+	return vSelf.err
+}
+
+//Close release the resources of the iterator, it's safe to call it more than once
+func (vSelf *BeanIterator) Close() error {
+	vSelf.nextFunc = nil
+	if vSelf.closeFunc == nil {
+		return nil
+	}
+	vCloseFunc := vSelf.closeFunc
+	vSelf.closeFunc = nil
+	return vCloseFunc()
+}
+
+//BeanIteratorOf streams beans unmarshalled as T
+type BeanIteratorOf[T any] struct {
+	*BeanIterator
+	current *T
+}
+
+//IterateBeansOf wraps an iterator unmarshalling each bean as T
+//Parameters:
+// pIterator = iterator obtained from a store
+func IterateBeansOf[T any](pIterator *BeanIterator) *BeanIteratorOf[T] {
+	return &BeanIteratorOf[T]{BeanIterator: pIterator}
+}
+
+//Next move to the next bean and unmarshal it
+//Returns:
+// false if there are no more beans or an error occurred (see GetError)
+func (vSelf *BeanIteratorOf[T]) Next() bool {
+
+	vSelf.current = nil
+	if vSelf.BeanIterator.Next() == false {
+		return false
+	}
+
+	vBean := new(T)
+	vUnmarshalError := vSelf.Unmarshal(vBean)
+	if vUnmarshalError != nil {
+		vSelf.err = vUnmarshalError
+		return false
+	}
+	vSelf.current = vBean
+	return true
+}
+
+//GetBean returns the current bean
+func (vSelf *BeanIteratorOf[T]) GetBean() *T {
+	return vSelf.current
+}
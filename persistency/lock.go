@@ -0,0 +1,90 @@
+package persistency
+
+import (
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+	"github.com/mysinmyc/gocommons/myfileutils"
+)
+
+const (
+	//BeanFile_LockExtension suffix of the lock files of the beans, appended to the file of the bean
+	BeanFile_LockExtension = ".lock"
+	//BeanFile_SaveLockTimeout max wait of the lock of the file of a bean by the save functions
+	BeanFile_SaveLockTimeout = 30 * time.Second
+)
+
+//BeanFileLock exclusive lock of the file of a bean, held from the load to the save of a read-modify-write.
+//Locks are advisory, they exclude only the processes locking the same bean
+type BeanFileLock struct {
+	file string
+	lock *myfileutils.FileLock
+}
+
+//LockBeanFile acquires the lock of the file of a bean, also if the bean doesn't exist yet
+//Parameters:
+// pFile = file of the bean, the lock is the file pFile.lock
+// pTimeout = max wait, 0 to fail immediately if locked, myfileutils.FileLock_WaitForever to wait indefinitely
+//Returns:
+// the lock, to release by SaveAndRelease or Release
+// an error satisfying myfileutils.IsLockTimeout if the lock has not been acquired in time
+func LockBeanFile(pFile string, pTimeout time.Duration) (*BeanFileLock, error) {
+	vLock, vLockError := myfileutils.LockFile(pFile+BeanFile_LockExtension, pTimeout)
+	if vLockError != nil {
+		return nil, diagnostic.NewError("error while locking bean file %s", vLockError, pFile)
+	}
+	return &BeanFileLock{file: pFile, lock: vLock}, nil
+}
+
+//LoadBeanForUpdate locks the file of a bean and loads it, the lock is released if the bean can't be loaded
+//Parameters:
+// pFile = file of the bean
+// pBean = destination bean
+// pTimeout = max wait of the lock, see LockBeanFile
+//Returns:
+// the lock, to release by SaveAndRelease or Release
+// an error satisfying IsBeanNotFound if the bean doesn't exist, use LockBeanFile to create it
+func LoadBeanForUpdate(pFile string, pBean interface{}, pTimeout time.Duration) (*BeanFileLock, error) {
+
+	vRis, vLockError := LockBeanFile(pFile, pTimeout)
+	if vLockError != nil {
+		return nil, vLockError
+	}
+
+	vLoadError := vRis.Load(pBean)
+	if vLoadError != nil {
+		vRis.Release()
+		return nil, vLoadError
+	}
+	return vRis, nil
+}
+
+//GetFile returns the file of the bean
+func (vSelf *BeanFileLock) GetFile() string {
+	return vSelf.file
+}
+
+//Load loads the bean again while holding the lock
+func (vSelf *BeanFileLock) Load(pBean interface{}) error {
+	return LoadBeanFromFile(vSelf.file, pBean)
+}
+
+//SaveAndRelease saves the bean as indented json and releases the lock, also if the save fails
+func (vSelf *BeanFileLock) SaveAndRelease(pBean interface{}) error {
+	return vSelf.SaveWithOptionsAndRelease(pBean, BeanFileOptions{Codec: IndentedJsonCodec{}})
+}
+
+//SaveWithOptionsAndRelease saves the bean like SaveBeanIntoFileWithOptions and releases the lock, also if the save fails
+func (vSelf *BeanFileLock) SaveWithOptionsAndRelease(pBean interface{}, pOptions BeanFileOptions) error {
+	vSaveError := saveBeanIntoFile(pBean, vSelf.file, pOptions)
+	vReleaseError := vSelf.Release()
+	if vSaveError != nil {
+		return vSaveError
+	}
+	return vReleaseError
+}
+
+//Release releases the lock without saving, further calls do nothing
+func (vSelf *BeanFileLock) Release() error {
+	return vSelf.lock.Unlock()
+}
@@ -0,0 +1,103 @@
+package persistency
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mysinmyc/gocommons/myfileutils"
+)
+
+func TestBeanFileLock(pTest *testing.T) {
+
+	vFile := GetBeanFilePath(pTest.TempDir(), "counter")
+
+	if _, vLoadError := LoadBeanForUpdate(vFile, &testBean{}, 0); IsBeanNotFound(vLoadError) == false {
+		pTest.Fatalf("expected bean not found, got %v", vLoadError)
+	}
+
+	vCreateLock, vCreateError := LockBeanFile(vFile, 0)
+	if vCreateError != nil {
+		pTest.Fatal("failed to lock missing bean", vCreateError)
+	}
+	if _, vLockError := LockBeanFile(vFile, 20*time.Millisecond); myfileutils.IsLockTimeout(vLockError) == false {
+		pTest.Errorf("expected lock timeout, got %v", vLockError)
+	}
+	if vSaveError := vCreateLock.SaveAndRelease(&testBean{Id: "counter"}); vSaveError != nil {
+		pTest.Fatal("failed to create bean", vSaveError)
+	}
+	if vReleaseError := vCreateLock.Release(); vReleaseError != nil {
+		pTest.Error("second release failed", vReleaseError)
+	}
+
+	var vWaitGroup sync.WaitGroup
+	for vCnt := 0; vCnt < 8; vCnt++ {
+		vWaitGroup.Add(1)
+		go func() {
+			defer vWaitGroup.Done()
+			for vIteration := 0; vIteration < 10; vIteration++ {
+				vBean := &testBean{}
+				vLock, vLoadError := LoadBeanForUpdate(vFile, vBean, myfileutils.FileLock_WaitForever)
+				if vLoadError != nil {
+					pTest.Error("failed to load bean for update", vLoadError)
+					return
+				}
+				vBean.Value++
+				if vSaveError := vLock.SaveAndRelease(vBean); vSaveError != nil {
+					pTest.Error("failed to save bean", vSaveError)
+					return
+				}
+			}
+		}()
+	}
+	vWaitGroup.Wait()
+
+	vBean := &testBean{}
+	LoadBeanFromFile(vFile, vBean)
+	if vBean.Value != 80 {
+		pTest.Errorf("lost updates, counter %d", vBean.Value)
+	}
+	if vIds, _, _ := ListBeanFileIds(filepath.Dir(vFile), "", 0, ""); len(vIds) != 1 {
+		pTest.Errorf("lock file listed as bean %v", vIds)
+	}
+
+	//plain saves wait for the lock
+	vHeldLock, _ := LoadBeanForUpdate(vFile, &testBean{}, 0)
+	vSaved := make(chan error)
+	go func() {
+		vSaved <- SaveBeanIntoFile(&testBean{Id: "counter", Value: -1}, vFile)
+	}()
+	select {
+	case vSaveError := <-vSaved:
+		pTest.Fatalf("bean saved while locked %v", vSaveError)
+	case <-time.After(50 * time.Millisecond):
+	}
+	vHeldLock.SaveAndRelease(&testBean{Id: "counter", Value: 81})
+	if vSaveError := <-vSaved; vSaveError != nil {
+		pTest.Fatal("failed to save bean", vSaveError)
+	}
+	LoadBeanFromFile(vFile, vBean)
+	if vBean.Value != -1 {
+		pTest.Errorf("unexpected counter %d", vBean.Value)
+	}
+
+	//deletes wait for the lock
+	vHeldLock, _ = LoadBeanForUpdate(vFile, &testBean{}, 0)
+	vDeleted := make(chan error)
+	go func() {
+		vDeleted <- DeleteBeanFile(vFile)
+	}()
+	select {
+	case vDeleteError := <-vDeleted:
+		pTest.Fatalf("bean deleted while locked %v", vDeleteError)
+	case <-time.After(50 * time.Millisecond):
+	}
+	vHeldLock.Release()
+	if vDeleteError := <-vDeleted; vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	if vExists, _ := ExistsBeanFile(vFile); vExists {
+		pTest.Error("bean not deleted")
+	}
+}
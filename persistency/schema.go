@@ -0,0 +1,195 @@
+package persistency
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	//BeanSchema_Field json property stamped with the schema version on beans implementing SchemaVersionedBean
+	BeanSchema_Field = "_schema"
+	//BeanSchema_UnstampedVersion schema version of beans saved without stamp
+	BeanSchema_UnstampedVersion = 1
+)
+
+var (
+	_BeanSchemasLock sync.RWMutex
+	_BeanSchemas     = make(map[reflect.Type]*beanSchema)
+)
+
+//SchemaVersionedBean beans implementing it are saved with the schema version stamped in the json property BeanSchema_Field
+//and are upgraded while loaded by the functions registered by RegisterBeanUpgrade.
+//Stamps and upgrades require codecs based on json (json, json-indent, cbor and their compressed or encrypted variants)
+type SchemaVersionedBean interface {
+	//GetBeanSchemaVersion returns the schema version of the bean type, the same for all the instances
+	GetBeanSchemaVersion() int
+}
+
+//BeanUpgradeFunc upgrades the json of a bean from a schema version to the next one. The json may contain the property BeanSchema_Field
+type BeanUpgradeFunc func(pJson []byte) ([]byte, error)
+
+//beanSchema upgrades of a bean type
+type beanSchema struct {
+	upgrades  map[int]BeanUpgradeFunc
+	writeBack bool
+}
+
+//RegisterBeanUpgrade registers the upgrade of a bean type from a schema version to the next one
+//Parameters:
+// pBean = bean of the type, as passed to the load functions (usually a pointer)
+// pFromVersion = version upgraded, the first version is BeanSchema_UnstampedVersion
+// pUpgrade = upgrade function
+func RegisterBeanUpgrade(pBean SchemaVersionedBean, pFromVersion int, pUpgrade BeanUpgradeFunc) error {
+
+	if pFromVersion < BeanSchema_UnstampedVersion || pFromVersion >= pBean.GetBeanSchemaVersion() {
+		return diagnostic.NewError("invalid upgrade of %T from schema version %d, current version is %d", nil, pBean, pFromVersion, pBean.GetBeanSchemaVersion())
+	}
+
+	_BeanSchemasLock.Lock()
+	defer _BeanSchemasLock.Unlock()
+	getBeanSchema(pBean).upgrades[pFromVersion] = pUpgrade
+	return nil
+}
+
+//SetBeanUpgradeWriteBack sets if beans of a type upgraded while loaded are saved again with the current schema version,
+//by LoadBeanFromFile and by db.DbHelper load functions. By default upgrades are repeated by each load
+func SetBeanUpgradeWriteBack(pBean SchemaVersionedBean, pWriteBack bool) {
+	_BeanSchemasLock.Lock()
+	defer _BeanSchemasLock.Unlock()
+	getBeanSchema(pBean).writeBack = pWriteBack
+}
+
+//IsBeanUpgradeWriteBack returns true if upgraded beans of the type of a bean must be saved again
+func IsBeanUpgradeWriteBack(pBean interface{}) bool {
+	_BeanSchemasLock.RLock()
+	defer _BeanSchemasLock.RUnlock()
+	vSchema := _BeanSchemas[reflect.TypeOf(pBean)]
+	return vSchema != nil && vSchema.writeBack
+}
+
+//getBeanSchema returns the schema of the type of a bean, creating it. Requires the write lock
+func getBeanSchema(pBean interface{}) *beanSchema {
+	vType := reflect.TypeOf(pBean)
+	vRis := _BeanSchemas[vType]
+	if vRis == nil {
+		vRis = &beanSchema{upgrades: make(map[int]BeanUpgradeFunc)}
+		_BeanSchemas[vType] = vRis
+	}
+	return vRis
+}
+
+//isJsonBasedCodec returns true if a codec serializes the json representation of the beans
+func isJsonBasedCodec(pCodec Codec) bool {
+	if pCodec == nil {
+		return true
+	}
+	switch strings.SplitN(pCodec.GetName(), "+", 2)[0] {
+	case CodecName_Json, CodecName_IndentedJson, CodecName_Cbor:
+		return true
+	}
+	return false
+}
+
+//stampBeanSchema returns the json of a bean with the schema version as first property
+func stampBeanSchema(pBean SchemaVersionedBean) (json.RawMessage, error) {
+
+	vJson, vJsonError := json.Marshal(pBean)
+	if vJsonError != nil {
+		return nil, vJsonError
+	}
+	vJson = bytes.TrimSpace(vJson)
+	if len(vJson) < 2 || vJson[0] != '{' {
+		return nil, diagnostic.NewError("schema versioned bean %T is not a json object", nil, pBean)
+	}
+
+	vStamp := "{\"" + BeanSchema_Field + "\":" + strconv.Itoa(pBean.GetBeanSchemaVersion())
+	vRest := bytes.TrimSpace(vJson[1:])
+	if len(vRest) > 0 && vRest[0] != '}' {
+		vStamp += ","
+	}
+	return append([]byte(vStamp), vRest...), nil
+}
+
+//UnmarshalAndUpgradeBean deserialize and validate a bean like UnmarshalBean, applying the upgrades of beans stamped with a previous schema version
+//Returns:
+// true if the bean has been upgraded
+// error, satisfying IsValidationError if the bean is invalid
+func UnmarshalAndUpgradeBean(pData []byte, pBean interface{}) (bool, error) {
+	vUpgraded, vUnmarshalError := unmarshalAndUpgradeBean(pData, pBean)
+	if vUnmarshalError != nil {
+		return false, vUnmarshalError
+	}
+	return vUpgraded, ValidateBean(pBean)
+}
+
+//unmarshalAndUpgradeBean deserialize and upgrade a bean without validating it
+func unmarshalAndUpgradeBean(pData []byte, pBean interface{}) (bool, error) {
+
+	vVersioned, vIsVersioned := pBean.(SchemaVersionedBean)
+	if vIsVersioned == false {
+		return false, unmarshalBeanData(pData, pBean)
+	}
+
+	vCodec, _, vCodecError := splitCodecMarker(pData)
+	if vCodecError != nil {
+		return false, vCodecError
+	}
+	if isJsonBasedCodec(vCodec) == false {
+		return false, unmarshalBeanData(pData, pBean)
+	}
+
+	vJson, vJsonError := BeanDataToJson(pData)
+	if vJsonError != nil {
+		return false, vJsonError
+	}
+
+	vStamp := make(map[string]json.RawMessage)
+	if vStampError := json.Unmarshal(vJson, &vStamp); vStampError != nil {
+		return false, diagnostic.NewError("error while reading schema version of %T", vStampError, pBean)
+	}
+	vVersion := BeanSchema_UnstampedVersion
+	if vRawVersion, vStamped := vStamp[BeanSchema_Field]; vStamped {
+		if vVersionError := json.Unmarshal(vRawVersion, &vVersion); vVersionError != nil {
+			return false, diagnostic.NewError("invalid schema version of %T", vVersionError, pBean)
+		}
+	}
+
+	vCurrentVersion := vVersioned.GetBeanSchemaVersion()
+	if vVersion > vCurrentVersion {
+		return false, diagnostic.NewError("%T has schema version %d newer than %d", nil, pBean, vVersion, vCurrentVersion)
+	}
+
+	if vVersion == vCurrentVersion {
+		//decoded by the codec like the beans without schema
+		return false, unmarshalBeanData(pData, pBean)
+	}
+
+	for ; vVersion < vCurrentVersion; vVersion++ {
+		_BeanSchemasLock.RLock()
+		var vUpgrade BeanUpgradeFunc
+		if vSchema := _BeanSchemas[reflect.TypeOf(pBean)]; vSchema != nil {
+			vUpgrade = vSchema.upgrades[vVersion]
+		}
+		_BeanSchemasLock.RUnlock()
+		if vUpgrade == nil {
+			return false, diagnostic.NewError("missing upgrade of %T from schema version %d", nil, pBean, vVersion)
+		}
+
+		var vUpgradeError error
+		vJson, vUpgradeError = vUpgrade(vJson)
+		if vUpgradeError != nil {
+			return false, diagnostic.NewError("error while upgrading %T from schema version %d", vUpgradeError, pBean, vVersion)
+		}
+	}
+
+	if vUnmarshalError := json.Unmarshal(vJson, pBean); vUnmarshalError != nil {
+		return false, diagnostic.NewError("error while unmarshalling bean %T", vUnmarshalError, pBean)
+	}
+	return true, nil
+}
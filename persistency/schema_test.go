@@ -0,0 +1,138 @@
+package persistency
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+//testSchemaBean version 1 had Name, version 2 renamed it FullName, version 3 added Tags
+type testSchemaBean struct {
+	FullName string
+	Tags     []string
+}
+
+func (vSelf *testSchemaBean) GetBeanSchemaVersion() int {
+	return 3
+}
+
+func registerTestSchemaBeanUpgrades(pTest *testing.T) {
+
+	vRenameError := RegisterBeanUpgrade(&testSchemaBean{}, 1, func(pJson []byte) ([]byte, error) {
+		vFields := make(map[string]interface{})
+		if vError := json.Unmarshal(pJson, &vFields); vError != nil {
+			return nil, vError
+		}
+		vFields["FullName"] = vFields["Name"]
+		delete(vFields, "Name")
+		return json.Marshal(vFields)
+	})
+	vTagsError := RegisterBeanUpgrade(&testSchemaBean{}, 2, func(pJson []byte) ([]byte, error) {
+		vFields := make(map[string]interface{})
+		if vError := json.Unmarshal(pJson, &vFields); vError != nil {
+			return nil, vError
+		}
+		vFields["Tags"] = []string{"upgraded"}
+		return json.Marshal(vFields)
+	})
+	if vRenameError != nil || vTagsError != nil {
+		pTest.Fatal("failed to register upgrades", vRenameError, vTagsError)
+	}
+}
+
+func TestBeanSchemaUpgrades(pTest *testing.T) {
+
+	registerTestSchemaBeanUpgrades(pTest)
+	if RegisterBeanUpgrade(&testSchemaBean{}, 3, nil) == nil {
+		pTest.Error("upgrade from the current version accepted")
+	}
+
+	vFile := GetBeanFilePath(pTest.TempDir(), "old")
+	ioutil.WriteFile(vFile, []byte(`{"Name":"old bean"}`), 0644)
+
+	vLoaded := &testSchemaBean{}
+	if vLoadError := LoadBeanFromFile(vFile, vLoaded); vLoadError != nil || vLoaded.FullName != "old bean" || len(vLoaded.Tags) != 1 {
+		pTest.Fatalf("unexpected upgraded bean %v %v", vLoaded, vLoadError)
+	}
+	if vContent, _ := ioutil.ReadFile(vFile); string(vContent) != `{"Name":"old bean"}` {
+		pTest.Errorf("bean written back without write back enabled %s", vContent)
+	}
+
+	SetBeanUpgradeWriteBack(&testSchemaBean{}, true)
+	defer SetBeanUpgradeWriteBack(&testSchemaBean{}, false)
+	LoadBeanFromFile(vFile, &testSchemaBean{})
+	vContent, _ := ioutil.ReadFile(vFile)
+	if strings.Contains(string(vContent), `"_schema": 3`) == false || strings.Contains(string(vContent), "FullName") == false {
+		pTest.Errorf("upgraded bean not written back %s", vContent)
+	}
+	vUpgraded, vUnmarshalError := UnmarshalAndUpgradeBean(vContent, &testSchemaBean{})
+	if vUnmarshalError != nil || vUpgraded {
+		pTest.Errorf("written back bean upgraded again %v", vUnmarshalError)
+	}
+
+	vCodec, _ := GetCodec("cbor+gzip")
+	vCbor, _ := MarshalBean(vCodec, &testSchemaBean{FullName: "cbor"})
+	vCborJson, _ := BeanDataToJson(vCbor)
+	if strings.Contains(string(vCborJson), `"_schema":3`) == false {
+		pTest.Errorf("cbor bean not stamped %s", vCborJson)
+	}
+
+	if UnmarshalBean([]byte(`{"_schema":4}`), &testSchemaBean{}) == nil {
+		pTest.Error("bean with a newer schema version loaded")
+	}
+}
+
+type testUnupgradableBean struct {
+	Value string
+}
+
+func (vSelf *testUnupgradableBean) GetBeanSchemaVersion() int {
+	return 2
+}
+
+func TestBeanSchemaMissingUpgrade(pTest *testing.T) {
+	if vUnmarshalError := UnmarshalBean([]byte(`{"Value":"v1"}`), &testUnupgradableBean{}); vUnmarshalError == nil {
+		pTest.Error("bean loaded without upgrade")
+	}
+	vData, _ := MarshalBean(nil, &testUnupgradableBean{Value: "v2"})
+	vLoaded := &testUnupgradableBean{}
+	if vUnmarshalError := UnmarshalBean(vData, vLoaded); vUnmarshalError != nil || vLoaded.Value != "v2" {
+		pTest.Errorf("failed to load current bean %s %v", vData, vUnmarshalError)
+	}
+}
+
+type testSchemaNumberBean struct {
+	Value int64
+}
+
+func (vSelf *testSchemaNumberBean) GetBeanSchemaVersion() int {
+	return 2
+}
+
+func TestBeanSchemaNumbersPrecision(pTest *testing.T) {
+
+	vUpgradeError := RegisterBeanUpgrade(&testSchemaNumberBean{}, 1, func(pJson []byte) ([]byte, error) {
+		return pJson, nil
+	})
+	if vUpgradeError != nil {
+		pTest.Fatal("failed to register upgrade", vUpgradeError)
+	}
+
+	vValue := int64(1<<62 + 1)
+	for _, vCurCodecName := range []string{"json+gzip", "json+flate", "cbor"} {
+		vCodec, _ := GetCodec(vCurCodecName)
+
+		vCurrent, _ := MarshalBean(vCodec, &testSchemaNumberBean{Value: vValue})
+		vLoaded := &testSchemaNumberBean{}
+		if vUnmarshalError := UnmarshalBean(vCurrent, vLoaded); vUnmarshalError != nil || vLoaded.Value != vValue {
+			pTest.Errorf("%s: unexpected current bean %v %v", vCurCodecName, vLoaded, vUnmarshalError)
+		}
+
+		vUnstamped, _ := MarshalBean(vCodec, map[string]int64{"Value": vValue})
+		vUpgraded := &testSchemaNumberBean{}
+		if vUnmarshalError := UnmarshalBean(vUnstamped, vUpgraded); vUnmarshalError != nil || vUpgraded.Value != vValue {
+			pTest.Errorf("%s: unexpected upgraded bean %v %v", vCurCodecName, vUpgraded, vUnmarshalError)
+		}
+	}
+}
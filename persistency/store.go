@@ -0,0 +1,171 @@
+package persistency
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//BeanStore storage of beans by id, implemented by directories (FileBeanStore), memory (MemoryBeanStore) and databases (db.DbBeanStore).
+//Beans implementing VersionedBean are saved only if the stored copy has the same version
+type BeanStore interface {
+	//LoadBean loads a bean, returns an error satisfying IsBeanNotFound if it doesn't exist
+	LoadBean(pId string, pBean interface{}) error
+	//SaveBean inserts or updates a bean
+	SaveBean(pId string, pBean interface{}) error
+	//DeleteBean deletes a bean, returns an error satisfying IsBeanNotFound if it doesn't exist
+	DeleteBean(pId string) error
+	//ExistsBean returns true if a bean exists
+	ExistsBean(pId string) (bool, error)
+	//ListBeanIds list the ids of the beans sorted by id, see ListBeanFileIds for parameters
+	ListBeanIds(pPrefix string, pLimit int, pCursor string) ([]string, string, error)
+}
+
+//FileBeanStore BeanStore saving each bean in a file of a directory
+type FileBeanStore struct {
+	dir     string
+	options BeanFileOptions
+}
+
+//NewFileBeanStore create a store of beans in a directory, the directory is created by the first save
+//Parameters:
+// pDir = directory of the beans
+// pCodec = codec of saved beans, nil for indented json. Beans are loaded with any codec
+func NewFileBeanStore(pDir string, pCodec Codec) *FileBeanStore {
+	return NewFileBeanStoreWithOptions(pDir, BeanFileOptions{Codec: pCodec})
+}
+
+//NewFileBeanStoreWithOptions create a store of beans in a directory saving them with the given options, a nil codec means indented json
+func NewFileBeanStoreWithOptions(pDir string, pOptions BeanFileOptions) *FileBeanStore {
+	if pOptions.Codec == nil {
+		pOptions.Codec = IndentedJsonCodec{}
+	}
+	return &FileBeanStore{dir: pDir, options: pOptions}
+}
+
+//GetDir returns the directory of the beans
+func (vSelf *FileBeanStore) GetDir() string {
+	return vSelf.dir
+}
+
+func (vSelf *FileBeanStore) LoadBean(pId string, pBean interface{}) error {
+	vLoadError := LoadBeanFromFile(GetBeanFilePath(vSelf.dir, pId), pBean)
+	if IsBeanNotFound(vLoadError) {
+		return &BeanNotFoundError{BeanID: pId}
+	}
+	return vLoadError
+}
+
+func (vSelf *FileBeanStore) SaveBean(pId string, pBean interface{}) error {
+	if vMkdirError := os.MkdirAll(vSelf.dir, 0755); vMkdirError != nil {
+		return diagnostic.NewError("error while creating directory %s", vMkdirError, vSelf.dir)
+	}
+	return SaveBeanIntoFileWithOptions(pBean, GetBeanFilePath(vSelf.dir, pId), vSelf.options)
+}
+
+func (vSelf *FileBeanStore) DeleteBean(pId string) error {
+	vDeleteError := DeleteBeanFile(GetBeanFilePath(vSelf.dir, pId))
+	if IsBeanNotFound(vDeleteError) {
+		return &BeanNotFoundError{BeanID: pId}
+	}
+	return vDeleteError
+}
+
+func (vSelf *FileBeanStore) ExistsBean(pId string) (bool, error) {
+	return ExistsBeanFile(GetBeanFilePath(vSelf.dir, pId))
+}
+
+func (vSelf *FileBeanStore) ListBeanIds(pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+	return ListBeanFileIds(vSelf.dir, pPrefix, pLimit, pCursor)
+}
+
+//MemoryBeanStore BeanStore keeping the beans in memory, useful for tests.
+//Beans are stored serialized, so callers never share instances with the store
+type MemoryBeanStore struct {
+	lock  sync.RWMutex
+	codec Codec
+	beans map[string][]byte
+}
+
+//NewMemoryBeanStore create an empty store of beans in memory
+//Parameters:
+// pCodec = codec of saved beans, nil for json
+func NewMemoryBeanStore(pCodec Codec) *MemoryBeanStore {
+	if pCodec == nil {
+		pCodec = JsonCodec{}
+	}
+	return &MemoryBeanStore{codec: pCodec, beans: make(map[string][]byte)}
+}
+
+func (vSelf *MemoryBeanStore) LoadBean(pId string, pBean interface{}) error {
+	vSelf.lock.RLock()
+	vData, vExists := vSelf.beans[pId]
+	vSelf.lock.RUnlock()
+	if vExists == false {
+		return &BeanNotFoundError{BeanID: pId}
+	}
+	return UnmarshalBean(vData, pBean)
+}
+
+func (vSelf *MemoryBeanStore) SaveBean(pId string, pBean interface{}) (vRisError error) {
+
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+
+	if vVersioned, vIsVersioned := pBean.(VersionedBean); vIsVersioned {
+		vVersion := vVersioned.GetBeanVersion()
+		vVersionError := checkStoredBeanVersion(vVersioned, vSelf.beans[pId], pId)
+		if vVersionError != nil {
+			return vVersionError
+		}
+		vVersioned.SetBeanVersion(vVersion + 1)
+		defer func() {
+			if vRisError != nil {
+				vVersioned.SetBeanVersion(vVersion)
+			}
+		}()
+	}
+
+	vData, vMarshalError := MarshalBean(vSelf.codec, pBean)
+	if vMarshalError != nil {
+		return vMarshalError
+	}
+	vSelf.beans[pId] = vData
+	return nil
+}
+
+func (vSelf *MemoryBeanStore) DeleteBean(pId string) error {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	if _, vExists := vSelf.beans[pId]; vExists == false {
+		return &BeanNotFoundError{BeanID: pId}
+	}
+	delete(vSelf.beans, pId)
+	return nil
+}
+
+func (vSelf *MemoryBeanStore) ExistsBean(pId string) (bool, error) {
+	vSelf.lock.RLock()
+	defer vSelf.lock.RUnlock()
+	_, vExists := vSelf.beans[pId]
+	return vExists, nil
+}
+
+func (vSelf *MemoryBeanStore) ListBeanIds(pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+
+	vSelf.lock.RLock()
+	vIds := make([]string, 0, len(vSelf.beans))
+	for vCurId := range vSelf.beans {
+		if strings.HasPrefix(vCurId, pPrefix) {
+			vIds = append(vIds, vCurId)
+		}
+	}
+	vSelf.lock.RUnlock()
+
+	sort.Strings(vIds)
+	vPage, vNextCursor := pageBeanIds(vIds, pLimit, pCursor)
+	return vPage, vNextCursor, nil
+}
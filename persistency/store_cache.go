@@ -0,0 +1,243 @@
+package persistency
+
+import (
+	"container/list"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	BeanCache_DefaultMaxSize = 1000
+)
+
+//BeanCacheOptions settings of a CachingBeanStore
+type BeanCacheOptions struct {
+	//MaxSize max number of cached results, found and not found, the least recently used are evicted. Default BeanCache_DefaultMaxSize
+	MaxSize int
+	//TTL time to live of cached beans, 0 for beans cached until evicted or invalidated
+	TTL time.Duration
+	//NegativeTTL time to live of not found results, 0 to not cache them
+	NegativeTTL time.Duration
+}
+
+//BeanCacheStats counters of a CachingBeanStore
+type BeanCacheStats struct {
+	//Hits loads served by cached beans
+	Hits int64
+	//NegativeHits loads and exists served by cached not found results
+	NegativeHits int64
+	//Misses loads delegated to the underlying store
+	Misses int64
+	//Evictions results evicted by the size limit
+	Evictions int64
+	//Size number of cached results
+	Size int
+}
+
+//beanCacheEntry cached result, data is nil for not found results
+type beanCacheEntry struct {
+	id        string
+	data      []byte
+	beanType  reflect.Type
+	version   int64
+	expiresAt time.Time
+}
+
+//CachingBeanStore read-through cache of another BeanStore.
+//Loaded beans are kept as json and unmarshalled into the beans passed to LoadBean, so callers never share their content:
+//fields not marshalled to json are not restored by cached loads.
+//Save and Delete invalidate the cached result, changes made bypassing the cache require Invalidate
+type CachingBeanStore struct {
+	store   BeanStore
+	options BeanCacheOptions
+	now     func() time.Time
+
+	lock       sync.Mutex
+	entries    map[string]*list.Element
+	recentUsed *list.List
+	//generation increased by each invalidation, loads started before it don't populate the cache
+	generation uint64
+	stats      BeanCacheStats
+}
+
+var _ BeanStore = &CachingBeanStore{}
+
+//NewCachingBeanStore wraps a store with a cache
+func NewCachingBeanStore(pStore BeanStore, pOptions BeanCacheOptions) *CachingBeanStore {
+	if pOptions.MaxSize <= 0 {
+		pOptions.MaxSize = BeanCache_DefaultMaxSize
+	}
+	return &CachingBeanStore{
+		store:      pStore,
+		options:    pOptions,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		recentUsed: list.New()}
+}
+
+func (vSelf *CachingBeanStore) LoadBean(pId string, pBean interface{}) error {
+
+	vTarget := reflect.ValueOf(pBean)
+	if vTarget.Kind() != reflect.Ptr || vTarget.IsNil() {
+		//not unmarshallable, the cache is bypassed
+		return vSelf.store.LoadBean(pId, pBean)
+	}
+
+	vSelf.lock.Lock()
+	vEntry := vSelf.getEntry(pId)
+	if vEntry != nil {
+		if vEntry.data == nil {
+			vSelf.stats.NegativeHits++
+			vSelf.lock.Unlock()
+			return &BeanNotFoundError{BeanID: pId}
+		}
+		if vEntry.beanType == vTarget.Elem().Type() {
+			vSelf.stats.Hits++
+			vData, vVersion := vEntry.data, vEntry.version
+			vSelf.lock.Unlock()
+			return loadCachedBean(pId, vData, vVersion, vTarget)
+		}
+	}
+	vSelf.stats.Misses++
+	vGeneration := vSelf.generation
+	vSelf.lock.Unlock()
+
+	vLoadError := vSelf.store.LoadBean(pId, pBean)
+	if vLoadError != nil && IsBeanNotFound(vLoadError) == false {
+		return vLoadError
+	}
+
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	if vGeneration != vSelf.generation {
+		return vLoadError
+	}
+	if vLoadError != nil {
+		if vSelf.options.NegativeTTL > 0 {
+			vSelf.putEntry(&beanCacheEntry{id: pId, expiresAt: vSelf.now().Add(vSelf.options.NegativeTTL)})
+		}
+		return vLoadError
+	}
+
+	vData, vMarshalError := json.Marshal(pBean)
+	if vMarshalError != nil {
+		//not cacheable
+		return nil
+	}
+	vEntry = &beanCacheEntry{id: pId, data: vData, beanType: vTarget.Elem().Type()}
+	if vVersioned, vIsVersioned := pBean.(VersionedBean); vIsVersioned {
+		vEntry.version = vVersioned.GetBeanVersion()
+	}
+	if vSelf.options.TTL > 0 {
+		vEntry.expiresAt = vSelf.now().Add(vSelf.options.TTL)
+	}
+	vSelf.putEntry(vEntry)
+	return nil
+}
+
+func (vSelf *CachingBeanStore) SaveBean(pId string, pBean interface{}) error {
+	defer vSelf.Invalidate(pId)
+	return vSelf.store.SaveBean(pId, pBean)
+}
+
+func (vSelf *CachingBeanStore) DeleteBean(pId string) error {
+	defer vSelf.Invalidate(pId)
+	return vSelf.store.DeleteBean(pId)
+}
+
+func (vSelf *CachingBeanStore) ExistsBean(pId string) (bool, error) {
+	vSelf.lock.Lock()
+	vEntry := vSelf.getEntry(pId)
+	if vEntry != nil {
+		if vEntry.data != nil {
+			vSelf.stats.Hits++
+		} else {
+			vSelf.stats.NegativeHits++
+		}
+		vSelf.lock.Unlock()
+		return vEntry.data != nil, nil
+	}
+	vSelf.lock.Unlock()
+	return vSelf.store.ExistsBean(pId)
+}
+
+//loadCachedBean unmarshals a cached bean into a zeroed bean, the version of versioned beans is restored also if not marshalled
+func loadCachedBean(pId string, pData []byte, pVersion int64, pTarget reflect.Value) error {
+	pTarget.Elem().Set(reflect.Zero(pTarget.Elem().Type()))
+	if vUnmarshalError := json.Unmarshal(pData, pTarget.Interface()); vUnmarshalError != nil {
+		return diagnostic.NewError("error while unmarshalling cached bean %s", vUnmarshalError, pId)
+	}
+	if vVersioned, vIsVersioned := pTarget.Interface().(VersionedBean); vIsVersioned {
+		vVersioned.SetBeanVersion(pVersion)
+	}
+	return nil
+}
+
+//ListBeanIds delegated to the underlying store, lists are not cached
+func (vSelf *CachingBeanStore) ListBeanIds(pPrefix string, pLimit int, pCursor string) ([]string, string, error) {
+	return vSelf.store.ListBeanIds(pPrefix, pLimit, pCursor)
+}
+
+//Invalidate removes the cached result of a bean
+func (vSelf *CachingBeanStore) Invalidate(pId string) {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	vSelf.generation++
+	if vElement := vSelf.entries[pId]; vElement != nil {
+		vSelf.removeElement(vElement)
+	}
+}
+
+//Clear removes all the cached results, counters are kept
+func (vSelf *CachingBeanStore) Clear() {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	vSelf.generation++
+	vSelf.entries = make(map[string]*list.Element)
+	vSelf.recentUsed.Init()
+}
+
+//GetStats returns the counters of the cache
+func (vSelf *CachingBeanStore) GetStats() BeanCacheStats {
+	vSelf.lock.Lock()
+	defer vSelf.lock.Unlock()
+	vRis := vSelf.stats
+	vRis.Size = len(vSelf.entries)
+	return vRis
+}
+
+//getEntry returns the cached result of a bean, nil if missing or expired. Requires the lock
+func (vSelf *CachingBeanStore) getEntry(pId string) *beanCacheEntry {
+	vElement := vSelf.entries[pId]
+	if vElement == nil {
+		return nil
+	}
+	vEntry := vElement.Value.(*beanCacheEntry)
+	if vEntry.expiresAt.IsZero() == false && vSelf.now().Before(vEntry.expiresAt) == false {
+		vSelf.removeElement(vElement)
+		return nil
+	}
+	vSelf.recentUsed.MoveToFront(vElement)
+	return vEntry
+}
+
+//putEntry caches a result evicting the least recently used ones beyond the size limit. Requires the lock
+func (vSelf *CachingBeanStore) putEntry(pEntry *beanCacheEntry) {
+	if vElement := vSelf.entries[pEntry.id]; vElement != nil {
+		vSelf.removeElement(vElement)
+	}
+	vSelf.entries[pEntry.id] = vSelf.recentUsed.PushFront(pEntry)
+	for len(vSelf.entries) > vSelf.options.MaxSize {
+		vSelf.removeElement(vSelf.recentUsed.Back())
+		vSelf.stats.Evictions++
+	}
+}
+
+func (vSelf *CachingBeanStore) removeElement(pElement *list.Element) {
+	vSelf.recentUsed.Remove(pElement)
+	delete(vSelf.entries, pElement.Value.(*beanCacheEntry).id)
+}
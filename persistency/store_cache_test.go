@@ -0,0 +1,111 @@
+package persistency
+
+import (
+	"testing"
+	"time"
+)
+
+//countingBeanStore counts the loads reaching the underlying store
+type countingBeanStore struct {
+	BeanStore
+	loads int
+}
+
+func (vSelf *countingBeanStore) LoadBean(pId string, pBean interface{}) error {
+	vSelf.loads++
+	return vSelf.BeanStore.LoadBean(pId, pBean)
+}
+
+func TestCachingBeanStore(pTest *testing.T) {
+
+	vStore := &countingBeanStore{BeanStore: NewMemoryBeanStore(nil)}
+	vCache := NewCachingBeanStore(vStore, BeanCacheOptions{MaxSize: 2, TTL: time.Minute, NegativeTTL: time.Second})
+	vNow := time.Now()
+	vCache.now = func() time.Time { return vNow }
+
+	testBeanStoreContract(pTest, NewCachingBeanStore(NewMemoryBeanStore(nil), BeanCacheOptions{NegativeTTL: time.Minute}))
+
+	vCache.SaveBean("a", &testBean{Id: "a", Value: 1})
+	for vCnt := 0; vCnt < 3; vCnt++ {
+		vLoaded := &testBean{}
+		if vLoadError := vCache.LoadBean("a", vLoaded); vLoadError != nil || vLoaded.Value != 1 {
+			pTest.Fatalf("unexpected bean %v %v", vLoaded, vLoadError)
+		}
+		vLoaded.Value = 99
+	}
+	if vStore.loads != 1 {
+		pTest.Errorf("expected 1 load, got %d", vStore.loads)
+	}
+
+	vCache.SaveBean("a", &testBean{Id: "a", Value: 2})
+	vLoaded := &testBean{}
+	if vCache.LoadBean("a", vLoaded); vLoaded.Value != 2 || vStore.loads != 2 {
+		pTest.Errorf("save didn't invalidate the cache, value %d loads %d", vLoaded.Value, vStore.loads)
+	}
+
+	if vLoadError := vCache.LoadBean("missing", &testBean{}); IsBeanNotFound(vLoadError) == false {
+		pTest.Errorf("expected bean not found, got %v", vLoadError)
+	}
+	if vExists, _ := vCache.ExistsBean("missing"); vExists {
+		pTest.Error("missing bean exists")
+	}
+	vCache.LoadBean("missing", &testBean{})
+	if vStore.loads != 3 {
+		pTest.Errorf("not found result not cached, loads %d", vStore.loads)
+	}
+	vNow = vNow.Add(2 * time.Second)
+	vCache.LoadBean("missing", &testBean{})
+	if vStore.loads != 4 {
+		pTest.Errorf("not found result not expired, loads %d", vStore.loads)
+	}
+
+	vCache.Clear()
+	vCache.SaveBean("b", &testBean{Id: "b"})
+	vCache.LoadBean("a", &testBean{})
+	vCache.LoadBean("b", &testBean{})
+	vCache.LoadBean("a", &testBean{})
+	//b is the least recently used and is evicted by the not found result of c
+	vCache.LoadBean("c", &testBean{})
+	vLoadsBefore := vStore.loads
+	vCache.LoadBean("a", &testBean{})
+	vCache.LoadBean("b", &testBean{})
+	if vStore.loads != vLoadsBefore+1 {
+		pTest.Errorf("unexpected loads after eviction %d", vStore.loads-vLoadsBefore)
+	}
+
+	vNow = vNow.Add(2 * time.Minute)
+	vLoadsBefore = vStore.loads
+	vCache.LoadBean("a", &testBean{})
+	if vStore.loads != vLoadsBefore+1 {
+		pTest.Error("bean not expired")
+	}
+
+	vStats := vCache.GetStats()
+	if vStats.Hits != 4 || vStats.NegativeHits != 2 || vStats.Misses != int64(vStore.loads) || vStats.Evictions != 2 || vStats.Size != 2 {
+		pTest.Errorf("unexpected stats %+v loads %d", vStats, vStore.loads)
+	}
+}
+
+type testCachedBean struct {
+	Tags       []string
+	Attributes map[string]string
+}
+
+func TestCachingBeanStoreCopies(pTest *testing.T) {
+
+	vCache := NewCachingBeanStore(NewMemoryBeanStore(nil), BeanCacheOptions{})
+	vCache.SaveBean("a", &testCachedBean{Tags: []string{"first"}, Attributes: map[string]string{"key": "first"}})
+
+	for vCnt := 0; vCnt < 3; vCnt++ {
+		vLoaded := &testCachedBean{Tags: []string{"stale", "stale"}}
+		if vLoadError := vCache.LoadBean("a", vLoaded); vLoadError != nil || len(vLoaded.Tags) != 1 || vLoaded.Tags[0] != "first" || vLoaded.Attributes["key"] != "first" {
+			pTest.Fatalf("unexpected bean %v %v", vLoaded, vLoadError)
+		}
+		//changes in place don't reach the cache
+		vLoaded.Tags[0] = "changed"
+		vLoaded.Attributes["key"] = "changed"
+	}
+	if vStats := vCache.GetStats(); vStats.Hits != 2 || vStats.Misses != 1 {
+		pTest.Errorf("unexpected stats %+v", vStats)
+	}
+}
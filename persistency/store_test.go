@@ -0,0 +1,89 @@
+package persistency
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+//testBeanStoreContract checks the behaviour shared by all the implementations of BeanStore
+func testBeanStoreContract(pTest *testing.T, pStore BeanStore) {
+
+	if vLoadError := pStore.LoadBean("missing", &testBean{}); IsBeanNotFound(vLoadError) == false {
+		pTest.Errorf("expected bean not found, got %v", vLoadError)
+	}
+	if vDeleteError := pStore.DeleteBean("missing"); IsBeanNotFound(vDeleteError) == false {
+		pTest.Errorf("expected bean not found, got %v", vDeleteError)
+	}
+
+	for _, vCurId := range []string{"b/2", "a/1", "b/1", "b/3"} {
+		if vSaveError := pStore.SaveBean(vCurId, &testBean{Id: vCurId, Value: len(vCurId)}); vSaveError != nil {
+			pTest.Fatal("failed to save bean", vSaveError)
+		}
+	}
+
+	vLoaded := &testBean{}
+	if vLoadError := pStore.LoadBean("b/2", vLoaded); vLoadError != nil || vLoaded.Id != "b/2" {
+		pTest.Errorf("unexpected bean %v %v", vLoaded, vLoadError)
+	}
+	if vExists, _ := pStore.ExistsBean("a/1"); vExists == false {
+		pTest.Error("bean a/1 not found")
+	}
+
+	vIds, vCursor, vListError := pStore.ListBeanIds("b/", 2, "")
+	if vListError != nil || len(vIds) != 2 || vIds[0] != "b/1" || vCursor != "b/2" {
+		pTest.Errorf("unexpected first page %v cursor %s %v", vIds, vCursor, vListError)
+	}
+	vIds, vCursor, _ = pStore.ListBeanIds("b/", 2, vCursor)
+	if len(vIds) != 1 || vIds[0] != "b/3" || vCursor != "" {
+		pTest.Errorf("unexpected last page %v cursor %s", vIds, vCursor)
+	}
+
+	if vDeleteError := pStore.DeleteBean("a/1"); vDeleteError != nil {
+		pTest.Fatal("failed to delete bean", vDeleteError)
+	}
+	if vExists, _ := pStore.ExistsBean("a/1"); vExists {
+		pTest.Error("bean a/1 still exists")
+	}
+
+	vFirst := &testVersionedBean{Value: "first"}
+	if vSaveError := pStore.SaveBean("versioned", vFirst); vSaveError != nil || vFirst.Version != 1 {
+		pTest.Fatalf("failed to save versioned bean, version %d %v", vFirst.Version, vSaveError)
+	}
+	vSecond := &testVersionedBean{}
+	pStore.LoadBean("versioned", vSecond)
+	vSecond.Value = "second"
+	if vSaveError := pStore.SaveBean("versioned", vSecond); vSaveError != nil {
+		pTest.Fatal("failed to save versioned bean", vSaveError)
+	}
+	vFirst.Value = "stale"
+	if vSaveError := pStore.SaveBean("versioned", vFirst); IsConcurrentModification(vSaveError) == false || vFirst.Version != 1 {
+		pTest.Errorf("expected concurrent modification, got %v version %d", vSaveError, vFirst.Version)
+	}
+}
+
+func TestFileBeanStore(pTest *testing.T) {
+	vDir := filepath.Join(pTest.TempDir(), "beans")
+	testBeanStoreContract(pTest, NewFileBeanStore(vDir, nil))
+
+	vCodec, _ := GetCodec("cbor+gzip")
+	vStore := NewFileBeanStore(vDir, vCodec)
+	vStore.SaveBean("cbor", &testBean{Id: "cbor"})
+	vLoaded := &testBean{}
+	if vLoadError := NewFileBeanStore(vDir, nil).LoadBean("cbor", vLoaded); vLoadError != nil || vLoaded.Id != "cbor" {
+		pTest.Errorf("failed to load bean saved with another codec %v %v", vLoaded, vLoadError)
+	}
+}
+
+func TestMemoryBeanStore(pTest *testing.T) {
+	testBeanStoreContract(pTest, NewMemoryBeanStore(nil))
+
+	vStore := NewMemoryBeanStore(nil)
+	vBean := &testBean{Id: "copy", Value: 1}
+	vStore.SaveBean("copy", vBean)
+	vBean.Value = 2
+	vLoaded := &testBean{}
+	vStore.LoadBean("copy", vLoaded)
+	if vLoaded.Value != 1 {
+		pTest.Errorf("memory store shares the bean instance, value %d", vLoaded.Value)
+	}
+}
@@ -0,0 +1,348 @@
+package persistency
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	//Tag_Validate struct tag of the validation rules separated by commas: required, min=N, max=N, enum=a|b|c, regex=expression.
+	//min and max limit numbers and the length of strings, slices and maps; regex must be the last rule, it may contain commas.
+	//Rules other than required skip empty strings, slices, maps and nil pointers, numbers and booleans are always checked
+	Tag_Validate = "validate"
+)
+
+var (
+	_ValidationRules sync.Map
+)
+
+//ValidatableBean beans and nested structs implementing it are validated by Validate after the tag rules
+type ValidatableBean interface {
+	Validate() error
+}
+
+//FieldError failed validation of a field
+type FieldError struct {
+	//Path json path of the field (ex. items[2].name), empty for errors of the bean returned by Validate
+	Path    string
+	Message string
+}
+
+//ValidationError failed validations of a bean, all the failing fields are reported
+type ValidationError struct {
+	error
+	Fields []FieldError
+}
+
+func (vSelf *ValidationError) Error() string {
+	vMessages := make([]string, 0, len(vSelf.Fields))
+	for _, vCurField := range vSelf.Fields {
+		if vCurField.Path == "" {
+			vMessages = append(vMessages, vCurField.Message)
+		} else {
+			vMessages = append(vMessages, vCurField.Path+": "+vCurField.Message)
+		}
+	}
+	return "invalid bean: " + strings.Join(vMessages, "; ")
+}
+
+func IsValidationError(pError error) bool {
+	if pError == nil {
+		return false
+	}
+	_, vIsValidationError := diagnostic.GetMainError(pError, false).(*ValidationError)
+	return vIsValidationError
+}
+
+//fieldRules validation rules of a struct field
+type fieldRules struct {
+	index    int
+	name     string
+	required bool
+	min      *float64
+	max      *float64
+	enum     []string
+	regex    *regexp.Regexp
+}
+
+//structRules validation rules of a struct type
+type structRules struct {
+	fields    []fieldRules
+	tagsError error
+}
+
+//ValidateBean validates a bean by its tags and ValidatableBean, also nested structs, slices and maps are validated.
+//Beans are validated by MarshalBean and UnmarshalBean, so by all the save and load functions of files and databases
+//Returns:
+// nil if valid, an error satisfying IsValidationError listing all the failing fields, other errors for invalid tags
+func ValidateBean(pBean interface{}) error {
+
+	if pBean == nil {
+		return nil
+	}
+	vValidator := &beanValidator{visited: make(map[uintptr]bool)}
+	vValue := reflect.ValueOf(pBean)
+	if vValue.Kind() == reflect.Ptr && vValue.IsNil() == false {
+		vValidator.visited[vValue.Pointer()] = true
+		vValue = vValue.Elem()
+	}
+	vValidator.validate(vValue, "")
+
+	if vValidator.tagsError != nil {
+		return vValidator.tagsError
+	}
+	if len(vValidator.fields) > 0 {
+		return &ValidationError{Fields: vValidator.fields}
+	}
+	return nil
+}
+
+type beanValidator struct {
+	fields    []FieldError
+	tagsError error
+	visited   map[uintptr]bool
+}
+
+func (vSelf *beanValidator) fail(pPath string, pMessage string, pParameters ...interface{}) {
+	vSelf.fields = append(vSelf.fields, FieldError{Path: pPath, Message: fmt.Sprintf(pMessage, pParameters...)})
+}
+
+//validate validates nested values and structs
+func (vSelf *beanValidator) validate(pValue reflect.Value, pPath string) {
+
+	switch pValue.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if pValue.IsNil() {
+			return
+		}
+		if pValue.Kind() == reflect.Ptr {
+			if vSelf.visited[pValue.Pointer()] {
+				return
+			}
+			vSelf.visited[pValue.Pointer()] = true
+		}
+		vSelf.validate(pValue.Elem(), pPath)
+	case reflect.Slice, reflect.Array:
+		if pValue.Kind() == reflect.Slice && pValue.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for vCnt := 0; vCnt < pValue.Len(); vCnt++ {
+			vSelf.validate(pValue.Index(vCnt), pPath+"["+strconv.Itoa(vCnt)+"]")
+		}
+	case reflect.Map:
+		vIterator := pValue.MapRange()
+		for vIterator.Next() {
+			vSelf.validate(vIterator.Value(), pPath+"["+fmt.Sprint(vIterator.Key())+"]")
+		}
+	case reflect.Struct:
+		vSelf.validateStruct(pValue, pPath)
+	}
+}
+
+func (vSelf *beanValidator) validateStruct(pValue reflect.Value, pPath string) {
+
+	vRules := getStructRules(pValue.Type())
+	if vRules.tagsError != nil {
+		if vSelf.tagsError == nil {
+			vSelf.tagsError = vRules.tagsError
+		}
+		return
+	}
+
+	for _, vCurRules := range vRules.fields {
+		vPath := joinFieldPath(pPath, vCurRules.name)
+		vField := pValue.Field(vCurRules.index)
+		vSelf.checkField(vField, vPath, vCurRules)
+		vSelf.validate(vField, vPath)
+	}
+
+	var vValidatable ValidatableBean
+	if pValue.CanInterface() == false {
+		//fields of unexported embedded structs
+	} else if pValue.CanAddr() {
+		vValidatable, _ = pValue.Addr().Interface().(ValidatableBean)
+	} else {
+		vValidatable, _ = pValue.Interface().(ValidatableBean)
+	}
+	if vValidatable != nil {
+		if vValidateError := vValidatable.Validate(); vValidateError != nil {
+			if vNested, vIsValidationError := vValidateError.(*ValidationError); vIsValidationError {
+				for _, vCurField := range vNested.Fields {
+					vSelf.fail(joinFieldPath(pPath, vCurField.Path), "%s", vCurField.Message)
+				}
+			} else {
+				vSelf.fail(pPath, "%s", vValidateError.Error())
+			}
+		}
+	}
+}
+
+//checkField applies the tag rules to a field
+func (vSelf *beanValidator) checkField(pField reflect.Value, pPath string, pRules fieldRules) {
+
+	vValue := pField
+	for vValue.Kind() == reflect.Ptr || vValue.Kind() == reflect.Interface {
+		if vValue.IsNil() {
+			if pRules.required {
+				vSelf.fail(pPath, "required")
+			}
+			return
+		}
+		vValue = vValue.Elem()
+	}
+
+	var vMeasure float64
+	vEmptiable := false
+	switch vValue.Kind() {
+	case reflect.String:
+		vMeasure, vEmptiable = float64(utf8.RuneCountInString(vValue.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		vMeasure, vEmptiable = float64(vValue.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		vMeasure = float64(vValue.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		vMeasure = float64(vValue.Uint())
+	case reflect.Float32, reflect.Float64:
+		vMeasure = vValue.Float()
+	}
+
+	if vValue.IsZero() {
+		if pRules.required {
+			vSelf.fail(pPath, "required")
+			return
+		}
+		if vEmptiable || vValue.Kind() == reflect.Struct {
+			return
+		}
+	}
+
+	if pRules.min != nil && vMeasure < *pRules.min {
+		vSelf.fail(pPath, "%v is less than %v", vMeasure, *pRules.min)
+	}
+	if pRules.max != nil && vMeasure > *pRules.max {
+		vSelf.fail(pPath, "%v is greater than %v", vMeasure, *pRules.max)
+	}
+	if pRules.enum != nil {
+		vText := fmt.Sprint(vValue)
+		vFound := false
+		for _, vCurAllowed := range pRules.enum {
+			if vCurAllowed == vText {
+				vFound = true
+				break
+			}
+		}
+		if vFound == false {
+			vSelf.fail(pPath, "%s is not one of %s", vText, strings.Join(pRules.enum, ", "))
+		}
+	}
+	if pRules.regex != nil && pRules.regex.MatchString(vValue.String()) == false {
+		vSelf.fail(pPath, "%s doesn't match %s", vValue.String(), pRules.regex.String())
+	}
+}
+
+func joinFieldPath(pPath string, pName string) string {
+	if pPath == "" || pName == "" {
+		return pPath + pName
+	}
+	if strings.HasPrefix(pName, "[") {
+		return pPath + pName
+	}
+	return pPath + "." + pName
+}
+
+//getStructRules returns the cached rules of a struct type
+func getStructRules(pType reflect.Type) *structRules {
+
+	if vCached, vIsCached := _ValidationRules.Load(pType); vIsCached {
+		return vCached.(*structRules)
+	}
+
+	vRis := &structRules{}
+	for vCnt := 0; vCnt < pType.NumField(); vCnt++ {
+		vField := pType.Field(vCnt)
+		if vField.PkgPath != "" && vField.Anonymous == false {
+			continue
+		}
+		vName := vField.Name
+		if vTag, vTagged := vField.Tag.Lookup("json"); vTagged {
+			if vTagName := strings.Split(vTag, ",")[0]; vTagName == "-" {
+				//not persisted
+				continue
+			} else if vTagName != "" {
+				vName = vTagName
+			}
+		}
+		if vField.Anonymous && vField.Tag.Get("json") == "" {
+			//fields of embedded structs belong to the parent in json
+			vName = ""
+		}
+
+		vRules, vRulesError := parseFieldRules(vField, vCnt, vName)
+		if vRulesError != nil {
+			vRis.tagsError = vRulesError
+			break
+		}
+		vRis.fields = append(vRis.fields, vRules)
+	}
+
+	vCached, _ := _ValidationRules.LoadOrStore(pType, vRis)
+	return vCached.(*structRules)
+}
+
+func parseFieldRules(pField reflect.StructField, pIndex int, pName string) (fieldRules, error) {
+
+	vRis := fieldRules{index: pIndex, name: pName}
+	vTag := pField.Tag.Get(Tag_Validate)
+	for vTag != "" {
+		var vRule string
+		if strings.HasPrefix(vTag, "regex=") {
+			vRule, vTag = vTag, ""
+		} else if vComma := strings.Index(vTag, ","); vComma >= 0 {
+			vRule, vTag = vTag[:vComma], vTag[vComma+1:]
+		} else {
+			vRule, vTag = vTag, ""
+		}
+
+		vName, vArgument, _ := strings.Cut(strings.TrimSpace(vRule), "=")
+		switch vName {
+		case "required":
+			vRis.required = true
+		case "min", "max":
+			vLimit, vLimitError := strconv.ParseFloat(vArgument, 64)
+			if vLimitError != nil {
+				return vRis, diagnostic.NewError("invalid %s rule of field %s", vLimitError, vName, pField.Name)
+			}
+			if vName == "min" {
+				vRis.min = &vLimit
+			} else {
+				vRis.max = &vLimit
+			}
+		case "enum":
+			vRis.enum = strings.Split(vArgument, "|")
+		case "regex":
+			vRegex, vRegexError := regexp.Compile(vArgument)
+			if vRegexError != nil {
+				return vRis, diagnostic.NewError("invalid regex rule of field %s", vRegexError, pField.Name)
+			}
+			vFieldType := pField.Type
+			for vFieldType.Kind() == reflect.Ptr {
+				vFieldType = vFieldType.Elem()
+			}
+			if vFieldType.Kind() != reflect.String {
+				return vRis, diagnostic.NewError("regex rule of field %s requires a string", nil, pField.Name)
+			}
+			vRis.regex = vRegex
+		case "":
+		default:
+			return vRis, diagnostic.NewError("unknown validation rule %s of field %s", nil, vName, pField.Name)
+		}
+	}
+	return vRis, nil
+}
@@ -0,0 +1,80 @@
+package persistency
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type testValidatedItem struct {
+	Sku      string `json:"sku" validate:"required,regex=^[A-Z]{2}-[0-9]+$"`
+	Quantity int    `json:"quantity" validate:"min=1,max=100"`
+}
+
+type testValidatedBean struct {
+	Name   string              `json:"name" validate:"required,max=10"`
+	Status string              `json:"status" validate:"enum=open|closed"`
+	Owner  *string             `json:"owner" validate:"required"`
+	Items  []testValidatedItem `json:"items" validate:"min=1"`
+	Start  int
+	End    int
+}
+
+func (vSelf *testValidatedBean) Validate() error {
+	if vSelf.End < vSelf.Start {
+		return errors.New("end precedes start")
+	}
+	return nil
+}
+
+func TestValidateBean(pTest *testing.T) {
+
+	vOwner := "me"
+	vValid := &testValidatedBean{Name: "valid", Owner: &vOwner, Items: []testValidatedItem{{Sku: "AB-1", Quantity: 1}}}
+	if vValidateError := ValidateBean(vValid); vValidateError != nil {
+		pTest.Fatal("valid bean rejected", vValidateError)
+	}
+
+	vInvalid := &testValidatedBean{Name: "name too long", Status: "lost", Items: []testValidatedItem{{Sku: "AB-1", Quantity: 1}, {Sku: "bad", Quantity: 0}}, Start: 2, End: 1}
+	vValidateError := ValidateBean(vInvalid)
+	if IsValidationError(vValidateError) == false {
+		pTest.Fatalf("expected validation error, got %v", vValidateError)
+	}
+	vPaths := make([]string, 0)
+	for _, vCurField := range vValidateError.(*ValidationError).Fields {
+		vPaths = append(vPaths, vCurField.Path)
+	}
+	if strings.Join(vPaths, ",") != "name,status,owner,items[1].sku,items[1].quantity," {
+		pTest.Errorf("unexpected failing fields %v: %v", vPaths, vValidateError)
+	}
+
+	if vTagsError := ValidateBean(&struct {
+		Value int `validate:"regex=^a"`
+	}{}); vTagsError == nil || IsValidationError(vTagsError) {
+		pTest.Errorf("expected invalid tag error, got %v", vTagsError)
+	}
+}
+
+func TestValidateBeanOnSaveAndLoad(pTest *testing.T) {
+
+	vFile := GetBeanFilePath(pTest.TempDir(), "validated")
+
+	if vSaveError := SaveBeanIntoFile(&testValidatedBean{Name: "nobody"}, vFile); IsValidationError(vSaveError) == false {
+		pTest.Errorf("expected validation error, got %v", vSaveError)
+	}
+	if vExists, _ := ExistsBeanFile(vFile); vExists {
+		pTest.Error("invalid bean saved")
+	}
+
+	ioutil.WriteFile(vFile, []byte(`{"name":"x","owner":"me","items":[{"sku":"AB-1","quantity":500}]}`), 0644)
+	vLoadError := LoadBeanFromFile(vFile, &testValidatedBean{})
+	if IsValidationError(vLoadError) == false || strings.Contains(vLoadError.Error(), "items[0].quantity") == false {
+		pTest.Errorf("expected validation error of items[0].quantity, got %v", vLoadError)
+	}
+
+	vStore := NewMemoryBeanStore(nil)
+	if vSaveError := vStore.SaveBean("invalid", &testValidatedBean{}); IsValidationError(vSaveError) == false {
+		pTest.Errorf("expected validation error, got %v", vSaveError)
+	}
+}
@@ -0,0 +1,186 @@
+package persistency
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+const (
+	//BeanWatch_DefaultInterval default interval between checks of watched files
+	BeanWatch_DefaultInterval = time.Second
+)
+
+//BeanWatchOptions settings of a BeanFileWatcher
+type BeanWatchOptions[T any] struct {
+	//Interval between checks of the file, default BeanWatch_DefaultInterval. Changes notified by inotify are checked immediately
+	Interval time.Duration
+	//Validate optional, rejects a loaded bean keeping the previous one
+	Validate func(pBean *T) error
+	//OnChange optional, invoked after a new bean has replaced the previous one
+	OnChange func(pPrevious *T, pCurrent *T)
+	//OnError optional, invoked once for each version of the file that can't be loaded, the previous bean is kept
+	OnError func(pError error)
+}
+
+//BeanFileWatcher keeps a bean loaded from a file, reloading it when the file changes.
+//A changed file replaces the bean only if it is loaded and validated successfully
+type BeanFileWatcher[T any] struct {
+	file    string
+	options BeanWatchOptions[T]
+	current atomic.Pointer[T]
+
+	//checkLock serializes the checks of the file
+	checkLock sync.Mutex
+	//state modification time and size of the last checked file, empty if missing
+	state string
+	hash  [sha256.Size]byte
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+//WatchBeanFile loads a bean from a file and watches the file for changes until Stop
+//Returns:
+// the watcher
+// error if the file can't be loaded or validated
+func WatchBeanFile[T any](pFile string, pOptions BeanWatchOptions[T]) (*BeanFileWatcher[T], error) {
+
+	if pOptions.Interval <= 0 {
+		pOptions.Interval = BeanWatch_DefaultInterval
+	}
+	vRis := &BeanFileWatcher[T]{file: pFile, options: pOptions, stop: make(chan struct{}), done: make(chan struct{})}
+
+	if _, vLoadError := vRis.check(true); vLoadError != nil {
+		return nil, vLoadError
+	}
+
+	vNotifier, vNotifierError := newBeanFileNotifier(pFile)
+	if vNotifierError != nil {
+		diagnostic.LogWarning("WatchBeanFile", "changes of %s detected by polling", vNotifierError, pFile)
+	}
+
+	go vRis.watch(vNotifier)
+	return vRis, nil
+}
+
+//Get returns the current bean, shared by all the callers: it must not be modified
+func (vSelf *BeanFileWatcher[T]) Get() *T {
+	return vSelf.current.Load()
+}
+
+//GetFile returns the watched file
+func (vSelf *BeanFileWatcher[T]) GetFile() string {
+	return vSelf.file
+}
+
+//Reload checks the file immediately
+//Returns:
+// true if the bean has been replaced
+// error if the changed file can't be loaded or validated
+func (vSelf *BeanFileWatcher[T]) Reload() (bool, error) {
+	return vSelf.check(true)
+}
+
+//Stop stops watching the file, the current bean remains available. Further calls do nothing
+func (vSelf *BeanFileWatcher[T]) Stop() {
+	vSelf.stopOnce.Do(func() {
+		close(vSelf.stop)
+	})
+	<-vSelf.done
+}
+
+func (vSelf *BeanFileWatcher[T]) watch(pNotifier *beanFileNotifier) {
+
+	defer close(vSelf.done)
+
+	var vEvents <-chan struct{}
+	if pNotifier != nil {
+		defer pNotifier.close()
+		vEvents = pNotifier.events
+	}
+
+	vTicker := time.NewTicker(vSelf.options.Interval)
+	defer vTicker.Stop()
+
+	for {
+		vForce := false
+		select {
+		case <-vSelf.stop:
+			return
+		case <-vTicker.C:
+		case <-vEvents:
+			vForce = true
+		}
+		if _, vCheckError := vSelf.check(vForce); vCheckError != nil && vSelf.options.OnError != nil {
+			vSelf.options.OnError(vCheckError)
+		}
+	}
+}
+
+//check loads the file if its modification time, size or content changed since the last check
+//Parameters:
+// pForce = true to compare the content also if modification time and size are unchanged
+func (vSelf *BeanFileWatcher[T]) check(pForce bool) (bool, error) {
+
+	vSelf.checkLock.Lock()
+	defer vSelf.checkLock.Unlock()
+
+	vFileInfo, vStatError := os.Stat(vSelf.file)
+	vState := ""
+	if vStatError == nil {
+		vState = fmt.Sprintf("%d/%d", vFileInfo.ModTime().UnixNano(), vFileInfo.Size())
+	} else if os.IsNotExist(vStatError) == false {
+		return false, diagnostic.NewError("error while checking file %s", vStatError, vSelf.file)
+	}
+	vFirst := vSelf.current.Load() == nil
+	vUnchanged := vState == vSelf.state && vFirst == false
+	if vUnchanged && pForce == false {
+		return false, nil
+	}
+	vSelf.state = vState
+
+	if vStatError != nil {
+		if vUnchanged {
+			//still missing
+			return false, nil
+		}
+		return false, &BeanNotFoundError{BeanID: vSelf.file}
+	}
+
+	vContent, vReadError := ioutil.ReadFile(vSelf.file)
+	if vReadError != nil {
+		//the file is read again by the next check
+		vSelf.state = "unreadable"
+		return false, diagnostic.NewError("error while reading file %s", vReadError, vSelf.file)
+	}
+	vHash := sha256.Sum256(vContent)
+	if vHash == vSelf.hash && vFirst == false {
+		//touched without changes
+		return false, nil
+	}
+	vSelf.hash = vHash
+
+	vBean := new(T)
+	if vUnmarshalError := UnmarshalBean(vContent, vBean); vUnmarshalError != nil {
+		return false, diagnostic.NewError("error while unmarshalling file %s", vUnmarshalError, vSelf.file)
+	}
+	if vSelf.options.Validate != nil {
+		if vValidateError := vSelf.options.Validate(vBean); vValidateError != nil {
+			return false, diagnostic.NewError("invalid bean in file %s", vValidateError, vSelf.file)
+		}
+	}
+
+	vPrevious := vSelf.current.Swap(vBean)
+	if vPrevious != nil && vSelf.options.OnChange != nil {
+		vSelf.options.OnChange(vPrevious, vBean)
+	}
+	return true, nil
+}
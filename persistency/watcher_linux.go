@@ -0,0 +1,71 @@
+package persistency
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/mysinmyc/gocommons/diagnostic"
+)
+
+//beanFileNotifier notifies the changes of a file by inotify. The directory is watched, so files replaced by rename are notified
+type beanFileNotifier struct {
+	inotify *os.File
+	events  chan struct{}
+}
+
+func newBeanFileNotifier(pFile string) (*beanFileNotifier, error) {
+
+	vFd, vInitError := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if vInitError != nil {
+		return nil, diagnostic.NewError("inotify not available", vInitError)
+	}
+	//a non blocking descriptor is handled by the runtime poller, so close interrupts read
+	vInotify := os.NewFile(uintptr(vFd), "inotify")
+
+	vDir := filepath.Dir(pFile)
+	_, vWatchError := syscall.InotifyAddWatch(vFd, vDir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO|syscall.IN_CREATE|syscall.IN_DELETE|syscall.IN_MOVED_FROM)
+	if vWatchError != nil {
+		vInotify.Close()
+		return nil, diagnostic.NewError("failed to watch directory %s", vWatchError, vDir)
+	}
+
+	vRis := &beanFileNotifier{inotify: vInotify, events: make(chan struct{}, 1)}
+	go vRis.read(filepath.Base(pFile))
+	return vRis, nil
+}
+
+//read forwards the events of the file until the notifier is closed, events not yet consumed are coalesced
+func (vSelf *beanFileNotifier) read(pName string) {
+
+	vBuffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		vLength, vReadError := vSelf.inotify.Read(vBuffer)
+		if vReadError != nil {
+			return
+		}
+		for vOffset := 0; vOffset+syscall.SizeofInotifyEvent <= vLength; {
+			vEvent := (*syscall.InotifyEvent)(unsafe.Pointer(&vBuffer[vOffset]))
+			vNameStart := vOffset + syscall.SizeofInotifyEvent
+			vNameEnd := vNameStart + int(vEvent.Len)
+			if vNameEnd > vLength {
+				break
+			}
+			vName := string(bytes.TrimRight(vBuffer[vNameStart:vNameEnd], "\x00"))
+			vOffset = vNameEnd
+			if vName != pName {
+				continue
+			}
+			select {
+			case vSelf.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (vSelf *beanFileNotifier) close() {
+	vSelf.inotify.Close()
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package persistency
+
+//beanFileNotifier not available, changes are detected by polling
+type beanFileNotifier struct {
+	events chan struct{}
+}
+
+func newBeanFileNotifier(pFile string) (*beanFileNotifier, error) {
+	return nil, nil
+}
+
+func (vSelf *beanFileNotifier) close() {
+}
@@ -0,0 +1,75 @@
+package persistency
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBeanFileWatcher(pTest *testing.T) {
+
+	vFile := GetBeanFilePath(pTest.TempDir(), "watched")
+	SaveBeanIntoFile(&testBean{Id: "watched", Value: 1}, vFile)
+
+	vChanges := make(chan int, 10)
+	vErrors := make(chan error, 10)
+	vWatcher, vWatchError := WatchBeanFile(vFile, BeanWatchOptions[testBean]{
+		Interval: 20 * time.Millisecond,
+		Validate: func(pBean *testBean) error {
+			if pBean.Value < 0 {
+				return errors.New("negative value")
+			}
+			return nil
+		},
+		OnChange: func(pPrevious *testBean, pCurrent *testBean) {
+			vChanges <- pCurrent.Value
+		},
+		OnError: func(pError error) {
+			vErrors <- pError
+		}})
+	if vWatchError != nil {
+		pTest.Fatal("failed to watch file", vWatchError)
+	}
+	defer vWatcher.Stop()
+
+	if vWatcher.Get().Value != 1 {
+		pTest.Fatalf("unexpected initial bean %v", vWatcher.Get())
+	}
+
+	SaveBeanIntoFile(&testBean{Id: "watched", Value: 2}, vFile)
+	select {
+	case vValue := <-vChanges:
+		if vValue != 2 || vWatcher.Get().Value != 2 {
+			pTest.Errorf("unexpected reloaded bean %d %v", vValue, vWatcher.Get())
+		}
+	case <-time.After(5 * time.Second):
+		pTest.Fatal("change not detected")
+	}
+
+	SaveBeanIntoFile(&testBean{Id: "watched", Value: -1}, vFile)
+	select {
+	case <-vErrors:
+	case <-time.After(5 * time.Second):
+		pTest.Fatal("invalid bean not reported")
+	}
+	ioutil.WriteFile(vFile, []byte("{not json"), 0644)
+	select {
+	case <-vErrors:
+	case <-time.After(5 * time.Second):
+		pTest.Fatal("unparsable file not reported")
+	}
+	if vWatcher.Get().Value != 2 {
+		pTest.Errorf("invalid file replaced the bean %v", vWatcher.Get())
+	}
+
+	SaveBeanIntoFile(&testBean{Id: "watched", Value: 3}, vFile)
+	//the change may be already loaded by the watcher
+	if _, vReloadError := vWatcher.Reload(); vReloadError != nil || vWatcher.Get().Value != 3 {
+		pTest.Errorf("reload failed %v %v", vReloadError, vWatcher.Get())
+	}
+
+	if _, vMissingError := WatchBeanFile(vFile+".missing", BeanWatchOptions[testBean]{}); IsBeanNotFound(vMissingError) == false {
+		pTest.Errorf("expected bean not found, got %v", vMissingError)
+	}
+}